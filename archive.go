@@ -0,0 +1,93 @@
+package libautoit
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Archive is a script archive embedded in a file. A file can hold
+// several, decoys included.
+type Archive struct {
+	Offset    int    // of the header in the file
+	End       int    // offset past the archive
+	Key       byte   // the archive is XORed with it
+	Subtype   string // AU3!EA06, AU3!EA05 or AU3!OLD
+	Version   AutoItVersion
+	Resources []*AutoItResource
+	Err       error // why unpacking stopped, if it did
+}
+
+func (a *Archive) String() string {
+	return fmt.Sprintf("%s at 0x%x-0x%x, key 0x%02x, %d resources", a.Subtype, a.Offset, a.End, a.Key, len(a.Resources))
+}
+
+func versionOf(subtype string) AutoItVersion {
+	switch subtype {
+	case "AU3!EA06":
+		return EA06
+	case "AU3!EA05":
+		return EA05
+	}
+	return Legacy
+}
+
+func xorBytes(b []byte, key byte) []byte {
+	if key == 0 {
+		return b
+	}
+	buf := make([]byte, len(b))
+	for i, c := range b {
+		buf[i] = c ^ key
+	}
+	return buf
+}
+
+// locateArchives turns the headers found into archives in the order of
+// their offsets, each returned with its span of the file XORed with its
+// key. An archive ends at its trailer, the subtype repeated, or where
+// the next begins. Without any subtype the last header is taken for an
+// old archive.
+func locateArchives(data []byte, hits []SignatureHit) ([]*Archive, [][]byte) {
+	var ans []*Archive
+	for _, h := range hits {
+		p := h.Offset
+		if p+0x19 > len(data) {
+			continue
+		}
+		tag := xorBytes(data[p+0x10:p+0x18], h.Key)
+		if string(tag[:4]) != "AU3!" {
+			continue
+		}
+		ans = append(ans, &Archive{Offset: p, Key: h.Key, Subtype: string(tag)})
+	}
+	for i, a := range ans {
+		next := len(data)
+		if i+1 < len(ans) {
+			next = ans[i+1].Offset
+		}
+		a.Version = versionOf(a.Subtype)
+		a.End = next
+		// the trailer is searched for still XORed
+		if stop := bytes.LastIndex(data[a.Offset+0x19:next], xorBytes([]byte(a.Subtype), a.Key)); stop >= 0 {
+			a.End = a.Offset + 0x19 + stop
+		}
+	}
+
+	if len(ans) == 0 && len(hits) > 0 {
+		last := hits[len(hits)-1]
+		if last.Offset > 0 && last.Offset < len(data)-4 {
+			ans = append(ans, &Archive{
+				Offset:  last.Offset,
+				End:     len(data) - 4,
+				Key:     last.Key,
+				Subtype: "AU3!OLD",
+				Version: Legacy,
+			})
+		}
+	}
+	spans := make([][]byte, len(ans))
+	for i, a := range ans {
+		spans[i] = xorBytes(data[a.Offset:a.End], a.Key)
+	}
+	return ans, spans
+}
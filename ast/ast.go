@@ -0,0 +1,443 @@
+package ast
+
+// Syntax tree of a decompiled AutoIt script.
+// Trees are built by parser.ParseScript from any lexer.ITokenizer,
+// so scripts recovered from the binary token stream and plain text
+// scripts end up with the same shape.
+
+import (
+	"fmt"
+	"github.com/x0r19x91/libautoit/lexer"
+)
+
+// Pos locates a node in the token stream it was parsed from.
+type Pos struct {
+	Line  int // 1-based line number
+	Token int // index of the first token of the node
+}
+
+var NoPos = Pos{}
+
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Pos) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Token)
+}
+
+type Node interface {
+	Pos() Pos
+}
+
+type Expr interface {
+	Node
+	exprNode()
+}
+
+type Stmt interface {
+	Node
+	stmtNode()
+}
+
+// expressions
+type (
+	// BadExpr holds the tokens of an expression that could not be parsed.
+	BadExpr struct {
+		From   Pos
+		Tokens []*lexer.Token
+	}
+
+	// Variable is $Name, Name is stored without the '$'.
+	Variable struct {
+		NamePos Pos
+		Name    string
+	}
+
+	// MacroExpr is @Name, Name is stored without the '@'.
+	MacroExpr struct {
+		NamePos Pos
+		Name    string
+	}
+
+	// FuncIdent names a user defined or builtin function.
+	FuncIdent struct {
+		NamePos Pos
+		Name    string
+		Builtin bool
+	}
+
+	// BasicLit is a number or a string. Numbers keep their source text,
+	// strings are stored unquoted.
+	BasicLit struct {
+		ValuePos Pos
+		Kind     lexer.TokenType // Int32, Int64, Float64 or StrLit
+		Value    string
+	}
+
+	// KeywordLit is one of True, False, Null or Default.
+	KeywordLit struct {
+		NamePos Pos
+		Name    string
+	}
+
+	UnaryExpr struct {
+		OpPos Pos
+		Op    lexer.TokenType // OpAdd, OpSub or OpNot
+		X     Expr
+	}
+
+	// BinaryExpr covers arithmetic, concatenation, comparison and logic.
+	// An '=' used as a comparison is stored as OpEq.
+	BinaryExpr struct {
+		X     Expr
+		OpPos Pos
+		Op    lexer.TokenType
+		Y     Expr
+	}
+
+	TernaryExpr struct {
+		Cond Expr
+		Then Expr
+		Else Expr
+	}
+
+	ParenExpr struct {
+		Lparen Pos
+		X      Expr
+	}
+
+	IndexExpr struct {
+		X     Expr
+		Index Expr
+	}
+
+	// SelectorExpr is X.Sel, X is nil inside a With block.
+	SelectorExpr struct {
+		Dot Pos
+		X   Expr
+		Sel string
+	}
+
+	CallExpr struct {
+		Fun  Expr // *FuncIdent, *SelectorExpr or a function variable
+		Args []Expr
+	}
+
+	ArrayLit struct {
+		Lbrack Pos
+		Elts   []Expr
+	}
+
+	// RangeExpr is the "From To To" form of a Switch case.
+	RangeExpr struct {
+		From Expr
+		To   Expr
+	}
+)
+
+// statements
+type (
+	// BadStmt holds the tokens of a line that could not be parsed.
+	BadStmt struct {
+		From   Pos
+		Tokens []*lexer.Token
+	}
+
+	// DirectiveStmt is a compiler directive such as #include or #Region.
+	DirectiveStmt struct {
+		DirPos Pos
+		Text   string
+	}
+
+	// CommentStmt is a "; Text" line. The parser drops comments, these
+	// are added by passes annotating the tree.
+	CommentStmt struct {
+		Semi Pos
+		Text string
+	}
+
+	ExprStmt struct {
+		X Expr
+	}
+
+	AssignStmt struct {
+		Lhs    Expr
+		TokPos Pos
+		Op     lexer.TokenType // OpAssign, OpAddEq, ..., OpConcatAssign
+		Rhs    Expr
+	}
+
+	// DeclStmt is a Global/Local/Dim/Static/Const declaration.
+	DeclStmt struct {
+		DeclPos Pos
+		Scope   string // "Global", "Local", "Dim" or ""
+		Static  bool
+		Const   bool
+		Specs   []*VarSpec
+	}
+
+	EnumStmt struct {
+		EnumPos Pos
+		Scope   string
+		Const   bool
+		StepOp  lexer.TokenType // OpAdd, OpSub or OpMul, 0 if absent
+		Step    Expr
+		Specs   []*VarSpec
+	}
+
+	ReDimStmt struct {
+		ReDimPos Pos
+		X        Expr
+	}
+
+	BlockStmt struct {
+		Start Pos
+		List  []Stmt
+	}
+
+	// IfStmt covers If/ElseIf/Else/EndIf. An ElseIf is an *IfStmt in
+	// Else, a plain Else is a *BlockStmt.
+	IfStmt struct {
+		If         Pos
+		Cond       Expr
+		Body       *BlockStmt
+		Else       Stmt
+		SingleLine bool // If Cond Then Stmt
+	}
+
+	WhileStmt struct {
+		While Pos
+		Cond  Expr
+		Body  *BlockStmt
+	}
+
+	// DoStmt is Do ... Until Cond.
+	DoStmt struct {
+		Do   Pos
+		Body *BlockStmt
+		Cond Expr
+	}
+
+	ForStmt struct {
+		For  Pos
+		Var  *Variable
+		From Expr
+		To   Expr
+		Step Expr
+		Body *BlockStmt
+	}
+
+	ForInStmt struct {
+		For  Pos
+		Var  *Variable
+		X    Expr
+		Body *BlockStmt
+	}
+
+	SelectStmt struct {
+		Select Pos
+		Cases  []*CaseClause
+	}
+
+	SwitchStmt struct {
+		Switch Pos
+		Tag    Expr
+		Cases  []*CaseClause
+	}
+
+	// CaseClause is a Case of a Select or Switch, List is nil for Case Else.
+	CaseClause struct {
+		Case Pos
+		List []Expr
+		Body *BlockStmt
+	}
+
+	WithStmt struct {
+		With Pos
+		X    Expr
+		Body *BlockStmt
+	}
+
+	ReturnStmt struct {
+		Return Pos
+		Result Expr
+	}
+
+	ExitStmt struct {
+		Exit Pos
+		Code Expr
+	}
+
+	// BranchStmt is ExitLoop, ContinueLoop or ContinueCase.
+	BranchStmt struct {
+		TokPos Pos
+		Tok    string
+		Level  Expr
+	}
+
+	FuncDecl struct {
+		Func     Pos
+		Volatile bool
+		Name     *FuncIdent
+		Params   []*Param
+		Body     *BlockStmt
+	}
+)
+
+// VarSpec is a single variable of a declaration: $Name[Dims...] = Value
+type VarSpec struct {
+	Name  *Variable
+	Dims  []Expr
+	Value Expr
+}
+
+// Param is a function parameter: [ByRef] [Const] $Name [= Default]
+type Param struct {
+	Name    *Variable
+	ByRef   bool
+	Const   bool
+	Default Expr
+}
+
+// Script is the root of a parsed script.
+type Script struct {
+	Stmts []Stmt
+}
+
+func (x *BadExpr) Pos() Pos     { return x.From }
+func (x *Variable) Pos() Pos    { return x.NamePos }
+func (x *MacroExpr) Pos() Pos   { return x.NamePos }
+func (x *FuncIdent) Pos() Pos   { return x.NamePos }
+func (x *BasicLit) Pos() Pos    { return x.ValuePos }
+func (x *KeywordLit) Pos() Pos  { return x.NamePos }
+func (x *UnaryExpr) Pos() Pos   { return x.OpPos }
+func (x *BinaryExpr) Pos() Pos  { return x.X.Pos() }
+func (x *TernaryExpr) Pos() Pos { return x.Cond.Pos() }
+func (x *ParenExpr) Pos() Pos   { return x.Lparen }
+func (x *IndexExpr) Pos() Pos   { return x.X.Pos() }
+func (x *CallExpr) Pos() Pos    { return x.Fun.Pos() }
+func (x *ArrayLit) Pos() Pos    { return x.Lbrack }
+func (x *RangeExpr) Pos() Pos   { return x.From.Pos() }
+func (x *SelectorExpr) Pos() Pos {
+	if x.X != nil {
+		return x.X.Pos()
+	}
+	return x.Dot
+}
+
+func (s *BadStmt) Pos() Pos       { return s.From }
+func (s *DirectiveStmt) Pos() Pos { return s.DirPos }
+func (s *CommentStmt) Pos() Pos   { return s.Semi }
+func (s *ExprStmt) Pos() Pos      { return s.X.Pos() }
+func (s *AssignStmt) Pos() Pos    { return s.Lhs.Pos() }
+func (s *DeclStmt) Pos() Pos      { return s.DeclPos }
+func (s *EnumStmt) Pos() Pos      { return s.EnumPos }
+func (s *ReDimStmt) Pos() Pos     { return s.ReDimPos }
+func (s *BlockStmt) Pos() Pos     { return s.Start }
+func (s *IfStmt) Pos() Pos        { return s.If }
+func (s *WhileStmt) Pos() Pos     { return s.While }
+func (s *DoStmt) Pos() Pos        { return s.Do }
+func (s *ForStmt) Pos() Pos       { return s.For }
+func (s *ForInStmt) Pos() Pos     { return s.For }
+func (s *SelectStmt) Pos() Pos    { return s.Select }
+func (s *SwitchStmt) Pos() Pos    { return s.Switch }
+func (s *CaseClause) Pos() Pos    { return s.Case }
+func (s *WithStmt) Pos() Pos      { return s.With }
+func (s *ReturnStmt) Pos() Pos    { return s.Return }
+func (s *ExitStmt) Pos() Pos      { return s.Exit }
+func (s *BranchStmt) Pos() Pos    { return s.TokPos }
+func (s *FuncDecl) Pos() Pos      { return s.Func }
+
+func (s *VarSpec) Pos() Pos { return s.Name.Pos() }
+func (s *Param) Pos() Pos   { return s.Name.Pos() }
+func (s *Script) Pos() Pos {
+	if len(s.Stmts) > 0 {
+		return s.Stmts[0].Pos()
+	}
+	return NoPos
+}
+
+func (*BadExpr) exprNode()      {}
+func (*Variable) exprNode()     {}
+func (*MacroExpr) exprNode()    {}
+func (*FuncIdent) exprNode()    {}
+func (*BasicLit) exprNode()     {}
+func (*KeywordLit) exprNode()   {}
+func (*UnaryExpr) exprNode()    {}
+func (*BinaryExpr) exprNode()   {}
+func (*TernaryExpr) exprNode()  {}
+func (*ParenExpr) exprNode()    {}
+func (*IndexExpr) exprNode()    {}
+func (*SelectorExpr) exprNode() {}
+func (*CallExpr) exprNode()     {}
+func (*ArrayLit) exprNode()     {}
+func (*RangeExpr) exprNode()    {}
+
+func (*BadStmt) stmtNode()       {}
+func (*DirectiveStmt) stmtNode() {}
+func (*CommentStmt) stmtNode()   {}
+func (*ExprStmt) stmtNode()      {}
+func (*AssignStmt) stmtNode()    {}
+func (*DeclStmt) stmtNode()      {}
+func (*EnumStmt) stmtNode()      {}
+func (*ReDimStmt) stmtNode()     {}
+func (*BlockStmt) stmtNode()     {}
+func (*IfStmt) stmtNode()        {}
+func (*WhileStmt) stmtNode()     {}
+func (*DoStmt) stmtNode()        {}
+func (*ForStmt) stmtNode()       {}
+func (*ForInStmt) stmtNode()     {}
+func (*SelectStmt) stmtNode()    {}
+func (*SwitchStmt) stmtNode()    {}
+func (*CaseClause) stmtNode()    {}
+func (*WithStmt) stmtNode()      {}
+func (*ReturnStmt) stmtNode()    {}
+func (*ExitStmt) stmtNode()      {}
+func (*BranchStmt) stmtNode()    {}
+func (*FuncDecl) stmtNode()      {}
+
+// Funcs returns the function declarations of the script in source order.
+func (s *Script) Funcs() []*FuncDecl {
+	var ans []*FuncDecl
+	for _, st := range s.Stmts {
+		if fn, ok := st.(*FuncDecl); ok {
+			ans = append(ans, fn)
+		}
+	}
+	return ans
+}
+
+// CalleeName returns the name of a called user or builtin function,
+// "" for method calls and calls through variables.
+func (x *CallExpr) CalleeName() string {
+	if fn, ok := x.Fun.(*FuncIdent); ok {
+		return fn.Name
+	}
+	return ""
+}
+
+// IsBuiltin reports whether x calls a builtin function.
+func (x *CallExpr) IsBuiltin() bool {
+	fn, ok := x.Fun.(*FuncIdent)
+	return ok && fn.Builtin
+}
+
+// StringValue returns the value of a string literal.
+func StringValue(e Expr) (string, bool) {
+	if lit, ok := e.(*BasicLit); ok && lit.Kind == lexer.StrLit {
+		return lit.Value, true
+	}
+	return "", false
+}
+
+// BinaryPrec is the precedence of a binary operator, OpEq included.
+func BinaryPrec(op lexer.TokenType) int {
+	if op == lexer.OpEq {
+		return lexer.OpAssign.GetBinaryPrec()
+	}
+	return op.GetBinaryPrec()
+}
@@ -0,0 +1,614 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/x0r19x91/libautoit/lexer"
+	"io"
+	"strings"
+)
+
+// Printer turns a tree back into AutoIt source.
+type Printer struct {
+	IndentSpaces int
+	UseTabs      bool
+	FuncComments bool // add "; -> Name" after EndFunc
+	ExtraNewline bool // blank line after EndFunc and #Region
+
+	buf    *bytes.Buffer
+	indent int
+}
+
+func NewPrinter() *Printer {
+	return &Printer{
+		IndentSpaces: 4,
+		FuncComments: true,
+		ExtraNewline: true,
+	}
+}
+
+// Format prints node with the default printer settings.
+func Format(node Node) string {
+	var buf bytes.Buffer
+	NewPrinter().Fprint(&buf, node)
+	return buf.String()
+}
+
+// ExprString returns the source of an expression on a single line.
+func ExprString(x Expr) string {
+	p := NewPrinter()
+	p.buf = new(bytes.Buffer)
+	p.expr(x)
+	return p.buf.String()
+}
+
+func (p *Printer) Fprint(w io.Writer, node Node) error {
+	p.buf = new(bytes.Buffer)
+	p.indent = 0
+	switch n := node.(type) {
+	case *Script:
+		p.stmtList(n.Stmts)
+	case Stmt:
+		p.stmt(n)
+	case Expr:
+		p.expr(n)
+		p.buf.WriteByte('\n')
+	case *VarSpec:
+		p.spec(n)
+		p.buf.WriteByte('\n')
+	case *Param:
+		p.param(n)
+		p.buf.WriteByte('\n')
+	default:
+		return fmt.Errorf("ast: unsupported node type %T", node)
+	}
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+func (p *Printer) pad() {
+	if p.UseTabs {
+		p.buf.WriteString(strings.Repeat("\t", p.indent))
+	} else {
+		p.buf.WriteString(strings.Repeat(" ", p.indent*p.IndentSpaces))
+	}
+}
+
+func (p *Printer) line(format string, args ...interface{}) {
+	p.pad()
+	fmt.Fprintf(p.buf, format, args...)
+	p.buf.WriteByte('\n')
+}
+
+func (p *Printer) block(b *BlockStmt) {
+	p.indent++
+	if b != nil {
+		p.stmtList(b.List)
+	}
+	p.indent--
+}
+
+func (p *Printer) stmtList(list []Stmt) {
+	for _, s := range list {
+		p.stmt(s)
+	}
+}
+
+func (p *Printer) stmt(s Stmt) {
+	switch s := s.(type) {
+	case *BadStmt:
+		p.pad()
+		p.tokens(s.Tokens)
+		p.buf.WriteByte('\n')
+
+	case *DirectiveStmt:
+		p.line("%s", s.Text)
+		if p.ExtraNewline && strings.HasPrefix(s.Text, "#EndRegion") {
+			p.buf.WriteByte('\n')
+		}
+
+	case *CommentStmt:
+		for _, l := range strings.Split(s.Text, "\n") {
+			p.line("; %s", l)
+		}
+
+	case *ExprStmt:
+		p.pad()
+		p.expr(s.X)
+		p.buf.WriteByte('\n')
+
+	case *AssignStmt:
+		p.pad()
+		p.simpleStmt(s)
+		p.buf.WriteByte('\n')
+
+	case *DeclStmt:
+		p.pad()
+		p.simpleStmt(s)
+		p.buf.WriteByte('\n')
+
+	case *EnumStmt:
+		p.pad()
+		p.simpleStmt(s)
+		p.buf.WriteByte('\n')
+
+	case *ReDimStmt, *ReturnStmt, *ExitStmt, *BranchStmt:
+		p.pad()
+		p.simpleStmt(s)
+		p.buf.WriteByte('\n')
+
+	case *BlockStmt:
+		p.stmtList(s.List)
+
+	case *IfStmt:
+		p.ifStmt(s, "If")
+
+	case *WhileStmt:
+		p.pad()
+		p.buf.WriteString("While ")
+		p.expr(s.Cond)
+		p.buf.WriteByte('\n')
+		p.block(s.Body)
+		p.line("WEnd")
+
+	case *DoStmt:
+		p.line("Do")
+		p.block(s.Body)
+		p.pad()
+		p.buf.WriteString("Until ")
+		p.expr(s.Cond)
+		p.buf.WriteByte('\n')
+
+	case *ForStmt:
+		p.pad()
+		p.buf.WriteString("For ")
+		p.expr(s.Var)
+		p.buf.WriteString(" = ")
+		p.expr(s.From)
+		p.buf.WriteString(" To ")
+		p.expr(s.To)
+		if s.Step != nil {
+			p.buf.WriteString(" Step ")
+			p.expr(s.Step)
+		}
+		p.buf.WriteByte('\n')
+		p.block(s.Body)
+		p.line("Next")
+
+	case *ForInStmt:
+		p.pad()
+		p.buf.WriteString("For ")
+		p.expr(s.Var)
+		p.buf.WriteString(" In ")
+		p.expr(s.X)
+		p.buf.WriteByte('\n')
+		p.block(s.Body)
+		p.line("Next")
+
+	case *SelectStmt:
+		p.line("Select")
+		p.indent++
+		for _, c := range s.Cases {
+			p.stmt(c)
+		}
+		p.indent--
+		p.line("EndSelect")
+
+	case *SwitchStmt:
+		p.pad()
+		p.buf.WriteString("Switch ")
+		p.expr(s.Tag)
+		p.buf.WriteByte('\n')
+		p.indent++
+		for _, c := range s.Cases {
+			p.stmt(c)
+		}
+		p.indent--
+		p.line("EndSwitch")
+
+	case *CaseClause:
+		p.pad()
+		p.buf.WriteString("Case ")
+		if s.List == nil {
+			p.buf.WriteString("Else")
+		} else {
+			p.exprList(s.List)
+		}
+		p.buf.WriteByte('\n')
+		p.block(s.Body)
+
+	case *WithStmt:
+		p.pad()
+		p.buf.WriteString("With ")
+		p.expr(s.X)
+		p.buf.WriteByte('\n')
+		p.block(s.Body)
+		p.line("EndWith")
+
+	case *FuncDecl:
+		p.pad()
+		if s.Volatile {
+			p.buf.WriteString("Volatile ")
+		}
+		p.buf.WriteString("Func ")
+		p.buf.WriteString(s.Name.Name)
+		p.buf.WriteByte('(')
+		for i, par := range s.Params {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.param(par)
+		}
+		p.buf.WriteString(")\n")
+		p.block(s.Body)
+		p.pad()
+		p.buf.WriteString("EndFunc")
+		if p.FuncComments {
+			p.buf.WriteString(strings.Repeat(" ", p.IndentSpaces))
+			p.buf.WriteString("; -> ")
+			p.buf.WriteString(s.Name.Name)
+		}
+		p.buf.WriteByte('\n')
+		if p.ExtraNewline {
+			p.buf.WriteByte('\n')
+		}
+
+	default:
+		panic(fmt.Sprintf("ast: unexpected statement %T", s))
+	}
+}
+
+// simpleStmt prints statements that fit on a single line without the
+// indentation and the trailing newline
+func (p *Printer) simpleStmt(s Stmt) {
+	switch s := s.(type) {
+	case *ExprStmt:
+		p.expr(s.X)
+
+	case *AssignStmt:
+		p.expr(s.Lhs)
+		p.buf.WriteByte(' ')
+		p.buf.WriteString(opString(s.Op))
+		p.buf.WriteByte(' ')
+		p.expr(s.Rhs)
+
+	case *DeclStmt:
+		p.buf.WriteString(declPrefix(s.Scope, s.Static, s.Const))
+		p.buf.WriteByte(' ')
+		for i, spec := range s.Specs {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.spec(spec)
+		}
+
+	case *EnumStmt:
+		if prefix := declPrefix(s.Scope, false, s.Const); prefix != "" {
+			p.buf.WriteString(prefix)
+			p.buf.WriteByte(' ')
+		}
+		p.buf.WriteString("Enum ")
+		if s.Step != nil {
+			p.buf.WriteString("Step ")
+			if s.StepOp != 0 {
+				p.buf.WriteString(opString(s.StepOp))
+			}
+			p.expr(s.Step)
+			p.buf.WriteByte(' ')
+		}
+		for i, spec := range s.Specs {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.spec(spec)
+		}
+
+	case *ReDimStmt:
+		p.buf.WriteString("ReDim ")
+		p.expr(s.X)
+
+	case *ReturnStmt:
+		p.buf.WriteString("Return")
+		if s.Result != nil {
+			p.buf.WriteByte(' ')
+			p.expr(s.Result)
+		}
+
+	case *ExitStmt:
+		p.buf.WriteString("Exit")
+		if s.Code != nil {
+			p.buf.WriteByte(' ')
+			p.expr(s.Code)
+		}
+
+	case *BranchStmt:
+		p.buf.WriteString(s.Tok)
+		if s.Level != nil {
+			p.buf.WriteByte(' ')
+			p.expr(s.Level)
+		}
+
+	case *BadStmt:
+		p.tokens(s.Tokens)
+
+	default:
+		panic(fmt.Sprintf("ast: %T is not a simple statement", s))
+	}
+}
+
+func (p *Printer) ifStmt(s *IfStmt, kw string) {
+	p.pad()
+	p.buf.WriteString(kw)
+	p.buf.WriteByte(' ')
+	p.expr(s.Cond)
+	p.buf.WriteString(" Then")
+	if s.SingleLine && s.Else == nil && s.Body != nil && len(s.Body.List) == 1 {
+		if isSimple(s.Body.List[0]) {
+			p.buf.WriteByte(' ')
+			p.simpleStmt(s.Body.List[0])
+			p.buf.WriteByte('\n')
+			return
+		}
+	}
+	p.buf.WriteByte('\n')
+	p.block(s.Body)
+	switch e := s.Else.(type) {
+	case nil:
+	case *IfStmt:
+		p.ifStmt(e, "ElseIf")
+		return
+	case *BlockStmt:
+		p.line("Else")
+		p.block(e)
+	default:
+		p.line("Else")
+		p.indent++
+		p.stmt(e)
+		p.indent--
+	}
+	p.line("EndIf")
+}
+
+func isSimple(s Stmt) bool {
+	switch s.(type) {
+	case *ExprStmt, *AssignStmt, *DeclStmt, *EnumStmt, *ReDimStmt,
+		*ReturnStmt, *ExitStmt, *BranchStmt, *BadStmt:
+		return true
+	}
+	return false
+}
+
+func declPrefix(scope string, static, isConst bool) string {
+	var parts []string
+	if scope != "" {
+		parts = append(parts, scope)
+	}
+	if static {
+		parts = append(parts, "Static")
+	}
+	if isConst {
+		parts = append(parts, "Const")
+	}
+	return strings.Join(parts, " ")
+}
+
+func (p *Printer) spec(s *VarSpec) {
+	p.expr(s.Name)
+	for _, d := range s.Dims {
+		p.buf.WriteByte('[')
+		p.expr(d)
+		p.buf.WriteByte(']')
+	}
+	if s.Value != nil {
+		p.buf.WriteString(" = ")
+		p.expr(s.Value)
+	}
+}
+
+func (p *Printer) param(par *Param) {
+	if par.ByRef {
+		p.buf.WriteString("ByRef ")
+	}
+	if par.Const {
+		p.buf.WriteString("Const ")
+	}
+	p.expr(par.Name)
+	if par.Default != nil {
+		p.buf.WriteString(" = ")
+		p.expr(par.Default)
+	}
+}
+
+func (p *Printer) tokens(toks []*lexer.Token) {
+	for i, t := range toks {
+		if i > 0 {
+			p.buf.WriteByte(' ')
+		}
+		p.buf.WriteString(t.Value)
+	}
+}
+
+func (p *Printer) exprList(list []Expr) {
+	for i, x := range list {
+		if i > 0 {
+			p.buf.WriteString(", ")
+		}
+		p.expr(x)
+	}
+}
+
+// precedence of an expression, the higher the tighter it binds
+func exprPrec(x Expr) int {
+	switch x := x.(type) {
+	case *TernaryExpr:
+		return -1
+	case *BinaryExpr:
+		return BinaryPrec(x.Op)
+	case *UnaryExpr:
+		return x.Op.GetUnaryPrec()
+	case *BasicLit:
+		if x.Kind == lexer.StrLit && strings.IndexFunc(x.Value, isControl) >= 0 {
+			// printed as a concatenation
+			return lexer.OpConcat.GetBinaryPrec()
+		}
+	}
+	return 100
+}
+
+func (p *Printer) exprPrec(x Expr, prec int) {
+	if exprPrec(x) < prec {
+		p.buf.WriteByte('(')
+		p.expr(x)
+		p.buf.WriteByte(')')
+	} else {
+		p.expr(x)
+	}
+}
+
+func (p *Printer) expr(x Expr) {
+	switch x := x.(type) {
+	case nil:
+	case *BadExpr:
+		p.tokens(x.Tokens)
+
+	case *Variable:
+		p.buf.WriteByte('$')
+		p.buf.WriteString(x.Name)
+
+	case *MacroExpr:
+		p.buf.WriteByte('@')
+		p.buf.WriteString(x.Name)
+
+	case *FuncIdent:
+		p.buf.WriteString(x.Name)
+
+	case *BasicLit:
+		if x.Kind == lexer.StrLit {
+			p.buf.WriteString(Quote(x.Value))
+		} else {
+			p.buf.WriteString(x.Value)
+		}
+
+	case *KeywordLit:
+		p.buf.WriteString(x.Name)
+
+	case *UnaryExpr:
+		p.buf.WriteString(opString(x.Op))
+		if x.Op == lexer.OpNot {
+			p.buf.WriteByte(' ')
+		}
+		p.exprPrec(x.X, x.Op.GetUnaryPrec())
+
+	case *BinaryExpr:
+		prec := BinaryPrec(x.Op)
+		p.exprPrec(x.X, prec)
+		p.buf.WriteByte(' ')
+		p.buf.WriteString(opString(x.Op))
+		p.buf.WriteByte(' ')
+		p.exprPrec(x.Y, prec+1)
+
+	case *TernaryExpr:
+		p.exprPrec(x.Cond, 0)
+		p.buf.WriteString(" ? ")
+		p.exprPrec(x.Then, 0)
+		p.buf.WriteString(" : ")
+		p.expr(x.Else)
+
+	case *ParenExpr:
+		p.buf.WriteByte('(')
+		p.expr(x.X)
+		p.buf.WriteByte(')')
+
+	case *IndexExpr:
+		p.exprPrec(x.X, 100)
+		p.buf.WriteByte('[')
+		p.expr(x.Index)
+		p.buf.WriteByte(']')
+
+	case *SelectorExpr:
+		if x.X != nil {
+			p.exprPrec(x.X, 100)
+		}
+		p.buf.WriteByte('.')
+		p.buf.WriteString(x.Sel)
+
+	case *CallExpr:
+		p.exprPrec(x.Fun, 100)
+		p.buf.WriteByte('(')
+		p.exprList(x.Args)
+		p.buf.WriteByte(')')
+
+	case *ArrayLit:
+		p.buf.WriteByte('[')
+		p.exprList(x.Elts)
+		p.buf.WriteByte(']')
+
+	case *RangeExpr:
+		p.expr(x.From)
+		p.buf.WriteString(" To ")
+		p.expr(x.To)
+
+	default:
+		panic(fmt.Sprintf("ast: unexpected expression %T", x))
+	}
+}
+
+func opString(op lexer.TokenType) string {
+	switch op {
+	case lexer.OpAnd:
+		return "And"
+	case lexer.OpOr:
+		return "Or"
+	case lexer.OpNot:
+		return "Not"
+	case lexer.OpEq:
+		return "="
+	}
+	if tok := lexer.GetTokenByType(op); tok.TokType != lexer.InvalidToken {
+		return tok.Value
+	}
+	return op.String()
+}
+
+func isControl(r rune) bool {
+	return r < 0x20 || r == 0x7f
+}
+
+// Quote returns s as an AutoIt string literal. Control characters that
+// can't appear inside a literal are joined in with @CRLF, @TAB or Chr().
+func Quote(s string) string {
+	if s == "" {
+		return `""`
+	}
+	var parts []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			parts = append(parts, `"`+strings.ReplaceAll(cur.String(), `"`, `""`)+`"`)
+			cur.Reset()
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 0x20 && c != 0x7f {
+			cur.WriteByte(c)
+			continue
+		}
+		flush()
+		switch {
+		case c == '\r' && i+1 < len(s) && s[i+1] == '\n':
+			parts = append(parts, "@CRLF")
+			i++
+		case c == '\r':
+			parts = append(parts, "@CR")
+		case c == '\n':
+			parts = append(parts, "@LF")
+		case c == '\t':
+			parts = append(parts, "@TAB")
+		default:
+			parts = append(parts, fmt.Sprintf("Chr(%d)", c))
+		}
+	}
+	flush()
+	return strings.Join(parts, " & ")
+}
@@ -0,0 +1,459 @@
+// Adapted to this syntax tree from golang.org/x/tools/go/ast/astutil/rewrite.go.
+//
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE.go-authors file.
+
+package ast
+
+import "fmt"
+
+// An ApplyFunc is invoked by Rewrite for each node n, even if n is nil,
+// before and/or after the node's children, using a Cursor describing
+// the current node and providing operations on it.
+//
+// The return value of ApplyFunc controls the syntax tree traversal.
+// See Rewrite for details.
+type ApplyFunc func(*Cursor) bool
+
+// Rewrite traverses a syntax tree recursively, starting with root,
+// and calling pre and post for each node as described below.
+// Rewrite returns the syntax tree, possibly modified.
+//
+// If pre is not nil, it is called for each node before the node's
+// children are traversed (pre-order). If pre returns false, no
+// children are traversed, and post is not called for that node.
+//
+// If post is not nil, and a prior call of pre didn't return false,
+// post is called for each node after its children are traversed
+// (post-order). If post returns false, traversal is terminated and
+// Rewrite returns immediately.
+//
+// Only fields that refer to AST nodes are considered children.
+// Children are traversed in source order. Nodes inserted or replaced
+// through the Cursor are not visited by the same pre call, but the
+// children of a node replaced in pre are.
+func Rewrite(root Node, pre, post ApplyFunc) (result Node) {
+	result = root
+	defer func() {
+		if r := recover(); r != nil && r != abort {
+			panic(r)
+		}
+	}()
+
+	a := &application{pre: pre, post: post}
+	a.apply(nil, "Node", nil, root, func(n Node) { result = n })
+	return
+}
+
+var abort = new(int) // singleton, to signal termination of Rewrite
+
+// A Cursor describes a node encountered during Rewrite.
+// Information about the node and its parent is available
+// from the Node, Parent, Name, and Index methods.
+//
+// If p is a variable of type and value of the current parent node
+// c.Parent(), and f is the field identifier with name c.Name(),
+// the following invariants hold:
+//
+//	p.f            == c.Node()  if c.Index() <  0
+//	p.f[c.Index()] == c.Node()  if c.Index() >= 0
+//
+// The methods Replace, Delete, InsertBefore, and InsertAfter
+// can be used to change the AST without disrupting Rewrite.
+type Cursor struct {
+	parent Node
+	name   string
+	iter   *iterator // valid if non-nil
+	list   nodeList  // valid if iter is non-nil
+	set    func(Node)
+	node   Node
+}
+
+// Node returns the current Node.
+func (c *Cursor) Node() Node { return c.node }
+
+// Parent returns the parent of the current Node, nil for the root.
+func (c *Cursor) Parent() Node { return c.parent }
+
+// Name returns the name of the parent Node field that contains the
+// current Node.
+func (c *Cursor) Name() string { return c.name }
+
+// Index reports the index >= 0 of the current Node in the slice of
+// Nodes that contains it, or a value < 0 if the current Node is not
+// part of a slice.
+func (c *Cursor) Index() int {
+	if c.iter != nil {
+		return c.iter.index
+	}
+	return -1
+}
+
+// Replace replaces the current Node with n.
+// The replacement node is not walked by Rewrite.
+func (c *Cursor) Replace(n Node) {
+	if c.iter != nil {
+		c.list.set(c.iter.index, n)
+	} else {
+		c.set(n)
+	}
+	c.node = n
+}
+
+// Delete deletes the current Node from its containing slice.
+// If the current Node is not part of a slice, Delete panics.
+func (c *Cursor) Delete() {
+	if c.iter == nil {
+		panic("Delete node not contained in slice")
+	}
+	c.list.remove(c.iter.index)
+	c.iter.step--
+}
+
+// InsertAfter inserts n after the current Node in its containing slice.
+// If the current Node is not part of a slice, InsertAfter panics.
+// Rewrite does not walk n.
+func (c *Cursor) InsertAfter(n Node) {
+	if c.iter == nil {
+		panic("InsertAfter node not contained in slice")
+	}
+	c.list.insert(c.iter.index+1, n)
+	c.iter.step++
+}
+
+// InsertBefore inserts n before the current Node in its containing slice.
+// If the current Node is not part of a slice, InsertBefore panics.
+// Rewrite does not walk n.
+func (c *Cursor) InsertBefore(n Node) {
+	if c.iter == nil {
+		panic("InsertBefore node not contained in slice")
+	}
+	c.list.insert(c.iter.index, n)
+	c.iter.index++
+}
+
+// nodeList gives the Cursor access to the slices of the AST
+type nodeList interface {
+	len() int
+	at(i int) Node
+	set(i int, n Node)
+	insert(i int, n Node)
+	remove(i int)
+}
+
+type stmtList struct{ p *[]Stmt }
+
+func (l stmtList) len() int          { return len(*l.p) }
+func (l stmtList) at(i int) Node     { return (*l.p)[i] }
+func (l stmtList) set(i int, n Node) { (*l.p)[i] = asStmt(n) }
+func (l stmtList) remove(i int) {
+	s := *l.p
+	copy(s[i:], s[i+1:])
+	s[len(s)-1] = nil
+	*l.p = s[:len(s)-1]
+}
+func (l stmtList) insert(i int, n Node) {
+	s := append(*l.p, nil)
+	copy(s[i+1:], s[i:])
+	s[i] = asStmt(n)
+	*l.p = s
+}
+
+type exprList struct{ p *[]Expr }
+
+func (l exprList) len() int          { return len(*l.p) }
+func (l exprList) at(i int) Node     { return (*l.p)[i] }
+func (l exprList) set(i int, n Node) { (*l.p)[i] = asExpr(n) }
+func (l exprList) remove(i int) {
+	s := *l.p
+	copy(s[i:], s[i+1:])
+	s[len(s)-1] = nil
+	*l.p = s[:len(s)-1]
+}
+func (l exprList) insert(i int, n Node) {
+	s := append(*l.p, nil)
+	copy(s[i+1:], s[i:])
+	s[i] = asExpr(n)
+	*l.p = s
+}
+
+type specList struct{ p *[]*VarSpec }
+
+func (l specList) len() int          { return len(*l.p) }
+func (l specList) at(i int) Node     { return (*l.p)[i] }
+func (l specList) set(i int, n Node) { (*l.p)[i] = n.(*VarSpec) }
+func (l specList) remove(i int) {
+	s := *l.p
+	copy(s[i:], s[i+1:])
+	s[len(s)-1] = nil
+	*l.p = s[:len(s)-1]
+}
+func (l specList) insert(i int, n Node) {
+	s := append(*l.p, nil)
+	copy(s[i+1:], s[i:])
+	s[i] = n.(*VarSpec)
+	*l.p = s
+}
+
+type paramList struct{ p *[]*Param }
+
+func (l paramList) len() int          { return len(*l.p) }
+func (l paramList) at(i int) Node     { return (*l.p)[i] }
+func (l paramList) set(i int, n Node) { (*l.p)[i] = n.(*Param) }
+func (l paramList) remove(i int) {
+	s := *l.p
+	copy(s[i:], s[i+1:])
+	s[len(s)-1] = nil
+	*l.p = s[:len(s)-1]
+}
+func (l paramList) insert(i int, n Node) {
+	s := append(*l.p, nil)
+	copy(s[i+1:], s[i:])
+	s[i] = n.(*Param)
+	*l.p = s
+}
+
+type caseList struct{ p *[]*CaseClause }
+
+func (l caseList) len() int          { return len(*l.p) }
+func (l caseList) at(i int) Node     { return (*l.p)[i] }
+func (l caseList) set(i int, n Node) { (*l.p)[i] = n.(*CaseClause) }
+func (l caseList) remove(i int) {
+	s := *l.p
+	copy(s[i:], s[i+1:])
+	s[len(s)-1] = nil
+	*l.p = s[:len(s)-1]
+}
+func (l caseList) insert(i int, n Node) {
+	s := append(*l.p, nil)
+	copy(s[i+1:], s[i:])
+	s[i] = n.(*CaseClause)
+	*l.p = s
+}
+
+func asStmt(n Node) Stmt {
+	if n == nil {
+		return nil
+	}
+	if s, ok := n.(Stmt); ok {
+		return s
+	}
+	panic(fmt.Sprintf("ast.Rewrite: %T is not a statement", n))
+}
+
+func asExpr(n Node) Expr {
+	if n == nil {
+		return nil
+	}
+	if x, ok := n.(Expr); ok {
+		return x
+	}
+	panic(fmt.Sprintf("ast.Rewrite: %T is not an expression", n))
+}
+
+func asBlock(n Node) *BlockStmt {
+	if b, ok := n.(*BlockStmt); ok {
+		return b
+	}
+	panic(fmt.Sprintf("ast.Rewrite: %T is not a block", n))
+}
+
+type application struct {
+	pre, post ApplyFunc
+	cursor    Cursor
+	iter      iterator
+}
+
+// An iterator controls iteration over a slice of nodes.
+type iterator struct {
+	index, step int
+}
+
+func (a *application) apply(parent Node, name string, iter *iterator, n Node, set func(Node)) {
+	saved := a.cursor
+	a.cursor.parent = parent
+	a.cursor.name = name
+	a.cursor.iter = iter
+	a.cursor.set = set
+	a.cursor.node = n
+
+	if a.pre != nil && !a.pre(&a.cursor) {
+		a.cursor = saved
+		return
+	}
+
+	switch n := a.cursor.node.(type) {
+	case nil, *BadExpr, *Variable, *MacroExpr, *FuncIdent, *BasicLit, *KeywordLit:
+		// nothing to do
+
+	case *UnaryExpr:
+		a.apply(n, "X", nil, n.X, func(r Node) { n.X = asExpr(r) })
+
+	case *BinaryExpr:
+		a.apply(n, "X", nil, n.X, func(r Node) { n.X = asExpr(r) })
+		a.apply(n, "Y", nil, n.Y, func(r Node) { n.Y = asExpr(r) })
+
+	case *TernaryExpr:
+		a.apply(n, "Cond", nil, n.Cond, func(r Node) { n.Cond = asExpr(r) })
+		a.apply(n, "Then", nil, n.Then, func(r Node) { n.Then = asExpr(r) })
+		a.apply(n, "Else", nil, n.Else, func(r Node) { n.Else = asExpr(r) })
+
+	case *ParenExpr:
+		a.apply(n, "X", nil, n.X, func(r Node) { n.X = asExpr(r) })
+
+	case *IndexExpr:
+		a.apply(n, "X", nil, n.X, func(r Node) { n.X = asExpr(r) })
+		a.apply(n, "Index", nil, n.Index, func(r Node) { n.Index = asExpr(r) })
+
+	case *SelectorExpr:
+		if n.X != nil {
+			a.apply(n, "X", nil, n.X, func(r Node) { n.X = asExpr(r) })
+		}
+
+	case *CallExpr:
+		a.apply(n, "Fun", nil, n.Fun, func(r Node) { n.Fun = asExpr(r) })
+		a.applyList(n, "Args", exprList{&n.Args})
+
+	case *ArrayLit:
+		a.applyList(n, "Elts", exprList{&n.Elts})
+
+	case *RangeExpr:
+		a.apply(n, "From", nil, n.From, func(r Node) { n.From = asExpr(r) })
+		a.apply(n, "To", nil, n.To, func(r Node) { n.To = asExpr(r) })
+
+	case *BadStmt, *DirectiveStmt, *CommentStmt:
+		// nothing to do
+
+	case *ExprStmt:
+		a.apply(n, "X", nil, n.X, func(r Node) { n.X = asExpr(r) })
+
+	case *AssignStmt:
+		a.apply(n, "Lhs", nil, n.Lhs, func(r Node) { n.Lhs = asExpr(r) })
+		a.apply(n, "Rhs", nil, n.Rhs, func(r Node) { n.Rhs = asExpr(r) })
+
+	case *DeclStmt:
+		a.applyList(n, "Specs", specList{&n.Specs})
+
+	case *EnumStmt:
+		if n.Step != nil {
+			a.apply(n, "Step", nil, n.Step, func(r Node) { n.Step = asExpr(r) })
+		}
+		a.applyList(n, "Specs", specList{&n.Specs})
+
+	case *VarSpec:
+		a.apply(n, "Name", nil, n.Name, func(r Node) { n.Name = r.(*Variable) })
+		a.applyList(n, "Dims", exprList{&n.Dims})
+		if n.Value != nil {
+			a.apply(n, "Value", nil, n.Value, func(r Node) { n.Value = asExpr(r) })
+		}
+
+	case *ReDimStmt:
+		a.apply(n, "X", nil, n.X, func(r Node) { n.X = asExpr(r) })
+
+	case *BlockStmt:
+		a.applyList(n, "List", stmtList{&n.List})
+
+	case *IfStmt:
+		a.apply(n, "Cond", nil, n.Cond, func(r Node) { n.Cond = asExpr(r) })
+		a.apply(n, "Body", nil, n.Body, func(r Node) { n.Body = asBlock(r) })
+		if n.Else != nil {
+			a.apply(n, "Else", nil, n.Else, func(r Node) { n.Else = asStmt(r) })
+		}
+
+	case *WhileStmt:
+		a.apply(n, "Cond", nil, n.Cond, func(r Node) { n.Cond = asExpr(r) })
+		a.apply(n, "Body", nil, n.Body, func(r Node) { n.Body = asBlock(r) })
+
+	case *DoStmt:
+		a.apply(n, "Body", nil, n.Body, func(r Node) { n.Body = asBlock(r) })
+		a.apply(n, "Cond", nil, n.Cond, func(r Node) { n.Cond = asExpr(r) })
+
+	case *ForStmt:
+		a.apply(n, "Var", nil, n.Var, func(r Node) { n.Var = r.(*Variable) })
+		a.apply(n, "From", nil, n.From, func(r Node) { n.From = asExpr(r) })
+		a.apply(n, "To", nil, n.To, func(r Node) { n.To = asExpr(r) })
+		if n.Step != nil {
+			a.apply(n, "Step", nil, n.Step, func(r Node) { n.Step = asExpr(r) })
+		}
+		a.apply(n, "Body", nil, n.Body, func(r Node) { n.Body = asBlock(r) })
+
+	case *ForInStmt:
+		a.apply(n, "Var", nil, n.Var, func(r Node) { n.Var = r.(*Variable) })
+		a.apply(n, "X", nil, n.X, func(r Node) { n.X = asExpr(r) })
+		a.apply(n, "Body", nil, n.Body, func(r Node) { n.Body = asBlock(r) })
+
+	case *SelectStmt:
+		a.applyList(n, "Cases", caseList{&n.Cases})
+
+	case *SwitchStmt:
+		a.apply(n, "Tag", nil, n.Tag, func(r Node) { n.Tag = asExpr(r) })
+		a.applyList(n, "Cases", caseList{&n.Cases})
+
+	case *CaseClause:
+		a.applyList(n, "List", exprList{&n.List})
+		a.apply(n, "Body", nil, n.Body, func(r Node) { n.Body = asBlock(r) })
+
+	case *WithStmt:
+		a.apply(n, "X", nil, n.X, func(r Node) { n.X = asExpr(r) })
+		a.apply(n, "Body", nil, n.Body, func(r Node) { n.Body = asBlock(r) })
+
+	case *ReturnStmt:
+		if n.Result != nil {
+			a.apply(n, "Result", nil, n.Result, func(r Node) { n.Result = asExpr(r) })
+		}
+
+	case *ExitStmt:
+		if n.Code != nil {
+			a.apply(n, "Code", nil, n.Code, func(r Node) { n.Code = asExpr(r) })
+		}
+
+	case *BranchStmt:
+		if n.Level != nil {
+			a.apply(n, "Level", nil, n.Level, func(r Node) { n.Level = asExpr(r) })
+		}
+
+	case *FuncDecl:
+		a.apply(n, "Name", nil, n.Name, func(r Node) { n.Name = r.(*FuncIdent) })
+		a.applyList(n, "Params", paramList{&n.Params})
+		a.apply(n, "Body", nil, n.Body, func(r Node) { n.Body = asBlock(r) })
+
+	case *Param:
+		a.apply(n, "Name", nil, n.Name, func(r Node) { n.Name = r.(*Variable) })
+		if n.Default != nil {
+			a.apply(n, "Default", nil, n.Default, func(r Node) { n.Default = asExpr(r) })
+		}
+
+	case *Script:
+		a.applyList(n, "Stmts", stmtList{&n.Stmts})
+
+	default:
+		panic(fmt.Sprintf("ast.Rewrite: unexpected node type %T", n))
+	}
+
+	if a.post != nil && !a.post(&a.cursor) {
+		panic(abort)
+	}
+
+	a.cursor = saved
+}
+
+func (a *application) applyList(parent Node, name string, list nodeList) {
+	// avoid heap-allocating a new iterator for each applyList call; reuse a.iter instead
+	saved := a.iter
+	a.iter.index = 0
+	for {
+		// must reload list.len() on each iteration
+		// as the slice may have been changed by the previous iteration
+		if a.iter.index >= list.len() {
+			break
+		}
+		a.iter.step = 1
+		saveList := a.cursor.list
+		a.cursor.list = list
+		a.apply(parent, name, &a.iter, list.at(a.iter.index), nil)
+		a.cursor.list = saveList
+		a.iter.index += a.iter.step
+	}
+	a.iter = saved
+}
@@ -0,0 +1,213 @@
+// Adapted to this syntax tree from go/ast/walk.go of the Go distribution.
+//
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE.go-authors file.
+
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+func walkExprList(v Visitor, list []Expr) {
+	for _, x := range list {
+		Walk(v, x)
+	}
+}
+
+func walkStmtList(v Visitor, list []Stmt) {
+	for _, x := range list {
+		Walk(v, x)
+	}
+}
+
+// Walk traverses an AST in depth-first order, children are visited
+// in source order.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *BadExpr, *Variable, *MacroExpr, *FuncIdent, *BasicLit, *KeywordLit:
+		// nothing to do
+
+	case *UnaryExpr:
+		Walk(v, n.X)
+
+	case *BinaryExpr:
+		Walk(v, n.X)
+		Walk(v, n.Y)
+
+	case *TernaryExpr:
+		Walk(v, n.Cond)
+		Walk(v, n.Then)
+		Walk(v, n.Else)
+
+	case *ParenExpr:
+		Walk(v, n.X)
+
+	case *IndexExpr:
+		Walk(v, n.X)
+		Walk(v, n.Index)
+
+	case *SelectorExpr:
+		if n.X != nil {
+			Walk(v, n.X)
+		}
+
+	case *CallExpr:
+		Walk(v, n.Fun)
+		walkExprList(v, n.Args)
+
+	case *ArrayLit:
+		walkExprList(v, n.Elts)
+
+	case *RangeExpr:
+		Walk(v, n.From)
+		Walk(v, n.To)
+
+	case *BadStmt, *DirectiveStmt, *CommentStmt:
+		// nothing to do
+
+	case *ExprStmt:
+		Walk(v, n.X)
+
+	case *AssignStmt:
+		Walk(v, n.Lhs)
+		Walk(v, n.Rhs)
+
+	case *DeclStmt:
+		for _, s := range n.Specs {
+			Walk(v, s)
+		}
+
+	case *EnumStmt:
+		if n.Step != nil {
+			Walk(v, n.Step)
+		}
+		for _, s := range n.Specs {
+			Walk(v, s)
+		}
+
+	case *VarSpec:
+		Walk(v, n.Name)
+		walkExprList(v, n.Dims)
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+
+	case *ReDimStmt:
+		Walk(v, n.X)
+
+	case *BlockStmt:
+		walkStmtList(v, n.List)
+
+	case *IfStmt:
+		Walk(v, n.Cond)
+		Walk(v, n.Body)
+		if n.Else != nil {
+			Walk(v, n.Else)
+		}
+
+	case *WhileStmt:
+		Walk(v, n.Cond)
+		Walk(v, n.Body)
+
+	case *DoStmt:
+		Walk(v, n.Body)
+		Walk(v, n.Cond)
+
+	case *ForStmt:
+		Walk(v, n.Var)
+		Walk(v, n.From)
+		Walk(v, n.To)
+		if n.Step != nil {
+			Walk(v, n.Step)
+		}
+		Walk(v, n.Body)
+
+	case *ForInStmt:
+		Walk(v, n.Var)
+		Walk(v, n.X)
+		Walk(v, n.Body)
+
+	case *SelectStmt:
+		for _, c := range n.Cases {
+			Walk(v, c)
+		}
+
+	case *SwitchStmt:
+		Walk(v, n.Tag)
+		for _, c := range n.Cases {
+			Walk(v, c)
+		}
+
+	case *CaseClause:
+		walkExprList(v, n.List)
+		Walk(v, n.Body)
+
+	case *WithStmt:
+		Walk(v, n.X)
+		Walk(v, n.Body)
+
+	case *ReturnStmt:
+		if n.Result != nil {
+			Walk(v, n.Result)
+		}
+
+	case *ExitStmt:
+		if n.Code != nil {
+			Walk(v, n.Code)
+		}
+
+	case *BranchStmt:
+		if n.Level != nil {
+			Walk(v, n.Level)
+		}
+
+	case *FuncDecl:
+		Walk(v, n.Name)
+		for _, p := range n.Params {
+			Walk(v, p)
+		}
+		Walk(v, n.Body)
+
+	case *Param:
+		Walk(v, n.Name)
+		if n.Default != nil {
+			Walk(v, n.Default)
+		}
+
+	case *Script:
+		walkStmtList(v, n.Stmts)
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order: It starts by calling
+// f(node); node must not be nil. If f returns true, Inspect invokes f
+// recursively for each of the non-nil children of node, followed by a
+// call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -1,112 +1,84 @@
 package libautoit
 
 import (
-	"bytes"
+	"context"
+	"github.com/x0r19x91/libautoit/ast"
 	"github.com/x0r19x91/libautoit/lexer"
+	"github.com/x0r19x91/libautoit/parser"
+	"github.com/x0r19x91/libautoit/progress"
 	"strings"
 	"time"
 )
 
 type AutoItFile struct {
-	Resources []*AutoItResource
+	Archives  []*Archive        // in the order of their offsets
+	Resources []*AutoItResource // of all the archives
 	Version   AutoItVersion
+	Derived   []*AutoItResource // found inside the scripts, see ExtractPayloads
+	limits    Limits
+
+	// set by GetScriptsRecursive
+	Parent   *AutoItFile
+	Source   *AutoItResource // of Parent the file was found in
+	Children []*AutoItFile
+	Depth    int   // 0 for the top file
+	Err      error // of unpacking or decompressing, the tree is kept
 }
 
 func GetScripts(data []byte) (*AutoItFile, error) {
-	temp := make([]byte, len(data))
-	copy(temp, data)
-	var pos []int
-	for i := 0; i < 0x100; i++ {
-		for j, v := range temp {
-			data[j] = byte(i) ^ v
-		}
-
-		pos = []int{}
-		startPos := -1
-		for {
-			// newPos := bytes.Index(temp[startPos+1:], Au3Header)
-			// if newPos == -1 {
-			//     break
-			// }
-			newPos := -1
-			for _, hdr := range Au3Headers {
-				idx := bytes.Index(temp[startPos+1:], hdr)
-				if idx >= 0 {
-					newPos = idx
-					break
-				}
-			}
-			if newPos == -1 {
-				break
-			}
-			startPos += newPos + 1
-			pos = append(pos, startPos)
-		}
+	return getScripts(context.Background(), data, &Limits{})
+}
 
-		if len(pos) > 0 {
-			break
-		}
+func getScripts(ctx context.Context, data []byte, l *Limits) (*AutoItFile, error) {
+	hits, err := findSignatures(ctx, data)
+	if err != nil {
+		return nil, err
 	}
-
-	if len(pos) == 0 {
+	if len(hits) == 0 {
 		return nil, ErrScriptNotFound
 	}
-
-	startPos, endPos := 0, -1
-	possibleScripts := make(map[int]int)
-	var subtype string
-	for _, p := range pos {
-		startPos = p
-		subtype = string(data[p+0x10 : p+0x18])
-		if subtype[:4] != "AU3!" {
-			continue
-		}
-
-		stop := bytes.LastIndex(data[p+0x19:], []byte(subtype))
-		if stop == -1 {
-			stop = len(data)
-		} else {
-			stop += p + 0x19
-		}
-		endPos = stop
-		possibleScripts[p] = endPos
-	}
-
-	isLegacy := false
-	if endPos == -1 && startPos > 0 {
-		endPos = len(data) - 4
-		if _, ok := possibleScripts[startPos]; !ok {
-			possibleScripts[startPos] = endPos
-		}
-		isLegacy = true
-		subtype = "AU3!OLD"
-	}
-
-	if len(possibleScripts) == 0 || len(subtype) == 0 {
+	archives, spans := locateArchives(data, hits)
+	if len(archives) == 0 {
 		return nil, ErrScriptNotFound
 	}
 
-	file := new(AutoItFile)
-	if subtype == "AU3!EA06" {
-		file.Version = EA06
-	} else if subtype == "AU3!EA05" {
-		file.Version = EA05
-	} else {
-		file.Version = Legacy
-	}
-	for start, end := range possibleScripts {
-		script := data[start:end]
-		res, err := unpackResources(script, isLegacy, file.Version)
-		if err != nil {
-			return file, err
+	file := &AutoItFile{Archives: archives, Version: archives[0].Version}
+	// a decoy failing doesn't fail the file
+	var first error
+	found, clean := false, false
+	for i, a := range archives {
+		res, err := unpackResources(ctx, spans[i], a.Version == Legacy, a.Version, l)
+		for _, r := range res {
+			r.Archive = a
 		}
-
+		a.Resources, a.Err = res, err
 		file.Resources = append(file.Resources, res...)
+		if len(res) > 0 && !found {
+			file.Version, found = a.Version, true
+		}
+		if l.MaxResources > 0 && len(file.Resources) > l.MaxResources {
+			return file, ErrTooManyResources
+		}
+		if err != nil && (err == ErrTooManyResources || err == ctx.Err()) {
+			return file, err
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+		if err == nil && len(res) > 0 {
+			clean = true
+		}
+	}
+	if !clean {
+		return file, first
 	}
 	return file, nil
 }
 
-func unpackResources(script []byte, bLegacy bool, ver AutoItVersion) ([]*AutoItResource, error) {
+func unpackResources(ctx context.Context, script []byte, bLegacy bool, ver AutoItVersion, l *Limits) ([]*AutoItResource, error) {
+	if len(script) < 0x28 {
+		return nil, ErrOutOfBounds
+	}
 	var iKeys IKeySet
 	if ver == EA06 {
 		iKeys = NewEA06()
@@ -123,6 +95,9 @@ func unpackResources(script []byte, bLegacy bool, ver AutoItVersion) ([]*AutoItR
 	var isOldAutoIt bool
 	if ver == Legacy {
 		passLen := u32(script[0x11:0x15]) ^ 0xfac1
+		if int64(passLen) > int64(len(script)-0x15) {
+			return nil, ErrOutOfBounds
+		}
 		pass := iKeys.DecodeStream(script[0x15:0x15+passLen], iKeys.GetPassKey())
 		if !IsPrintable(pass) {
 			isOldAutoIt = true
@@ -136,6 +111,16 @@ func unpackResources(script []byte, bLegacy bool, ver AutoItVersion) ([]*AutoItR
 
 	var ans []*AutoItResource
 	for pos < len(script) {
+		if err := ctx.Err(); err != nil {
+			return ans, err
+		}
+		if l.MaxResources > 0 && len(ans) >= l.MaxResources {
+			return ans, ErrTooManyResources
+		}
+		progress.Report(ctx, progress.Event{Stage: progress.Decrypt, Done: pos, Total: len(script)})
+		if pos+4 > len(script) {
+			break
+		}
 		pFile := string(iKeys.DecodeStream(script[pos:pos+4], iKeys.GetFile()))
 		if pFile != "FILE" {
 			break
@@ -144,7 +129,7 @@ func unpackResources(script []byte, bLegacy bool, ver AutoItVersion) ([]*AutoItR
 		res := new(AutoItResource)
 		res.KeySet = iKeys
 
-		if pos >= len(script) {
+		if pos+4 > len(script) {
 			break
 		}
 		temp := int(u32(script[pos:pos+4])) ^ iKeys.GetTagSize().value
@@ -153,10 +138,13 @@ func unpackResources(script []byte, bLegacy bool, ver AutoItVersion) ([]*AutoItR
 		if iKeys.NeedsUnicode() {
 			tagLen += temp
 		}
+		if tagLen < 0 || pos+tagLen > len(script) {
+			return ans, ErrOutOfBounds
+		}
 		res.Tag = iKeys.DecodeString(script[pos:pos+tagLen], iKeys.GetTag())
 		pos += tagLen
 
-		if pos >= len(script) {
+		if pos+4 > len(script) {
 			break
 		}
 		temp = int(u32(script[pos:pos+4])) ^ iKeys.GetPathSize().value
@@ -165,13 +153,24 @@ func unpackResources(script []byte, bLegacy bool, ver AutoItVersion) ([]*AutoItR
 		if iKeys.NeedsUnicode() {
 			pathLen += temp
 		}
+		if pathLen < 0 || pos+pathLen+1 > len(script) {
+			return ans, ErrOutOfBounds
+		}
 		res.Path = iKeys.DecodeString(script[pos:pos+pathLen], iKeys.GetPath())
 		pos += pathLen
 
 		res.IsCompressed = script[pos] != 0
 		pos++
 
-		if pos >= len(script) {
+		// sizes, checksum and times
+		need := 8
+		if !bLegacy {
+			need += 4
+		}
+		if !isOldAutoIt {
+			need += 16
+		}
+		if pos+need > len(script) {
 			break
 		}
 		temp = int(u32(script[pos:pos+4])) ^ iKeys.GetCompressedSize().value
@@ -181,9 +180,6 @@ func unpackResources(script []byte, bLegacy bool, ver AutoItVersion) ([]*AutoItR
 			return nil, ErrInvalidCompressedSize
 		}
 
-		if pos >= len(script) {
-			break
-		}
 		temp = int(u32(script[pos:pos+4])) ^ iKeys.GetDecompressedSize().value
 		pos += 4
 		res.DecompressedSize = uint32(temp)
@@ -209,6 +205,9 @@ func unpackResources(script []byte, bLegacy bool, ver AutoItVersion) ([]*AutoItR
 			pos += 8
 		}
 
+		if pos+int(res.CompressedSize) > len(script) {
+			return ans, ErrInvalidCompressedSize
+		}
 		if res.CompressedSize > 0 {
 			data := iKeys.DecodeStream(script[pos:pos+int(res.CompressedSize)], iKeys.GetData())
 			res.Data = data
@@ -219,6 +218,7 @@ func unpackResources(script []byte, bLegacy bool, ver AutoItVersion) ([]*AutoItR
 		res.State = Au3Initialized
 		ans = append(ans, res)
 	}
+	progress.Report(ctx, progress.Event{Stage: progress.Decrypt, Done: len(script), Total: len(script)})
 	return ans, nil
 }
 
@@ -232,6 +232,11 @@ func (r *AutoItResource) IsAutoItScript(accuracy int) bool {
 	if lex == nil {
 		return false
 	}
+	return validTokens(lex, accuracy)
+}
+
+// validTokens tells whether the first tokens of lex are valid
+func validTokens(lex lexer.ITokenizer, accuracy int) bool {
 	for {
 		if accuracy == 0 {
 			break
@@ -249,13 +254,54 @@ func (r *AutoItResource) IsAutoItScript(accuracy int) bool {
 }
 
 func (r *AutoItResource) Decompress() bool {
+	return r.DecompressContext(context.Background(), 0) == nil
+}
+
+// DecompressContext is Decompress, stopping when ctx is done and failing
+// with ErrResourceTooLarge, before allocating, when the resource is
+// larger than maxSize. maxSize <= 0 is no limit.
+func (r *AutoItResource) DecompressContext(ctx context.Context, maxSize int64) error {
+	if maxSize > 0 && int64(r.DecompressedSize) > maxSize {
+		return ErrResourceTooLarge
+	}
 	if r.IsCompressed {
-		buf, err := r.Decompressor.Decompress()
-		if err != nil || (len(r.Data) > 0 && len(buf) == 0) {
-			return false
+		if fn := progress.FromContext(ctx); fn != nil {
+			// the decompressor's own callback still runs and comes back
+			var prev func(done, tot int)
+			if c, ok := r.Decompressor.(callbacker); ok {
+				prev = c.Callback()
+			}
+			name := r.Name()
+			r.Decompressor.SetCallback(func(done, tot int) {
+				if prev != nil {
+					prev(done, tot)
+				}
+				fn(progress.Event{Stage: progress.Decompress, Name: name, Done: done, Total: tot})
+			})
+			defer func() {
+				if prev == nil {
+					prev = func(done, tot int) {}
+				}
+				r.Decompressor.SetCallback(prev)
+			}()
+		}
+		max := int(maxSize)
+		if int64(max) != maxSize {
+			max = int(^uint(0) >> 1)
+		}
+		buf, err := r.Decompressor.DecompressContext(ctx, max)
+		if err != nil {
+			return err
+		}
+		if len(r.Data) > 0 && len(buf) == 0 {
+			return ErrDecompressFailed
 		}
 		r.State = Au3Decompressed
 		r.Data = buf
+	} else if maxSize > 0 && int64(len(r.Data)) > maxSize {
+		return ErrResourceTooLarge
+	} else {
+		progress.Report(ctx, progress.Event{Stage: progress.Decompress, Name: r.Name(), Done: len(r.Data), Total: len(r.Data)})
 	}
 	if !IsPrintable(r.Data) {
 		// see if utf16
@@ -264,7 +310,7 @@ func (r *AutoItResource) Decompress() bool {
 			r.Data = uBuf
 		}
 	}
-	return true
+	return nil
 }
 
 func (r *AutoItResource) CreateTokenizer() lexer.ITokenizer {
@@ -274,3 +320,48 @@ func (r *AutoItResource) CreateTokenizer() lexer.ITokenizer {
 		return lexer.NewLexer(r.Data)
 	}
 }
+
+// CreateTokenizerContext is CreateTokenizer, reporting the lines read to
+// the progress.Func of ctx.
+func (r *AutoItResource) CreateTokenizerContext(ctx context.Context) lexer.ITokenizer {
+	lex := r.CreateTokenizer()
+	if fn := progress.FromContext(ctx); fn != nil {
+		return &reportingTokenizer{ITokenizer: lex, name: r.Name(), fn: fn}
+	}
+	return lex
+}
+
+type reportingTokenizer struct {
+	lexer.ITokenizer
+	name string
+	fn   progress.Func
+	line int
+	eof  bool
+}
+
+func (t *reportingTokenizer) NextToken() *lexer.Token {
+	tok := t.ITokenizer.NextToken()
+	switch {
+	case tok.TokType == lexer.EOL:
+		t.line++
+		t.fn(progress.Event{Stage: progress.Tokenize, Name: t.name, Done: t.line, Total: t.NumberOfLines()})
+	case tok.TokType == lexer.EOF && !t.eof:
+		t.eof = true
+		t.fn(progress.Event{Stage: progress.Tokenize, Name: t.name, Done: t.line, Total: t.line})
+	}
+	return tok
+}
+
+// Parse builds the syntax tree of a decompressed script resource.
+func (r *AutoItResource) Parse() (*ast.Script, error) {
+	return parser.ParseScript(r.sourceTokenizer())
+}
+
+// sourceTokenizer is CreateTokenizer, text read the way the tree parser
+// does
+func (r *AutoItResource) sourceTokenizer() lexer.ITokenizer {
+	if IsPrintable(r.Data) {
+		return parser.NewSourceTokenizer(r.Data)
+	}
+	return lexer.NewLexer(r.Data)
+}
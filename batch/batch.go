@@ -0,0 +1,238 @@
+package batch
+
+// Concurrent scanning of many samples.
+// Samples come from files, gzipped or not, directory trees and the members
+// of zip and tar archives. Each one is unpacked, decompressed and tidied by
+// a pool of workers, and a Result is handed back for every sample, failures
+// included, in the order they finish.
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/x0r19x91/libautoit"
+	"github.com/x0r19x91/libautoit/progress"
+	"github.com/x0r19x91/libautoit/tidy"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+var ErrTimeout = errors.New("timed out")
+
+type Options struct {
+	Workers int               // runtime.NumCPU() when 0
+	Timeout time.Duration     // per sample, none when 0
+	MaxSize int64             // larger samples are reported and skipped, none when 0
+	Source  bool              // include the tidied source of the scripts
+	Limits  *libautoit.Limits // DefaultLimits when nil
+	// Tidy returns the cleaned source of a script, tidy's usual settings
+	// when nil. It should stop with the error of ctx when ctx is done, the
+	// worker waits for it.
+	Tidy func(ctx context.Context, r *libautoit.AutoItResource) (string, error)
+}
+
+type Resource struct {
+	Name       string `json:"name"`
+	Path       string `json:"path"`
+	Compressed bool   `json:"compressed"`
+	Size       int    `json:"size"`
+	SHA256     string `json:"sha256"`
+	Script     bool   `json:"script"`
+	Lines      int    `json:"lines,omitempty"` // of the tidied script
+	Source     string `json:"source,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type Result struct {
+	Name      string      `json:"name"` // path, members of archives as archive!member
+	Size      int64       `json:"size"`
+	SHA256    string      `json:"sha256,omitempty"`
+	Version   string      `json:"version,omitempty"`
+	Resources []*Resource `json:"resources"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// JSONL returns a callback for Scan writing one result per line.
+func JSONL(w io.Writer) func(*Result) error {
+	enc := json.NewEncoder(w)
+	return func(r *Result) error {
+		return enc.Encode(r)
+	}
+}
+
+func tidyContext(ctx context.Context, r *libautoit.AutoItResource) (string, error) {
+	ti := tidy.NewTidyInfo(r.CreateTokenizer())
+	ti.SetFuncComments(true)
+	ti.SetIdentifierCase(tidy.AutoDetect)
+	ti.SetIndentSpaces(4)
+	ti.SetMaxStringLiteralSize(160)
+	ti.SetUseExtraNewline(true)
+	ti.SetUseTabs(false)
+	return ti.TidyContext(ctx)
+}
+
+func sha(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// Scan scans the files and the directories below paths, calling fn for
+// every sample from the calling goroutine. A sample that fails or panics
+// only fails its own result. Scan stops early when fn returns an error,
+// which it returns.
+func Scan(paths []string, opts Options, fn func(*Result) error) error {
+	return ScanContext(context.Background(), paths, opts, fn)
+}
+
+// ScanContext is Scan, stopping with the error of ctx when it is done.
+// The progress.Func of ctx is called by one worker at a time, the events
+// of the samples interleaved, and gets a progress.Done event named after
+// each sample.
+func ScanContext(ctx context.Context, paths []string, opts Options, fn func(*Result) error) error {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if fn := progress.FromContext(ctx); fn != nil {
+		// the workers report concurrently
+		var mu sync.Mutex
+		ctx = progress.WithFunc(ctx, func(ev progress.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			fn(ev)
+		})
+	}
+	jobs := make(chan *sample)
+	results := make(chan *Result)
+	go func() {
+		defer close(jobs)
+		for _, p := range paths {
+			if !walk(p, opts.MaxSize, func(s *sample) bool {
+				select {
+				case jobs <- s:
+					return true
+				case <-ctx.Done():
+					return false
+				}
+			}) {
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range jobs {
+				select {
+				case results <- run(ctx, s, &opts):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	var err error
+	for r := range results {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		if err = fn(r); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	// let the producer and the workers see the end
+	cancel()
+	for range results {
+	}
+	return err
+}
+
+// run scans a sample within the timeout, in the goroutine of the worker
+// so that no more than Workers samples are decoded at once.
+func run(ctx context.Context, s *sample, opts *Options) *Result {
+	if s.err != nil {
+		return &Result{Name: s.name, Size: s.size, Resources: []*Resource{}, Error: s.err.Error()}
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	// the sample is the pipeline, with a single Done
+	ctx = progress.Own(ctx)
+	r := process(ctx, s, opts)
+	if ctx.Err() == context.DeadlineExceeded && opts.Timeout > 0 {
+		r.Error = fmt.Sprintf("%v after %v", ErrTimeout, opts.Timeout)
+	} else if err := ctx.Err(); err != nil {
+		r.Error = err.Error()
+	}
+	progress.Finish(ctx, s.name)
+	return r
+}
+
+// process unpacks, decompresses and tidies a sample
+func process(ctx context.Context, s *sample, opts *Options) (res *Result) {
+	res = &Result{Name: s.name, Size: s.size, SHA256: sha(s.data), Resources: []*Resource{}}
+	defer func() {
+		if e := recover(); e != nil {
+			res.Error = fmt.Sprintf("panic: %v", e)
+		}
+	}()
+	limits := libautoit.DefaultLimits
+	if opts.Limits != nil {
+		limits = *opts.Limits
+	}
+	file, err := libautoit.GetScriptsContext(ctx, s.data, limits)
+	if err != nil {
+		res.Error = err.Error()
+		return
+	}
+	res.Version = file.Version.String()
+	if err := file.DecompressContext(ctx); err != nil {
+		res.Error = err.Error()
+	}
+	for _, r := range file.Resources {
+		rr := &Resource{Name: r.Name(), Path: r.Path, Compressed: r.IsCompressed}
+		res.Resources = append(res.Resources, rr)
+		if r.IsCompressed && r.State == libautoit.Au3Initialized {
+			rr.Error = libautoit.ErrDecompressFailed.Error()
+			continue
+		}
+		rr.Size, rr.SHA256 = len(r.Data), sha(r.Data)
+		if rr.Script = r.IsAutoItScript(500); !rr.Script {
+			continue
+		}
+		r.Data = bytes.Replace(r.Data, []byte{13, 10}, []byte{10}, -1)
+		tidyFn := opts.Tidy
+		if tidyFn == nil {
+			tidyFn = tidyContext
+		}
+		src, err := tidyFn(ctx, r)
+		if err != nil {
+			res.Error = err.Error()
+			return
+		}
+		rr.Lines = bytes.Count([]byte(src), []byte{10})
+		if opts.Source {
+			rr.Source = src
+		}
+	}
+	return
+}
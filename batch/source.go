@@ -0,0 +1,150 @@
+package batch
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// sample is a file to scan, err set when it couldn't be read
+type sample struct {
+	name string
+	size int64
+	data []byte
+	err  error
+}
+
+func tooLarge(size, max int64) error {
+	return fmt.Errorf("%d bytes, larger than %d", size, max)
+}
+
+// readAll reads at most max bytes, archives may lie about sizes
+func readAll(r io.Reader, max int64) ([]byte, error) {
+	if max <= 0 {
+		return ioutil.ReadAll(r)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err == nil && int64(len(data)) > max {
+		err = fmt.Errorf("larger than %d bytes", max)
+	}
+	return data, err
+}
+
+// walk emits the samples below root until emit returns false
+func walk(root string, max int64, emit func(*sample) bool) bool {
+	ok := true
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			ok = emit(&sample{name: path, err: err})
+		} else if info.Mode().IsRegular() {
+			ok = file(path, info.Size(), max, emit)
+		}
+		if !ok {
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil && err != io.EOF {
+		ok = emit(&sample{name: root, err: err})
+	}
+	return ok
+}
+
+// file emits a file, or the members when it is an archive
+func file(path string, size, max int64, emit func(*sample) bool) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return emit(&sample{name: path, size: size, err: err})
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return emit(&sample{name: path, size: size, err: err})
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")) || bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return zipMembers(path, f, size, max, emit)
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return emit(&sample{name: path, size: size, err: err})
+		}
+		// a tarball, or a single sample gzipped
+		br := bufio.NewReaderSize(gz, 512)
+		if inner, _ := br.Peek(512); isTar(inner) {
+			return tarMembers(path, br, max, emit)
+		}
+		data, err := readAll(br, max)
+		return emit(&sample{name: path, size: int64(len(data)), data: data, err: err})
+	case isTar(head):
+		return tarMembers(path, f, max, emit)
+	}
+	if max > 0 && size > max {
+		return emit(&sample{name: path, size: size, err: tooLarge(size, max)})
+	}
+	data, err := readAll(f, max)
+	return emit(&sample{name: path, size: size, data: data, err: err})
+}
+
+func isTar(head []byte) bool {
+	return len(head) > 262 && string(head[257:262]) == "ustar"
+}
+
+func zipMembers(path string, f *os.File, size, max int64, emit func(*sample) bool) bool {
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		return emit(&sample{name: path, size: size, err: err})
+	}
+	for _, m := range zr.File {
+		if m.FileInfo().IsDir() {
+			continue
+		}
+		s := &sample{name: path + "!" + m.Name, size: int64(m.UncompressedSize64)}
+		if max > 0 && s.size > max {
+			s.err = tooLarge(s.size, max)
+		} else if rc, err := m.Open(); err != nil {
+			s.err = err
+		} else {
+			s.data, s.err = readAll(rc, max)
+			rc.Close()
+		}
+		if !emit(s) {
+			return false
+		}
+	}
+	return true
+}
+
+func tarMembers(path string, r io.Reader, max int64, emit func(*sample) bool) bool {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			return emit(&sample{name: path, err: err})
+		}
+		if h.Typeflag != tar.TypeReg && h.Typeflag != tar.TypeRegA {
+			continue
+		}
+		s := &sample{name: path + "!" + h.Name, size: h.Size}
+		if max > 0 && h.Size > max {
+			s.err = tooLarge(h.Size, max)
+		} else {
+			s.data, s.err = readAll(tr, max)
+		}
+		if !emit(s) {
+			return false
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package libautoit
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+)
+
+// bitReader reads the bit stream of the EA05, EA06 and legacy formats,
+// big endian 16 bit words read most significant bit first. Up to 64 bits
+// are buffered so most reads are a shift. Past the end of the input it
+// reads zeros, see overrun.
+type bitReader struct {
+	src []byte        // input, when in is nil
+	in  io.ByteReader // streamed input
+	pos int           // bytes taken, zeros past the end included
+	end int           // length of the input, -1 until in ends
+	buf uint64        // left aligned
+	n   uint          // bits in buf
+}
+
+func newBitReader(src []byte) *bitReader {
+	return &bitReader{src: src, end: len(src) &^ 1}
+}
+
+func newStreamBitReader(in io.ByteReader) *bitReader {
+	return &bitReader{in: in, end: -1}
+}
+
+func (b *bitReader) fill() {
+	if b.in == nil && b.pos+8 <= b.end {
+		b.buf |= binary.BigEndian.Uint64(b.src[b.pos:]) >> b.n
+		k := (63 - b.n) >> 3
+		b.pos += int(k)
+		b.n += k << 3
+		return
+	}
+	if b.in == nil {
+		// past end come zeros, overrun tells
+		for b.n <= 56 {
+			if b.pos < b.end {
+				b.buf |= uint64(b.src[b.pos]) << (56 - b.n)
+			}
+			b.pos++
+			b.n += 8
+		}
+		return
+	}
+	for b.n <= 48 {
+		var w uint64
+		if b.end < 0 {
+			hi, err := b.in.ReadByte()
+			var lo byte
+			if err == nil {
+				lo, err = b.in.ReadByte()
+			}
+			if err != nil {
+				b.end = b.pos
+			} else {
+				w = uint64(hi)<<8 | uint64(lo)
+			}
+		}
+		b.buf |= w << (48 - b.n)
+		b.pos += 2
+		b.n += 16
+	}
+}
+
+// bits reads up to 32 bits
+func (b *bitReader) bits(n uint) uint32 {
+	if b.n < n {
+		b.fill()
+	}
+	v := uint32(b.buf >> (64 - n))
+	b.buf <<= n
+	b.n -= n
+	return v
+}
+
+// overrun tells whether more bits were read than the input has
+func (b *bitReader) overrun() bool {
+	return b.end >= 0 && b.pos*8-int(b.n) > b.end*8
+}
+
+// length is the length of an EA05 or EA06 match
+func (b *bitReader) length() int {
+	var ans uint32
+	n := b.bits(2)
+	if n == 3 {
+		ans = 3
+		n = b.bits(3)
+		if n == 7 {
+			ans = 10
+			n = b.bits(5)
+			if n == 0x1f {
+				ans = 0x29
+				for {
+					n = b.bits(8)
+					if n != 0xff || b.overrun() {
+						break
+					}
+					ans += 0xff
+				}
+			}
+		}
+	}
+	return int(ans + n + 3)
+}
+
+// copyMatch copies n bytes from dist back, the source may overlap the
+// destination
+func copyMatch(out []byte, pos, dist, n int) {
+	if dist == 0 {
+		return // copies the zeros onto themselves
+	}
+	for i := 0; i < n; {
+		i += copy(out[pos+i:pos+n], out[pos-dist:pos+i])
+	}
+}
+
+const pageSize = 4096
+
+// pager reports every page and checks ctx
+type pager struct {
+	ctx      context.Context
+	callback func(done, tot int)
+	next     int
+	reported int
+}
+
+func (p *pager) page(pos, size int) error {
+	if pos < p.next {
+		return nil
+	}
+	p.next = pos - pos%pageSize + pageSize
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	p.callback(pos, size)
+	p.reported = pos
+	return nil
+}
+
+// done reports the end unless the last page did
+func (p *pager) done(pos, size int) {
+	if p.reported != pos || pos == 0 {
+		p.callback(pos, size)
+	}
+}
+
+// eaDecode decodes EA05 and EA06 data, after the header, into out.
+// A literal starts with the bit literal.
+func eaDecode(ctx context.Context, src, out []byte, literal uint32, callback func(done, tot int)) error {
+	b := newBitReader(src)
+	p := &pager{ctx: ctx, callback: callback, next: pageSize}
+	size := len(out)
+	pos := 0
+	for pos < size {
+		if b.bits(1) == literal {
+			out[pos] = byte(b.bits(8))
+			pos++
+		} else {
+			dist := int(b.bits(15))
+			n := b.length()
+			if dist > pos || n > size-pos {
+				return ErrDecompressFailed
+			}
+			copyMatch(out, pos, dist, n)
+			pos += n
+		}
+		if err := p.page(pos, size); err != nil {
+			return err
+		}
+	}
+	if b.overrun() {
+		return ErrOutOfBounds
+	}
+	p.done(pos, size)
+	return nil
+}
+
+// legacyDecode decodes the old legacy format, header included, into out
+func legacyDecode(ctx context.Context, src, out []byte, callback func(done, tot int)) error {
+	b := newBitReader(src)
+	b.bits(32)
+	b.bits(32) // the size, unused
+	p := &pager{ctx: ctx, callback: callback, next: pageSize}
+	size := len(out)
+	pos := 0
+	for pos < size {
+		if b.bits(1) == 0 {
+			out[pos] = byte(b.bits(8))
+			pos++
+		} else {
+			dist := 3 + int(b.bits(13))
+			n := 3 + int(b.bits(4))
+			if pos+n >= size || dist > pos {
+				return ErrDecompressFailed
+			}
+			copyMatch(out, pos, dist, n)
+			pos += n
+		}
+		if b.overrun() {
+			return ErrOutOfBounds
+		}
+		if err := p.page(pos, size); err != nil {
+			return err
+		}
+	}
+	p.done(pos, size)
+	return nil
+}
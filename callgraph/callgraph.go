@@ -0,0 +1,328 @@
+package callgraph
+
+// Call graph of a parsed script.
+// Nodes are the user defined functions, the builtins they call and a
+// root node standing for the top level code. Functions named by a
+// constant string given to Call or to a callback registering builtin
+// are linked too.
+
+import (
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/lexer"
+	"sort"
+	"strings"
+)
+
+// MainName is the name of the node holding the top level code.
+const MainName = "<main>"
+
+type NodeKind int
+
+const (
+	Main NodeKind = iota
+	UserFunc
+	Builtin
+	Undefined // called but not declared in the script
+)
+
+var nodeKinds = map[NodeKind]string{
+	Main:      "main",
+	UserFunc:  "func",
+	Builtin:   "builtin",
+	Undefined: "undefined",
+}
+
+func (k NodeKind) String() string {
+	return nodeKinds[k]
+}
+
+type EdgeKind int
+
+const (
+	Direct   EdgeKind = iota // Func(...)
+	Dynamic                  // Call("Func", ...)
+	Callback                 // AdlibRegister("Func"), HotKeySet("x", "Func"), ...
+	Ref                      // function used as a value
+)
+
+var edgeKinds = map[EdgeKind]string{
+	Direct:   "direct",
+	Dynamic:  "dynamic",
+	Callback: "callback",
+	Ref:      "ref",
+}
+
+func (k EdgeKind) String() string {
+	return edgeKinds[k]
+}
+
+// Callbacks maps builtins taking a function name to the index of that
+// argument.
+var Callbacks = map[string]int{
+	"adlibregister":          0,
+	"adlibunregister":        0,
+	"dllcallbackregister":    0,
+	"guictrlsetonevent":      1,
+	"guiregistermsg":         1,
+	"guisetonevent":          1,
+	"hotkeyset":              1,
+	"onautoitexitregister":   0,
+	"onautoitexitunregister": 0,
+	"trayitemsetonevent":     1,
+	"traysetonevent":         1,
+}
+
+// EventPrefixes maps builtins taking the prefix of handler names to the
+// index of that argument. Every function starting with it is linked.
+var EventPrefixes = map[string]int{
+	"objevent": 1,
+}
+
+// Sensitive lists the builtins highlighted in DOT output.
+var Sensitive = []string{
+	"DllCall", "DllCallAddress", "InetGet", "InetRead", "Run", "RunWait",
+	"ShellExecute", "ShellExecuteWait", "RegWrite", "RegDelete",
+	"FileInstall", "FileDelete", "FileWrite", "ProcessClose",
+	"TCPConnect", "TCPSend", "UDPSend",
+}
+
+type Node struct {
+	Name string
+	Kind NodeKind
+	Decl *ast.FuncDecl // nil unless Kind is UserFunc
+	Out  []*Edge
+	In   []*Edge
+}
+
+type Edge struct {
+	From  *Node
+	To    *Node
+	Kind  EdgeKind
+	Sites []ast.Pos // every place the call appears
+}
+
+type Graph struct {
+	Root  *Node
+	nodes map[string]*Node
+	order []*Node
+}
+
+// Build extracts the call graph of a script.
+func Build(script *ast.Script) *Graph {
+	g := &Graph{nodes: make(map[string]*Node)}
+	g.Root = g.add(MainName, Main)
+	for _, fn := range script.Funcs() {
+		n := g.Node(fn.Name.Name)
+		if n == nil {
+			n = g.add(fn.Name.Name, UserFunc)
+			n.Decl = fn
+		}
+	}
+	for _, s := range script.Stmts {
+		if fn, ok := s.(*ast.FuncDecl); ok {
+			if n := g.Node(fn.Name.Name); n.Decl == fn {
+				g.scan(n, fn.Body)
+			}
+			continue
+		}
+		g.scan(g.Root, s)
+	}
+	return g
+}
+
+func (g *Graph) add(name string, kind NodeKind) *Node {
+	n := &Node{Name: name, Kind: kind}
+	g.nodes[strings.ToLower(name)] = n
+	g.order = append(g.order, n)
+	return n
+}
+
+// Node finds a node by name, case insensitively.
+func (g *Graph) Node(name string) *Node {
+	return g.nodes[strings.ToLower(name)]
+}
+
+// Nodes returns all nodes: the root, user functions in source order,
+// then builtins and undefined functions in the order first called.
+func (g *Graph) Nodes() []*Node {
+	ans := make([]*Node, len(g.order))
+	copy(ans, g.order)
+	sort.SliceStable(ans, func(i, j int) bool {
+		return ans[i].Kind < ans[j].Kind
+	})
+	return ans
+}
+
+// Edges returns all edges, grouped by caller.
+func (g *Graph) Edges() []*Edge {
+	var ans []*Edge
+	for _, n := range g.Nodes() {
+		ans = append(ans, n.Out...)
+	}
+	return ans
+}
+
+func (g *Graph) link(from *Node, name string, builtin bool, kind EdgeKind, pos ast.Pos) {
+	to := g.Node(name)
+	if to == nil {
+		if builtin {
+			to = g.add(name, Builtin)
+		} else {
+			to = g.add(name, Undefined)
+		}
+	}
+	for _, e := range from.Out {
+		if e.To == to && e.Kind == kind {
+			e.Sites = append(e.Sites, pos)
+			return
+		}
+	}
+	e := &Edge{From: from, To: to, Kind: kind, Sites: []ast.Pos{pos}}
+	from.Out = append(from.Out, e)
+	to.In = append(to.In, e)
+}
+
+func (g *Graph) scan(from *Node, root ast.Node) {
+	ast.Inspect(root, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			id, ok := n.Fun.(*ast.FuncIdent)
+			if !ok {
+				return true
+			}
+			g.link(from, id.Name, id.Builtin, Direct, id.Pos())
+			if id.Builtin {
+				lower := strings.ToLower(id.Name)
+				if lower == "call" {
+					g.linkName(from, n.Args, 0, Dynamic)
+				} else if idx, ok := Callbacks[lower]; ok {
+					g.linkName(from, n.Args, idx, Callback)
+				} else if idx, ok := EventPrefixes[lower]; ok {
+					g.linkPrefix(from, n.Args, idx)
+				}
+			}
+			for _, arg := range n.Args {
+				g.scan(from, arg)
+			}
+			return false
+		case *ast.FuncIdent:
+			// not called, so a function reference
+			g.link(from, n.Name, n.Builtin, Ref, n.Pos())
+		}
+		return true
+	})
+}
+
+// linkName links the function named by a constant string argument
+func (g *Graph) linkName(from *Node, args []ast.Expr, idx int, kind EdgeKind) {
+	if idx >= len(args) {
+		return
+	}
+	name, ok := ast.StringValue(args[idx])
+	if !ok || name == "" {
+		return
+	}
+	if g.Node(name) == nil {
+		if std, ok := builtinName(name); ok {
+			g.link(from, std, true, kind, args[idx].Pos())
+			return
+		}
+	}
+	g.link(from, name, false, kind, args[idx].Pos())
+}
+
+// linkPrefix links the functions whose name starts with a constant
+// string argument, ObjEvent($o, "IE_") calling IE_OnQuit and the like
+func (g *Graph) linkPrefix(from *Node, args []ast.Expr, idx int) {
+	if idx >= len(args) {
+		return
+	}
+	prefix, ok := ast.StringValue(args[idx])
+	if !ok || prefix == "" {
+		return
+	}
+	prefix = strings.ToLower(prefix)
+	for _, n := range g.order {
+		if n.Kind == UserFunc && strings.HasPrefix(strings.ToLower(n.Name), prefix) {
+			g.link(from, n.Name, false, Callback, args[idx].Pos())
+		}
+	}
+}
+
+func builtinName(name string) (string, bool) {
+	for _, std := range lexer.Au3StdFunctions {
+		if strings.EqualFold(std, name) {
+			return std, true
+		}
+	}
+	return "", false
+}
+
+// Reachable returns the nodes reachable from n, n excluded, in breadth
+// first order.
+func (g *Graph) Reachable(n *Node) []*Node {
+	seen := map[*Node]bool{n: true}
+	queue := []*Node{n}
+	var ans []*Node
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, e := range cur.Out {
+			if !seen[e.To] {
+				seen[e.To] = true
+				ans = append(ans, e.To)
+				queue = append(queue, e.To)
+			}
+		}
+	}
+	return ans
+}
+
+// Unreachable returns the user functions not reachable from the top
+// level code.
+func (g *Graph) Unreachable() []*Node {
+	seen := make(map[*Node]bool)
+	for _, n := range g.Reachable(g.Root) {
+		seen[n] = true
+	}
+	var ans []*Node
+	for _, n := range g.Nodes() {
+		if n.Kind == UserFunc && !seen[n] {
+			ans = append(ans, n)
+		}
+	}
+	return ans
+}
+
+// Path returns a shortest call chain from one node to another, nil if
+// there is none.
+func (g *Graph) Path(from, to *Node) []*Node {
+	if from == nil || to == nil {
+		return nil
+	}
+	prev := map[*Node]*Node{from: nil}
+	queue := []*Node{from}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if cur == to {
+			var ans []*Node
+			for n := to; n != nil; n = prev[n] {
+				ans = append([]*Node{n}, ans...)
+			}
+			return ans
+		}
+		for _, e := range cur.Out {
+			if _, ok := prev[e.To]; !ok {
+				prev[e.To] = cur
+				queue = append(queue, e.To)
+			}
+		}
+	}
+	return nil
+}
+
+// Reaches reports whether the top level code can end up calling name.
+func (g *Graph) Reaches(name string) bool {
+	return g.Path(g.Root, g.Node(name)) != nil
+}
@@ -0,0 +1,132 @@
+package callgraph
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type jsonNode struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Line      int    `json:"line,omitempty"`
+	Reachable bool   `json:"reachable"`
+	Sensitive bool   `json:"sensitive,omitempty"`
+}
+
+type jsonEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Kind  string `json:"kind"`
+	Lines []int  `json:"lines"`
+}
+
+type jsonGraph struct {
+	Nodes []jsonNode `json:"nodes"`
+	Edges []jsonEdge `json:"edges"`
+}
+
+func isSensitive(n *Node) bool {
+	if n.Kind != Builtin {
+		return false
+	}
+	for _, s := range Sensitive {
+		if strings.EqualFold(s, n.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Graph) reachableSet() map[*Node]bool {
+	ans := map[*Node]bool{g.Root: true}
+	for _, n := range g.Reachable(g.Root) {
+		ans[n] = true
+	}
+	return ans
+}
+
+func (g *Graph) toJSON() jsonGraph {
+	reach := g.reachableSet()
+	out := jsonGraph{Nodes: []jsonNode{}, Edges: []jsonEdge{}}
+	for _, n := range g.Nodes() {
+		jn := jsonNode{
+			Name:      n.Name,
+			Kind:      n.Kind.String(),
+			Reachable: reach[n],
+			Sensitive: isSensitive(n),
+		}
+		if n.Decl != nil {
+			jn.Line = n.Decl.Pos().Line
+		}
+		out.Nodes = append(out.Nodes, jn)
+	}
+	for _, e := range g.Edges() {
+		je := jsonEdge{From: e.From.Name, To: e.To.Name, Kind: e.Kind.String()}
+		for _, pos := range e.Sites {
+			je.Lines = append(je.Lines, pos.Line)
+		}
+		out.Edges = append(out.Edges, je)
+	}
+	return out
+}
+
+func (g *Graph) MarshalJSON() ([]byte, error) {
+	return json.Marshal(g.toJSON())
+}
+
+// WriteJSON writes the graph as indented JSON.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g.toJSON())
+}
+
+// WriteDOT writes the graph in Graphviz format. Builtins are boxes,
+// sensitive ones red, functions unreachable from the top level grey.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	reach := g.reachableSet()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph callgraph {")
+	fmt.Fprintln(bw, "\trankdir=LR;")
+	fmt.Fprintln(bw, "\tnode [fontname=\"Helvetica\"];")
+	id := make(map[*Node]string)
+	for i, n := range g.Nodes() {
+		id[n] = fmt.Sprintf("n%d", i)
+		var attrs []string
+		attrs = append(attrs, "label="+strconv.Quote(n.Name))
+		switch n.Kind {
+		case Main:
+			attrs = append(attrs, "shape=doubleoctagon")
+		case Builtin:
+			attrs = append(attrs, "shape=box")
+		case Undefined:
+			attrs = append(attrs, "shape=ellipse", "style=dashed")
+		default:
+			attrs = append(attrs, "shape=ellipse")
+		}
+		if isSensitive(n) {
+			attrs = append(attrs, "color=red", "fontcolor=red")
+		} else if !reach[n] {
+			attrs = append(attrs, "color=gray", "fontcolor=gray")
+		}
+		fmt.Fprintf(bw, "\t%s [%s];\n", id[n], strings.Join(attrs, ", "))
+	}
+	for _, e := range g.Edges() {
+		style := ""
+		switch e.Kind {
+		case Dynamic:
+			style = " [style=dashed, label=\"Call\"]"
+		case Callback:
+			style = " [style=dotted, label=\"callback\"]"
+		case Ref:
+			style = " [style=dotted]"
+		}
+		fmt.Fprintf(bw, "\t%s -> %s%s;\n", id[e.From], id[e.To], style)
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
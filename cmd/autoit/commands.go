@@ -0,0 +1,567 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/x0r19x91/libautoit"
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/batch"
+	"github.com/x0r19x91/libautoit/lexer"
+	"github.com/x0r19x91/libautoit/parser"
+	"github.com/x0r19x91/libautoit/tidy"
+	"github.com/x0r19x91/libautoit/udf"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// tidyOptions are the flags passed to the tidy package
+type tidyOptions struct {
+	indent       int
+	tabs         bool
+	identCase    string
+	strLit       int
+	funcComments bool
+	extraNewline bool
+	stripUDF     string  // fingerprints of the standard includes, see udfdb
+	udfDB        *udf.DB // loaded from stripUDF
+}
+
+func (o *tidyOptions) register(fs *flag.FlagSet) {
+	fs.IntVar(&o.indent, "indent", 4, "spaces per indent level")
+	fs.BoolVar(&o.tabs, "tabs", false, "indent with tabs")
+	fs.StringVar(&o.identCase, "case", "auto", "identifier case: auto, lower or upper")
+	fs.IntVar(&o.strLit, "strlit", 160, "split string literals longer than this")
+	fs.BoolVar(&o.funcComments, "func-comments", true, "add \"; -> Name\" after EndFunc")
+	fs.BoolVar(&o.extraNewline, "extra-newline", true, "add a blank line after EndFunc")
+	fs.StringVar(&o.stripUDF, "strip-udf", "", "collapse the standard UDF code found in this `db`, made by udfdb, into #include lines")
+}
+
+func (o *tidyOptions) check() error {
+	switch o.identCase {
+	case "auto", "lower", "upper":
+	default:
+		return fmt.Errorf("bad -case %q", o.identCase)
+	}
+	if o.indent < 0 || o.strLit <= 0 {
+		return fmt.Errorf("-indent and -strlit must be positive")
+	}
+	if o.stripUDF != "" {
+		f, err := os.Open(o.stripUDF)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if o.udfDB, err = udf.LoadDB(f); err != nil {
+			return fmt.Errorf("%s: %v", o.stripUDF, err)
+		}
+	}
+	return nil
+}
+
+// tidy returns the cleaned source of a script resource
+func (o *tidyOptions) tidy(r *libautoit.AutoItResource) string {
+	src, _ := o.tidyContext(context.Background(), r)
+	return src
+}
+
+// tidyContext is tidy, stopping with the error of ctx when it is done
+func (o *tidyOptions) tidyContext(ctx context.Context, r *libautoit.AutoItResource) (string, error) {
+	r.Data = bytes.Replace(r.Data, []byte{13, 10}, []byte{10}, -1)
+	ti := tidy.NewTidyInfo(r.CreateTokenizer())
+	ti.SetFuncComments(o.funcComments)
+	switch o.identCase {
+	case "lower":
+		ti.SetIdentifierCase(tidy.AllLower)
+	case "upper":
+		ti.SetIdentifierCase(tidy.AllUpper)
+	default:
+		ti.SetIdentifierCase(tidy.AutoDetect)
+	}
+	ti.SetIndentSpaces(o.indent)
+	ti.SetMaxStringLiteralSize(o.strLit)
+	ti.SetUseExtraNewline(o.extraNewline)
+	ti.SetUseTabs(o.tabs)
+	src, err := ti.TidyContext(ctx)
+	if err != nil || o.udfDB == nil {
+		return src, err
+	}
+	script, err := parser.ParseSource([]byte(src))
+	if err != nil {
+		// a partial tree would lose lines
+		return src, nil
+	}
+	udf.Strip(script, o.udfDB, udf.Options{})
+	p := ast.NewPrinter()
+	p.IndentSpaces = o.indent
+	p.UseTabs = o.tabs
+	p.FuncComments = o.funcComments
+	p.ExtraNewline = o.extraNewline
+	var buf bytes.Buffer
+	p.Fprint(&buf, script)
+	return buf.String(), nil
+}
+
+func isScript(r *libautoit.AutoItResource) bool {
+	return r.IsAutoItScript(500)
+}
+
+// input is a file given on the command line
+type input struct {
+	path string
+	data []byte                // as read, GetScripts leaves it untouched
+	file *libautoit.AutoItFile // nil when no script was found
+	err  error
+}
+
+func warn(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "autoit: "+format+"\n", args...)
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// load reads and unpacks a file, decompressing its resources within
+// the default limits
+func load(path string) (*input, int) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		warn("%v", err)
+		return &input{path: path, err: err}, ExitError
+	}
+	in := &input{path: path, data: data}
+	in.file, in.err = libautoit.GetScriptsContext(context.Background(), data, libautoit.DefaultLimits)
+	if in.err != nil {
+		warn("%s: %v", path, in.err)
+		in.file = nil
+		return in, ExitNoScript
+	}
+	code := ExitOK
+	if err := in.file.DecompressContext(context.Background()); err != nil {
+		warn("%s: %v", path, err)
+		code = ExitDecompress
+	}
+	return in, code
+}
+
+// parse parses the flags of a command, files being required
+func parse(fs *flag.FlagSet, args []string, opts *tidyOptions) ([]string, int) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil, ExitOK
+		}
+		return nil, ExitUsage
+	}
+	if opts != nil {
+		if err := opts.check(); err != nil {
+			warn("%v", err)
+			return nil, ExitUsage
+		}
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return nil, ExitUsage
+	}
+	return fs.Args(), ExitOK
+}
+
+func runInfo(args []string) int {
+	fs := newFlags("info", "file...")
+	depth := fs.Int("depth", 0, "also describe the scripts nested in the resources, this many levels down")
+	files, code := parse(fs, args, nil)
+	if files == nil {
+		return code
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, path := range files {
+		in, c := load(path)
+		code = max(code, c)
+		if in.file == nil {
+			continue
+		}
+		fmt.Fprintf(tw, "file:\t%s\n", path)
+		describe(tw, in.file)
+		if *depth <= 0 {
+			continue
+		}
+		tree, _ := libautoit.GetScriptsRecursive(context.Background(), in.data, libautoit.DefaultLimits, *depth)
+		if tree == nil {
+			continue // already reported
+		}
+		tree.Walk(func(f *libautoit.AutoItFile) bool {
+			if f == tree {
+				return true
+			}
+			fmt.Fprintf(tw, "nested:\t%s, depth %d\n", f.Source.Name(), f.Depth)
+			if f.Err != nil {
+				warn("%s: %s: %v", path, f.Source.Name(), f.Err)
+				fmt.Fprintf(tw, "error:\t%v\n", f.Err)
+			}
+			describe(tw, f)
+			return true
+		})
+	}
+	if err := tw.Flush(); err != nil {
+		return ExitError
+	}
+	return code
+}
+
+func describe(tw io.Writer, f *libautoit.AutoItFile) {
+	fmt.Fprintf(tw, "version:\t%s\n", f.Version)
+	for i, a := range f.Archives {
+		fmt.Fprintf(tw, "archive %d:\t%s\n", i+1, a)
+	}
+	fmt.Fprintf(tw, "resources:\t%d\n", len(f.Resources))
+	for i, r := range f.Resources {
+		fmt.Fprintf(tw, "\n[%d]\t%s\n", i+1, r.Name())
+		fmt.Fprintf(tw, "  archive:\t%d\n", archiveIndex(f, r)+1)
+		fmt.Fprintf(tw, "  path:\t%s\n", r.Path)
+		fmt.Fprintf(tw, "  compressed:\t%t (%d bytes)\n", r.IsCompressed, r.CompressedSize)
+		fmt.Fprintf(tw, "  size:\t%d bytes\n", r.DecompressedSize)
+		fmt.Fprintf(tw, "  created:\t%s\n", r.CreationTime.Format(time.RFC3339))
+		fmt.Fprintf(tw, "  modified:\t%s\n", r.ModifiedTime.Format(time.RFC3339))
+		fmt.Fprintf(tw, "  script:\t%t\n", isScript(r))
+	}
+	fmt.Fprintln(tw)
+}
+
+// fileName is the path a resource is written under, scripts ending in
+// .au3
+func fileName(r *libautoit.AutoItResource, script bool) string {
+	name := r.Path
+	if name == "" {
+		name = r.Tag
+	}
+	base := libautoit.SafePath(name, false)
+	if script && !strings.EqualFold(filepath.Ext(base), ".au3") {
+		name += ".au3"
+	} else if !strings.ContainsRune(base, '.') {
+		name += ".bin"
+	}
+	return name
+}
+
+func runExtract(args []string) int {
+	fs := newFlags("extract", "file...")
+	var opts tidyOptions
+	opts.register(fs)
+	out := fs.String("o", "dump", "output directory")
+	raw := fs.Bool("raw", false, "write scripts as decompressed, without tidying")
+	keepDirs := fs.Bool("keep-dirs", false, "recreate the directories of the resource paths")
+	files, code := parse(fs, args, &opts)
+	if files == nil {
+		return code
+	}
+	for _, path := range files {
+		in, c := load(path)
+		code = max(code, c)
+		if in.file == nil {
+			continue
+		}
+		dir := *out
+		if len(files) > 1 {
+			dir = filepath.Join(dir, filepath.Base(path))
+		}
+		entries, err := in.file.ExtractAll(dir, libautoit.ExtractOptions{
+			KeepDirs: *keepDirs,
+			Data: func(r *libautoit.AutoItResource) []byte {
+				if isScript(r) && !*raw {
+					return []byte(opts.tidy(r))
+				}
+				return r.Data
+			},
+			Name: func(r *libautoit.AutoItResource) string {
+				return fileName(r, isScript(r))
+			},
+		})
+		for _, e := range entries {
+			if e.Error != "" {
+				continue // in err
+			}
+			fmt.Printf("%s\t%d bytes\n", filepath.Join(dir, filepath.FromSlash(e.File)), e.Size)
+		}
+		if err != nil {
+			warn("%s: %v", path, err)
+			code = max(code, ExitError)
+		}
+	}
+	return code
+}
+
+func runDecompile(args []string) int {
+	fs := newFlags("decompile", "file...")
+	var opts tidyOptions
+	opts.register(fs)
+	out := fs.String("o", "", "write to this file instead of stdout")
+	files, code := parse(fs, args, &opts)
+	if files == nil {
+		return code
+	}
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			warn("%v", err)
+			return ExitError
+		}
+		defer f.Close()
+		w = f
+	}
+	for _, path := range files {
+		in, c := load(path)
+		code = max(code, c)
+		if in.file == nil {
+			continue
+		}
+		found := false
+		for _, r := range in.file.Resources {
+			if !isScript(r) {
+				continue
+			}
+			found = true
+			if len(files) > 1 {
+				fmt.Fprintf(w, "; %s: %s\n", path, r.Name())
+			}
+			if _, err := io.WriteString(w, opts.tidy(r)); err != nil {
+				warn("%v", err)
+				return ExitError
+			}
+		}
+		if !found {
+			warn("%s: %v", path, libautoit.ErrScriptNotFound)
+			code = max(code, ExitNoScript)
+		}
+	}
+	return code
+}
+
+func runTokens(args []string) int {
+	fs := newFlags("tokens", "file...")
+	files, code := parse(fs, args, nil)
+	if files == nil {
+		return code
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 1, ' ', 0)
+	for _, path := range files {
+		in, c := load(path)
+		code = max(code, c)
+		if in.file == nil {
+			continue
+		}
+		for _, r := range in.file.Resources {
+			if !isScript(r) {
+				continue
+			}
+			fmt.Fprintf(tw, "# %s: %s\n", path, r.Name())
+			lex := r.CreateTokenizer()
+			line := 1
+			for {
+				tok := lex.NextToken()
+				if tok.TokType == lexer.EOF {
+					break
+				}
+				fmt.Fprintf(tw, "%d\t%s\t%q\n", line, tok.TokType, tok.Value)
+				if tok.TokType == lexer.InvalidToken {
+					code = max(code, ExitError)
+					break
+				}
+				if tok.TokType == lexer.EOL {
+					line++
+				}
+			}
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return ExitError
+	}
+	return code
+}
+
+type jsonResource struct {
+	Name           string    `json:"name"`
+	Path           string    `json:"path"`
+	Compressed     bool      `json:"compressed"`
+	CompressedSize uint32    `json:"compressed_size"`
+	Size           uint32    `json:"size"`
+	Checksum       uint32    `json:"checksum"`
+	Created        time.Time `json:"created"`
+	Modified       time.Time `json:"modified"`
+	Script         bool      `json:"script"`
+	SHA256         string    `json:"sha256"`
+	Source         string    `json:"source,omitempty"`
+	Archive        int       `json:"archive"` // index in archives
+}
+
+type jsonArchive struct {
+	Offset    int    `json:"offset"`
+	End       int    `json:"end"`
+	Key       byte   `json:"key"`
+	Subtype   string `json:"subtype"`
+	Resources int    `json:"resources"`
+	Error     string `json:"error,omitempty"`
+}
+
+func archiveIndex(f *libautoit.AutoItFile, r *libautoit.AutoItResource) int {
+	for i, a := range f.Archives {
+		if a == r.Archive {
+			return i
+		}
+	}
+	return -1
+}
+
+type jsonFile struct {
+	File      string         `json:"file"`
+	Size      int            `json:"size"`
+	SHA256    string         `json:"sha256"`
+	Version   string         `json:"version,omitempty"`
+	Archives  []jsonArchive  `json:"archives,omitempty"`
+	Resources []jsonResource `json:"resources"`
+	Error     string         `json:"error,omitempty"`
+	Exit      int            `json:"exit"`
+}
+
+func sha(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func runJSON(args []string) int {
+	fs := newFlags("json", "file...")
+	var opts tidyOptions
+	opts.register(fs)
+	source := fs.Bool("source", false, "include the tidied source of the scripts")
+	files, code := parse(fs, args, &opts)
+	if files == nil {
+		return code
+	}
+	out := []jsonFile{}
+	for _, path := range files {
+		in, c := load(path)
+		code = max(code, c)
+		jf := jsonFile{File: path, Resources: []jsonResource{}, Exit: c}
+		if in.data != nil {
+			jf.Size, jf.SHA256 = len(in.data), sha(in.data)
+		}
+		if in.file == nil {
+			jf.Error = in.err.Error()
+			out = append(out, jf)
+			continue
+		}
+		jf.Version = in.file.Version.String()
+		for _, a := range in.file.Archives {
+			ja := jsonArchive{Offset: a.Offset, End: a.End, Key: a.Key, Subtype: a.Subtype, Resources: len(a.Resources)}
+			if a.Err != nil {
+				ja.Error = a.Err.Error()
+			}
+			jf.Archives = append(jf.Archives, ja)
+		}
+		for _, r := range in.file.Resources {
+			jr := jsonResource{
+				Name:           r.Name(),
+				Path:           r.Path,
+				Compressed:     r.IsCompressed,
+				CompressedSize: r.CompressedSize,
+				Size:           r.DecompressedSize,
+				Checksum:       r.Checksum,
+				Created:        r.CreationTime,
+				Modified:       r.ModifiedTime,
+				Script:         isScript(r),
+				SHA256:         sha(r.Data),
+				Archive:        archiveIndex(in.file, r),
+			}
+			if jr.Script && *source {
+				jr.Source = opts.tidy(r)
+			}
+			jf.Resources = append(jf.Resources, jr)
+		}
+		out = append(out, jf)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return ExitError
+	}
+	return code
+}
+
+func runScan(args []string) int {
+	fs := newFlags("scan", "path...")
+	var opts tidyOptions
+	opts.register(fs)
+	workers := fs.Int("workers", runtime.NumCPU(), "samples scanned at once")
+	timeout := fs.Duration("timeout", time.Minute, "time allowed per sample, 0 for none")
+	maxSize := fs.Int64("max-size", 256<<20, "skip samples larger than this many bytes, 0 for no limit")
+	source := fs.Bool("source", false, "include the tidied source of the scripts")
+	paths, code := parse(fs, args, &opts)
+	if paths == nil {
+		return code
+	}
+	w := bufio.NewWriter(os.Stdout)
+	write := batch.JSONL(w)
+	err := batch.Scan(paths, batch.Options{
+		Workers: *workers,
+		Timeout: *timeout,
+		MaxSize: *maxSize,
+		Source:  *source,
+		Tidy:    opts.tidyContext,
+	}, func(r *batch.Result) error {
+		if err := write(r); err != nil {
+			return err
+		}
+		return w.Flush()
+	})
+	if err != nil {
+		warn("%v", err)
+		return ExitError
+	}
+	return ExitOK
+}
+
+func runUDFDB(args []string) int {
+	fs := newFlags("udfdb", "include-dir...")
+	out := fs.String("o", "udf.json", "write the fingerprints to this file")
+	dirs, code := parse(fs, args, nil)
+	if dirs == nil {
+		return code
+	}
+	db := udf.NewDB()
+	for _, dir := range dirs {
+		if err := db.IndexDir(dir); err != nil {
+			warn("%v", err)
+			return ExitError
+		}
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		warn("%v", err)
+		return ExitError
+	}
+	if err := db.Save(f); err != nil {
+		f.Close()
+		warn("%v", err)
+		return ExitError
+	}
+	if err := f.Close(); err != nil {
+		warn("%v", err)
+		return ExitError
+	}
+	fmt.Fprintf(os.Stderr, "%d functions and %d constants\n", len(db.Funcs), len(db.Consts))
+	return ExitOK
+}
@@ -0,0 +1,106 @@
+// Command autoit extracts, decompiles and describes compiled AutoIt
+// scripts.
+//
+// Usage:
+//
+//	autoit <command> [flags] file...
+//
+// The commands are:
+//
+//	info       print the version, resources and timestamps
+//	extract    write the resources to a directory
+//	decompile  print the tidied scripts
+//	tokens     dump the token stream of the scripts
+//	json       print a manifest of the resources as JSON
+//	scan       scan directories and zip or tar archives, one JSON line per sample
+//	udfdb      fingerprint the standard include files for -strip-udf
+//
+// Exit codes:
+//
+//	0  success
+//	1  a file could not be read or written
+//	2  bad usage
+//	3  no AutoIt script found in a file
+//	4  a resource failed to decompress
+//
+// When several files are given every one is processed and the highest
+// code is returned. scan reports the failures of samples in its output
+// and only fails when that can't be written.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+const (
+	ExitOK = iota
+	ExitError
+	ExitUsage
+	ExitNoScript
+	ExitDecompress
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) int
+}
+
+var commands = []*command{
+	{"info", "print the version, resources and timestamps", runInfo},
+	{"extract", "write the resources to a directory", runExtract},
+	{"decompile", "print the tidied scripts", runDecompile},
+	{"tokens", "dump the token stream of the scripts", runTokens},
+	{"json", "print a manifest of the resources as JSON", runJSON},
+	{"scan", "scan directories and archives, one JSON line per sample", runScan},
+	{"udfdb", "fingerprint the standard include files for -strip-udf", runUDFDB},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: autoit <command> [flags] file...")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	names := make([]string, 0, len(commands))
+	byName := make(map[string]*command)
+	for _, c := range commands {
+		names = append(names, c.name)
+		byName[c.name] = c
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", n, byName[n].usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nrun \"autoit <command> -h\" for the flags of a command")
+}
+
+// newFlags returns the flag set of a command, failing with ExitUsage
+func newFlags(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: autoit %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(ExitUsage)
+	}
+	name := os.Args[1]
+	if name == "-h" || name == "-help" || name == "--help" || name == "help" {
+		usage()
+		os.Exit(ExitOK)
+	}
+	for _, c := range commands {
+		if c.name == name {
+			os.Exit(c.run(os.Args[2:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "autoit: unknown command %q\n", name)
+	usage()
+	os.Exit(ExitUsage)
+}
@@ -0,0 +1,289 @@
+package deadcode
+
+// Removal of unused functions and globals.
+// A function is live when the top level code can reach it through the
+// call graph or through a constant string given to Call or Execute, a
+// global when live code uses it or names it in Assign, Eval, IsDeclared
+// or Execute.
+
+import (
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/callgraph"
+	"github.com/x0r19x91/libautoit/parser"
+	"github.com/x0r19x91/libautoit/symbols"
+	"strings"
+)
+
+type Options struct {
+	// Conservative keeps functions and globals named in any string
+	// literal, and removes nothing a non constant Call, Execute, Eval or
+	// Assign could reach.
+	Conservative bool
+}
+
+type Report struct {
+	Funcs   []string // removed functions
+	Globals []string // removed globals
+	Kept    []string // unused but kept because of a possible dynamic reference
+	Notes   []string
+}
+
+type pass struct {
+	script *ast.Script
+	opts   Options
+	graph  *callgraph.Graph
+	info   *symbols.Info
+	report *Report
+
+	live     map[*ast.FuncDecl]bool
+	liveVars map[string]bool // lower case names from strings
+	strs     []string        // string literals, lower cased
+
+	dynFuncs bool // a non constant Call or Execute in live code
+	dynVars  bool // a non constant Eval, Assign or Execute in live code
+}
+
+// Eliminate removes dead functions and global declarations from a
+// script in place and reports what was removed.
+func Eliminate(script *ast.Script, opts Options) *Report {
+	p := &pass{
+		script:   script,
+		opts:     opts,
+		graph:    callgraph.Build(script),
+		info:     symbols.Resolve(script),
+		report:   &Report{},
+		live:     make(map[*ast.FuncDecl]bool),
+		liveVars: make(map[string]bool),
+	}
+	p.markLive()
+	ast.Inspect(script, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.BasicLit); ok {
+			if s, ok := ast.StringValue(lit); ok {
+				p.strs = append(p.strs, strings.ToLower(s))
+			}
+		}
+		return true
+	})
+	for _, fn := range script.Funcs() {
+		if !p.live[fn] && p.keepFunc(fn.Name.Name) {
+			p.report.Kept = append(p.report.Kept, fn.Name.Name)
+			p.live[fn] = true
+		}
+	}
+	usedGlobals := p.usedGlobals()
+
+	var out []ast.Stmt
+	for _, s := range script.Stmts {
+		switch s := s.(type) {
+		case *ast.FuncDecl:
+			if !p.live[s] {
+				p.report.Funcs = append(p.report.Funcs, s.Name.Name)
+				continue
+			}
+		case *ast.DeclStmt:
+			if p.stripDecl(s, usedGlobals) {
+				continue
+			}
+		}
+		out = append(out, s)
+	}
+	script.Stmts = out
+	if opts.Conservative && p.dynFuncs {
+		p.report.Notes = append(p.report.Notes, "functions kept: live code calls a function by a computed name")
+	}
+	if opts.Conservative && p.dynVars {
+		p.report.Notes = append(p.report.Notes, "globals kept: live code accesses a variable by a computed name")
+	}
+	return p.report
+}
+
+// markLive walks the call graph from the top level code, following
+// the names found in Execute strings until nothing new turns up
+func (p *pass) markLive() {
+	queue := []*callgraph.Node{p.graph.Root}
+	seen := map[*callgraph.Node]bool{p.graph.Root: true}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		var body ast.Node
+		if n == p.graph.Root {
+			body = topLevel(p.script)
+		} else if n.Decl != nil {
+			p.live[n.Decl] = true
+			body = n.Decl
+		}
+		var next []*callgraph.Node
+		for _, e := range n.Out {
+			next = append(next, e.To)
+		}
+		if body != nil {
+			for _, name := range p.scanDynamic(body) {
+				if m := p.graph.Node(name); m != nil {
+					next = append(next, m)
+				}
+			}
+		}
+		for _, m := range next {
+			if !seen[m] {
+				seen[m] = true
+				queue = append(queue, m)
+			}
+		}
+	}
+}
+
+func topLevel(script *ast.Script) *ast.BlockStmt {
+	b := &ast.BlockStmt{}
+	for _, s := range script.Stmts {
+		if _, ok := s.(*ast.FuncDecl); !ok {
+			b.List = append(b.List, s)
+		}
+	}
+	return b
+}
+
+// scanDynamic records the names live code accesses dynamically and returns
+// the functions named in Execute strings
+func (p *pass) scanDynamic(body ast.Node) []string {
+	var funcs []string
+	ast.Inspect(body, func(n ast.Node) bool {
+		if n, ok := n.(*ast.CallExpr); ok && n.IsBuiltin() && len(n.Args) > 0 {
+			s, constant := ast.StringValue(n.Args[0])
+			switch strings.ToLower(n.CalleeName()) {
+			case "call":
+				p.dynFuncs = p.dynFuncs || !constant
+			case "assign", "eval", "isdeclared":
+				if constant {
+					p.liveVars[strings.ToLower(strings.TrimPrefix(s, "$"))] = true
+				}
+				p.dynVars = p.dynVars || !constant
+			case "execute":
+				if !constant {
+					p.dynFuncs, p.dynVars = true, true
+					break
+				}
+				f, v := executeRefs(s)
+				funcs = append(funcs, f...)
+				for _, name := range v {
+					p.liveVars[strings.ToLower(name)] = true
+				}
+			}
+		}
+		return true
+	})
+	return funcs
+}
+
+// executeRefs returns the functions and variables of an Execute string
+func executeRefs(src string) (funcs, vars []string) {
+	script, _ := parser.ParseSource([]byte(src))
+	if script == nil {
+		return
+	}
+	ast.Inspect(script, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncIdent:
+			funcs = append(funcs, n.Name)
+		case *ast.Variable:
+			vars = append(vars, n.Name)
+		}
+		return true
+	})
+	return
+}
+
+// usedGlobals returns the globals referenced by kept code, declarations
+// of the top level excluded
+func (p *pass) usedGlobals() map[*symbols.Symbol]bool {
+	decls := make(map[*ast.Variable]bool)
+	for _, s := range p.script.Stmts {
+		if d, ok := s.(*ast.DeclStmt); ok {
+			for _, spec := range d.Specs {
+				decls[spec.Name] = true
+			}
+		}
+	}
+	used := make(map[*symbols.Symbol]bool)
+	mark := func(root ast.Node) {
+		ast.Inspect(root, func(n ast.Node) bool {
+			if v, ok := n.(*ast.Variable); ok && !decls[v] {
+				if sym := p.info.SymbolOf(v); sym != nil && sym.IsGlobal() {
+					used[sym] = true
+				}
+			}
+			return true
+		})
+	}
+	for _, s := range p.script.Stmts {
+		if fn, ok := s.(*ast.FuncDecl); ok {
+			if p.live[fn] {
+				mark(fn)
+			}
+			continue
+		}
+		mark(s)
+	}
+	return used
+}
+
+func (p *pass) keepFunc(name string) bool {
+	if !p.opts.Conservative {
+		return false
+	}
+	return p.dynFuncs || p.inStrings(name)
+}
+
+func (p *pass) keepGlobal(name string) bool {
+	if p.liveVars[strings.ToLower(name)] {
+		return true
+	}
+	if !p.opts.Conservative {
+		return false
+	}
+	return p.dynVars || p.inStrings(name)
+}
+
+func (p *pass) inStrings(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range p.strs {
+		if strings.Contains(s, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripDecl removes the unused variables of a top level declaration,
+// keeping those whose initializer may have side effects. It reports
+// whether the whole statement can go.
+func (p *pass) stripDecl(d *ast.DeclStmt, used map[*symbols.Symbol]bool) bool {
+	var specs []*ast.VarSpec
+	for _, spec := range d.Specs {
+		sym := p.info.SymbolOf(spec.Name)
+		if sym == nil || !sym.IsGlobal() || used[sym] || !pure(spec) {
+			specs = append(specs, spec)
+			continue
+		}
+		if p.keepGlobal(spec.Name.Name) {
+			if !p.liveVars[strings.ToLower(spec.Name.Name)] {
+				p.report.Kept = append(p.report.Kept, "$"+spec.Name.Name)
+			}
+			specs = append(specs, spec)
+			continue
+		}
+		p.report.Globals = append(p.report.Globals, spec.Name.Name)
+	}
+	d.Specs = specs
+	return len(specs) == 0
+}
+
+func pure(spec *ast.VarSpec) bool {
+	ok := true
+	ast.Inspect(spec, func(n ast.Node) bool {
+		if _, call := n.(*ast.CallExpr); call {
+			ok = false
+		}
+		return ok
+	})
+	return ok
+}
@@ -1,10 +1,21 @@
 package libautoit
 
+import "context"
+
 type IDecompressor interface {
 	Decompress() ([]byte, error)
+	// DecompressContext stops when ctx is done and fails with
+	// ErrResourceTooLarge, before allocating, when the output would be
+	// larger than maxSize. maxSize <= 0 is no limit.
+	DecompressContext(ctx context.Context, maxSize int) ([]byte, error)
 	SetCallback(func(done, tot int))
 }
 
+// callbacker is a decompressor telling its callback
+type callbacker interface {
+	Callback() func(done, tot int)
+}
+
 func CreateDecompressor(ver AutoItVersion, inpBuf []byte, decompSize uint32) IDecompressor {
 	if ver == EA06 {
 		return NewEa06Decompressor(inpBuf, decompSize)
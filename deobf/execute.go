@@ -0,0 +1,232 @@
+package deobf
+
+// Decompilation of the code hidden in the strings given to Execute,
+// Eval, Assign and Call. The strings are tokenized and parsed like the
+// script itself, payloads nested in payloads are expanded as well.
+
+import (
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/eval"
+	"github.com/x0r19x91/libautoit/lexer"
+	"github.com/x0r19x91/libautoit/parser"
+	"strings"
+)
+
+type Mode int
+
+const (
+	// Inline replaces the calls by the code they run.
+	Inline Mode = iota
+	// Annotate keeps the calls and adds the code in a comment above the
+	// statement.
+	Annotate
+)
+
+// MaxPayloadDepth bounds the nesting of payloads.
+const MaxPayloadDepth = 16
+
+type Payload struct {
+	Pos     ast.Pos
+	Func    string // enclosing function, "" at the top level
+	Builtin string // Execute, Eval, Assign or Call
+	Source  string // the string argument
+	Code    string // what runs
+	Depth   int    // 0 for a call in the script itself
+	Inlined bool
+}
+
+type expander struct {
+	mode     Mode
+	fn       string
+	depth    int
+	anchors  []ast.Stmt
+	comments map[ast.Stmt][]string
+	log      []*Payload
+}
+
+// Expand decompiles the calls to Execute, Eval, Assign and Call whose
+// arguments are constant. Call Fold first to catch the strings that are
+// built at run time from constants.
+func Expand(script *ast.Script, mode Mode) []*Payload {
+	e := &expander{mode: mode, comments: make(map[ast.Stmt][]string)}
+	ast.Rewrite(script, e.pre, e.post)
+	return e.log
+}
+
+func (e *expander) pre(c *ast.Cursor) bool {
+	switch n := c.Node().(type) {
+	case *ast.FuncDecl:
+		e.fn = n.Name.Name
+	case *ast.CaseClause:
+		// in a list of cases, comments can't go there
+	case ast.Stmt:
+		if c.Index() < 0 {
+			break
+		}
+		if s, ok := n.(*ast.ExprStmt); ok && e.mode == Inline {
+			if as := e.assign(s); as != nil {
+				c.Replace(as)
+				e.anchors = append(e.anchors, as)
+				as.Rhs = ast.Rewrite(as.Rhs, e.pre, e.post).(ast.Expr)
+				e.post(c)
+				return false
+			}
+		}
+		e.anchors = append(e.anchors, n)
+	case *ast.CallExpr:
+		if nx := e.call(n); nx != nil {
+			c.Replace(nx)
+			return false
+		}
+	}
+	return true
+}
+
+func (e *expander) post(c *ast.Cursor) bool {
+	n := c.Node()
+	if _, ok := n.(*ast.FuncDecl); ok {
+		e.fn = ""
+	}
+	if k := len(e.anchors); k > 0 && e.anchors[k-1] == n {
+		e.anchors = e.anchors[:k-1]
+		for _, text := range e.comments[n.(ast.Stmt)] {
+			c.InsertBefore(&ast.CommentStmt{Semi: n.Pos(), Text: text})
+		}
+		delete(e.comments, n.(ast.Stmt))
+	}
+	return true
+}
+
+// parse parses a payload and expands the payloads inside it
+func (e *expander) parse(src string) (ast.Expr, bool) {
+	x, err := parser.ParseExpr(parser.NewSourceTokenizer([]byte(src)))
+	if err != nil || x == nil {
+		return nil, false
+	}
+	if e.depth >= MaxPayloadDepth {
+		return x, true
+	}
+	saved := e.mode
+	e.depth++
+	e.mode = Inline
+	x = ast.Rewrite(x, e.pre, e.post).(ast.Expr)
+	e.mode = saved
+	e.depth--
+	return x, true
+}
+
+// variable parses a name given to Eval or Assign
+func (e *expander) variable(name string) (*ast.Variable, bool) {
+	x, err := parser.ParseExpr(parser.NewSourceTokenizer([]byte("$" + strings.TrimPrefix(name, "$"))))
+	v, ok := x.(*ast.Variable)
+	return v, err == nil && ok
+}
+
+// call returns the code run by a call, nil to keep it
+func (e *expander) call(call *ast.CallExpr) ast.Expr {
+	if !call.IsBuiltin() || len(call.Args) == 0 {
+		return nil
+	}
+	name := call.CalleeName()
+	arg, err := eval.Const(call.Args[0])
+	if err != nil {
+		return nil
+	}
+	src := arg.Str()
+
+	var code ast.Expr
+	switch strings.ToLower(name) {
+	case "execute":
+		if len(call.Args) != 1 {
+			return nil
+		}
+		x, ok := e.parse(src)
+		if !ok {
+			return nil
+		}
+		switch x.(type) {
+		case *ast.BinaryExpr, *ast.TernaryExpr:
+			x = &ast.ParenExpr{Lparen: call.Pos(), X: x}
+		}
+		code = x
+
+	case "eval":
+		v, ok := e.variable(src)
+		if !ok || len(call.Args) != 1 {
+			return nil
+		}
+		v.NamePos = call.Pos()
+		code = v
+
+	case "call":
+		x, ok := e.parse(src + "()")
+		fn, isCall := x.(*ast.CallExpr)
+		if !ok || !isCall || len(fn.Args) > 0 {
+			return nil
+		}
+		if id, ok := fn.Fun.(*ast.FuncIdent); ok {
+			id.NamePos = call.Pos()
+		}
+		fn.Args = call.Args[1:]
+		code = fn
+
+	case "assign":
+		// Assign returns a value, only the statements are inlined, by
+		// assign
+		v, ok := e.variable(src)
+		if !ok || len(call.Args) < 2 {
+			return nil
+		}
+		as := &ast.AssignStmt{Lhs: v, Op: lexer.OpAssign, Rhs: call.Args[1]}
+		e.record(call, name, src, ast.Format(as), false)
+		return nil
+
+	default:
+		return nil
+	}
+
+	inline := e.mode == Inline
+	e.record(call, name, src, ast.ExprString(code), inline)
+	if inline {
+		return code
+	}
+	return nil
+}
+
+// assign turns Assign("name", value) used as a statement into an
+// assignment
+func (e *expander) assign(s *ast.ExprStmt) *ast.AssignStmt {
+	call, ok := s.X.(*ast.CallExpr)
+	if !ok || !call.IsBuiltin() || !strings.EqualFold(call.CalleeName(), "Assign") || len(call.Args) != 2 {
+		return nil
+	}
+	name, err := eval.Const(call.Args[0])
+	if err != nil {
+		return nil
+	}
+	v, ok := e.variable(name.Str())
+	if !ok {
+		return nil
+	}
+	v.NamePos = call.Pos()
+	as := &ast.AssignStmt{Lhs: v, Op: lexer.OpAssign, Rhs: call.Args[1]}
+	e.record(call, call.CalleeName(), name.Str(), ast.Format(as), true)
+	return as
+}
+
+func (e *expander) record(call *ast.CallExpr, builtin, src, code string, inlined bool) {
+	code = strings.TrimSpace(code)
+	if !inlined && e.depth == 0 && len(e.anchors) > 0 {
+		a := e.anchors[len(e.anchors)-1]
+		e.comments[a] = append(e.comments[a], builtin+": "+code)
+	}
+	e.log = append(e.log, &Payload{
+		Pos:     call.Pos(),
+		Func:    e.fn,
+		Builtin: builtin,
+		Source:  src,
+		Code:    code,
+		Depth:   e.depth,
+		Inlined: inlined,
+	})
+}
@@ -0,0 +1,247 @@
+package deobf
+
+// Constant folding of obfuscated strings.
+// Expressions built only from literals, operators and pure builtins
+// (Chr, StringReverse, BinaryToString, BitXOR, ...) are evaluated and
+// replaced by their value. Runs of constants inside a longer & chain
+// are merged as well.
+
+import (
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/eval"
+	"github.com/x0r19x91/libautoit/lexer"
+	"strings"
+)
+
+type Substitution struct {
+	Pos    ast.Pos
+	Func   string // enclosing function, "" at the top level
+	Before string
+	After  string
+	Value  eval.Value
+}
+
+type Result struct {
+	Script *ast.Script
+	Log    []*Substitution
+}
+
+// Source returns the tidied script.
+func (r *Result) Source() string {
+	return ast.Format(r.Script)
+}
+
+// Strings returns the recovered strings in the order found.
+func (r *Result) Strings() []string {
+	var ans []string
+	for _, s := range r.Log {
+		if s.Value.Kind() == eval.String {
+			ans = append(ans, s.Value.Str())
+		}
+	}
+	return ans
+}
+
+type Options struct {
+	// CallUser runs user functions called with constant arguments in
+	// the sandboxed interpreter, the usual string decryptors.
+	CallUser bool
+	// Limits of each call, eval.DefaultLimits when zero. Globals are
+	// always read only.
+	Limits eval.Limits
+}
+
+type folder struct {
+	res *Result
+	fn  string
+	in  *eval.Interpreter
+}
+
+// Fold evaluates the constant expressions of a script in place.
+func Fold(script *ast.Script) *Result {
+	return Deobfuscate(script, Options{})
+}
+
+// Deobfuscate folds the constant expressions of a script in place and,
+// with CallUser, the calls to its decryption functions.
+func Deobfuscate(script *ast.Script, opts Options) *Result {
+	f := &folder{res: &Result{Script: script}}
+	if opts.CallUser {
+		limits := opts.Limits
+		if limits == (eval.Limits{}) {
+			limits = eval.DefaultLimits
+		}
+		limits.ReadOnly = true
+		f.in = eval.NewInterpreter(script)
+		f.in.SetLimits(limits)
+		f.in.InitConsts(script)
+	}
+	ast.Rewrite(script, f.pre, f.post)
+	return f.res
+}
+
+func (f *folder) pre(c *ast.Cursor) bool {
+	switch n := c.Node().(type) {
+	case *ast.FuncDecl:
+		f.fn = n.Name.Name
+	case ast.Expr:
+		if nx, done := f.fold(n); done {
+			if nx != n {
+				c.Replace(nx)
+			}
+			return false
+		}
+	}
+	return true
+}
+
+func (f *folder) post(c *ast.Cursor) bool {
+	if _, ok := c.Node().(*ast.FuncDecl); ok {
+		f.fn = ""
+	}
+	return true
+}
+
+// isFinal reports whether x can't be folded any further
+func isFinal(x ast.Expr) bool {
+	if _, ok := eval.Literal(x); ok {
+		return true
+	}
+	// a signed number
+	if u, ok := x.(*ast.UnaryExpr); ok && u.Op != lexer.OpNot {
+		if lit, ok := u.X.(*ast.BasicLit); ok && lit.Kind != lexer.StrLit {
+			return true
+		}
+	}
+	// Binary("0x...") is how binary values are written back
+	if call, ok := x.(*ast.CallExpr); ok && strings.EqualFold(call.CalleeName(), "Binary") && len(call.Args) == 1 {
+		if s, ok := ast.StringValue(call.Args[0]); ok && strings.HasPrefix(s, "0x") {
+			return true
+		}
+	}
+	return false
+}
+
+// fold replaces x when constant, done is false when the children of x
+// still have to be visited
+func (f *folder) fold(x ast.Expr) (nx ast.Expr, done bool) {
+	if isFinal(x) {
+		return x, true
+	}
+	if v, err := eval.Const(x); err == nil {
+		if lit, ok := eval.Expr(v); ok {
+			f.log(x, lit, v, ast.ExprString(x))
+			return lit, true
+		}
+		return x, false
+	}
+	if b, ok := x.(*ast.BinaryExpr); ok && b.Op == lexer.OpConcat {
+		return f.concat(b), true
+	}
+	if call, ok := x.(*ast.CallExpr); ok && f.in != nil {
+		if v, ok := f.callUser(call); ok {
+			if lit, ok := eval.Expr(v); ok {
+				f.log(x, lit, v, ast.ExprString(x))
+				return lit, true
+			}
+		}
+	}
+	return x, false
+}
+
+// callUser runs a user function whose arguments are constant
+func (f *folder) callUser(call *ast.CallExpr) (eval.Value, bool) {
+	name := call.CalleeName()
+	if call.IsBuiltin() || !f.in.HasFunc(name) {
+		return eval.Value{}, false
+	}
+	args := make([]eval.Value, len(call.Args))
+	for i, a := range call.Args {
+		v, err := eval.Const(a)
+		if err != nil {
+			return v, false
+		}
+		args[i] = v
+	}
+	v, err := f.in.CallFunc(name, args)
+	return v, err == nil
+}
+
+func (f *folder) log(x, lit ast.Expr, v eval.Value, before string) {
+	if b, ok := lit.(*ast.BasicLit); ok {
+		b.ValuePos = x.Pos()
+	}
+	after := ast.ExprString(lit)
+	if after == before {
+		// a string split over lines with @CRLF and the like
+		return
+	}
+	f.res.Log = append(f.res.Log, &Substitution{
+		Pos:    x.Pos(),
+		Func:   f.fn,
+		Before: before,
+		After:  after,
+		Value:  v,
+	})
+}
+
+// sub folds an operand, visiting its children if it isn't constant
+func (f *folder) sub(x ast.Expr) ast.Expr {
+	if nx, done := f.fold(x); done {
+		return nx
+	}
+	return ast.Rewrite(x, f.pre, f.post).(ast.Expr)
+}
+
+func flatten(x ast.Expr, ops []ast.Expr) []ast.Expr {
+	if p, ok := x.(*ast.ParenExpr); ok {
+		if b, ok := p.X.(*ast.BinaryExpr); ok && b.Op == lexer.OpConcat {
+			x = b
+		}
+	}
+	if b, ok := x.(*ast.BinaryExpr); ok && b.Op == lexer.OpConcat {
+		return flatten(b.Y, flatten(b.X, ops))
+	}
+	return append(ops, x)
+}
+
+// concat merges the constant runs of an & chain, the operator converts
+// everything to strings so regrouping doesn't change the result
+func (f *folder) concat(b *ast.BinaryExpr) ast.Expr {
+	var out, run []ast.Expr
+	flush := func() {
+		switch len(run) {
+		case 0:
+		case 1:
+			out = append(out, f.sub(run[0]))
+		default:
+			var sb strings.Builder
+			var before []string
+			for _, x := range run {
+				v, _ := eval.Const(x)
+				sb.WriteString(v.Str())
+				before = append(before, ast.ExprString(x))
+			}
+			v := eval.StringValue(sb.String())
+			lit, _ := eval.Expr(v)
+			f.log(run[0], lit, v, strings.Join(before, " & "))
+			out = append(out, lit)
+		}
+		run = nil
+	}
+	for _, x := range flatten(b, nil) {
+		if v, err := eval.Const(x); err == nil && v.Kind() != eval.Array {
+			run = append(run, x)
+			continue
+		}
+		flush()
+		out = append(out, f.sub(x))
+	}
+	flush()
+
+	ans := out[0]
+	for _, y := range out[1:] {
+		ans = &ast.BinaryExpr{X: ans, OpPos: b.OpPos, Op: lexer.OpConcat, Y: y}
+	}
+	return ans
+}
@@ -0,0 +1,329 @@
+package diff
+
+// Semantic diff of two scripts.
+// Functions are paired by structural hash first, so a function that was
+// only renamed, or whose variables were, is unchanged. The rest are
+// paired by name, then by how many of their lines agree once names are
+// ignored. Paired functions that differ get a line diff of their
+// printed source, where the old names are replaced by the new ones
+// wherever the two versions bind them the same way.
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/udf"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Status string
+
+const (
+	Unchanged Status = "unchanged"
+	Modified  Status = "modified"
+	Added     Status = "added"
+	Removed   Status = "removed"
+)
+
+// Main names the top level code.
+const Main = "<main>"
+
+type FuncDiff struct {
+	Status  Status  `json:"status"`
+	Old     string  `json:"old,omitempty"` // name in the old script, "" when added
+	New     string  `json:"new,omitempty"` // name in the new script, "" when removed
+	OldLine int     `json:"old_line,omitempty"`
+	NewLine int     `json:"new_line,omitempty"`
+	Hunks   []*Hunk `json:"hunks,omitempty"`
+}
+
+type Diff struct {
+	Funcs []*FuncDiff `json:"funcs"`
+}
+
+// MinSimilarity is the share of equal lines, names ignored, above which
+// two functions with different names and hashes are paired.
+var MinSimilarity = 0.5
+
+// unit is a function or the top level code
+type unit struct {
+	name  string
+	line  int
+	shape string
+	node  ast.Node
+	text  *printed
+}
+
+func units(script *ast.Script) []*unit {
+	top := &ast.Script{}
+	ans := []*unit{nil}
+	for _, st := range script.Stmts {
+		fn, ok := st.(*ast.FuncDecl)
+		if !ok {
+			top.Stmts = append(top.Stmts, st)
+			continue
+		}
+		ans = append(ans, &unit{
+			name:  fn.Name.Name,
+			line:  fn.Pos().Line,
+			shape: udf.FuncShape(fn).Hash,
+			node:  fn,
+		})
+	}
+	body := &ast.FuncDecl{Name: &ast.FuncIdent{}, Body: &ast.BlockStmt{List: top.Stmts}}
+	ans[0] = &unit{name: Main, shape: udf.FuncShape(body).Hash, node: top}
+	if len(top.Stmts) > 0 {
+		ans[0].line = top.Stmts[0].Pos().Line
+	}
+	for _, u := range ans {
+		u.text = printUnit(u.node)
+	}
+	return ans
+}
+
+// Compare diffs two scripts. The top level code comes first, then the
+// functions of the new script in order and the removed ones.
+func Compare(before, after *ast.Script) *Diff {
+	ou, nu := units(before), units(after)
+	pair := make(map[*unit]*unit) // new to old
+	used := make(map[*unit]bool)
+	pair[nu[0]], used[ou[0]] = ou[0], true
+
+	// same structure
+	byShape := make(map[string][]*unit)
+	for _, u := range ou[1:] {
+		byShape[u.shape] = append(byShape[u.shape], u)
+	}
+	for _, n := range nu[1:] {
+		list := byShape[n.shape]
+		for len(list) > 0 && used[list[0]] {
+			list = list[1:]
+		}
+		byShape[n.shape] = list
+		if len(list) > 0 {
+			pair[n], used[list[0]] = list[0], true
+		}
+	}
+	// same name
+	byName := make(map[string]*unit)
+	for _, u := range ou[1:] {
+		if !used[u] {
+			byName[strings.ToLower(u.name)] = u
+		}
+	}
+	for _, n := range nu[1:] {
+		if o := byName[strings.ToLower(n.name)]; pair[n] == nil && o != nil && !used[o] {
+			pair[n], used[o] = o, true
+		}
+	}
+	// similar lines, best pairs first
+	for {
+		var bo, bn *unit
+		best := MinSimilarity
+		for _, n := range nu[1:] {
+			if pair[n] != nil {
+				continue
+			}
+			for _, o := range ou[1:] {
+				if used[o] {
+					continue
+				}
+				if s := similarity(body(o), body(n)); s >= best && s > 0 {
+					bo, bn, best = o, n, s
+				}
+			}
+		}
+		if bo == nil {
+			break
+		}
+		pair[bn], used[bo] = bo, true
+	}
+
+	funcs := make(map[string]string) // old to new function names
+	for n, o := range pair {
+		if n != nu[0] {
+			funcs[strings.ToLower(o.name)] = n.name
+		}
+	}
+	d := &Diff{}
+	for _, n := range nu {
+		o := pair[n]
+		if o == nil {
+			d.Funcs = append(d.Funcs, &FuncDiff{
+				Status:  Added,
+				New:     n.name,
+				NewLine: n.line,
+				Hunks:   hunks(nil, n.text.render(nil)),
+			})
+			continue
+		}
+		fd := &FuncDiff{Status: Unchanged, Old: o.name, New: n.name, OldLine: o.line, NewLine: n.line}
+		if o.shape != n.shape {
+			fd.Hunks = hunks(o.text.render(bindings(o.text, n.text, funcs)), n.text.render(nil))
+			if len(fd.Hunks) > 0 {
+				fd.Status = Modified
+			}
+		}
+		if n == nu[0] && fd.Status == Unchanged && len(n.text.abstract) == 0 {
+			continue
+		}
+		d.Funcs = append(d.Funcs, fd)
+	}
+	for _, o := range ou[1:] {
+		if !used[o] {
+			d.Funcs = append(d.Funcs, &FuncDiff{
+				Status:  Removed,
+				Old:     o.name,
+				OldLine: o.line,
+				Hunks:   hunks(o.text.render(nil), nil),
+			})
+		}
+	}
+	return d
+}
+
+// ident is a variable or user function name printed in a line
+type ident struct {
+	fn   bool
+	name string
+}
+
+// printed is the source of a unit with the names taken out
+type printed struct {
+	abstract []string  // lines, names replaced by markers
+	ids      [][]ident // names of each line in order
+}
+
+var (
+	reMarker   = regexp.MustCompile("\x00([0-9]+)\x00")
+	reAbstract = regexp.MustCompile("\x00[vf]\x00")
+)
+
+// printUnit prints a unit with every name replaced by a marker, the tree is
+// restored before returning
+func printUnit(n ast.Node) *printed {
+	var ids []ident
+	var restore []func()
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Variable:
+			name := n.Name
+			ids = append(ids, ident{false, name})
+			n.Name = fmt.Sprintf("\x00%d\x00", len(ids)-1)
+			restore = append(restore, func() { n.Name = name })
+		case *ast.FuncIdent:
+			if !n.Builtin {
+				name := n.Name
+				ids = append(ids, ident{true, name})
+				n.Name = fmt.Sprintf("\x00%d\x00", len(ids)-1)
+				restore = append(restore, func() { n.Name = name })
+			}
+		}
+		return true
+	})
+	p := ast.NewPrinter()
+	p.FuncComments = false
+	p.ExtraNewline = false
+	var buf bytes.Buffer
+	p.Fprint(&buf, n)
+	for _, f := range restore {
+		f()
+	}
+	ans := &printed{}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var lineIds []ident
+		line = reMarker.ReplaceAllStringFunc(line, func(m string) string {
+			i, _ := strconv.Atoi(m[1 : len(m)-1])
+			lineIds = append(lineIds, ids[i])
+			if ids[i].fn {
+				return "\x00f\x00"
+			}
+			return "\x00v\x00"
+		})
+		ans.abstract = append(ans.abstract, line)
+		ans.ids = append(ans.ids, lineIds)
+	}
+	return ans
+}
+
+// render puts the names back, translated by m
+func (p *printed) render(m map[ident]string) []string {
+	var ans []string
+	for i, line := range p.abstract {
+		k := 0
+		ans = append(ans, reAbstract.ReplaceAllStringFunc(line, func(string) string {
+			id := p.ids[i][k]
+			k++
+			name := id.name
+			if s, ok := m[ident{id.fn, strings.ToLower(id.name)}]; ok {
+				name = s
+			}
+			return name
+		}))
+	}
+	return ans
+}
+
+// bindings maps the old names of variables to the new ones, from the
+// lines that are the same once names are ignored. Each old name goes to
+// the new name it is most often paired with, one to one.
+func bindings(o, n *printed, funcs map[string]string) map[ident]string {
+	m := make(map[ident]string)
+	for k, v := range funcs {
+		m[ident{true, k}] = v
+	}
+	type pair struct{ old, new string }
+	votes := make(map[pair]int)
+	var order []pair
+	for _, e := range lcs(o.abstract, n.abstract, equal) {
+		a, b := o.ids[e[0]], n.ids[e[1]]
+		for i := range a {
+			if a[i].fn || b[i].fn {
+				continue
+			}
+			p := pair{strings.ToLower(a[i].name), b[i].name}
+			if votes[p] == 0 {
+				order = append(order, p)
+			}
+			votes[p]++
+		}
+	}
+	taken := make(map[string]bool)
+	for {
+		var best pair
+		most := 0
+		for _, p := range order {
+			if v := votes[p]; v > most && !taken[strings.ToLower(p.new)] {
+				if _, ok := m[ident{false, p.old}]; !ok {
+					best, most = p, v
+				}
+			}
+		}
+		if most == 0 {
+			break
+		}
+		m[ident{false, best.old}] = best.new
+		taken[strings.ToLower(best.new)] = true
+	}
+	return m
+}
+
+// body drops the Func and EndFunc lines
+func body(u *unit) []string {
+	if lines := u.text.abstract; len(lines) >= 2 {
+		return lines[1 : len(lines)-1]
+	}
+	return nil
+}
+
+func similarity(a, b []string) float64 {
+	if len(a)+len(b) == 0 {
+		return 0
+	}
+	return 2 * float64(len(lcs(a, b, equal))) / float64(len(a)+len(b))
+}
@@ -0,0 +1,65 @@
+package diff
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// WriteJSON writes the diff as indented JSON.
+func (d *Diff) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+// WriteText writes the diff in unified format, one section per added,
+// removed or modified function. Renamed functions get a single line.
+func (d *Diff) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range d.Funcs {
+		switch {
+		case f.Status == Unchanged && f.Old != f.New:
+			fmt.Fprintf(bw, "renamed %s -> %s\n", f.Old, f.New)
+			continue
+		case f.Status == Unchanged:
+			continue
+		}
+		from, to := "/dev/null", "/dev/null"
+		if f.Old != "" {
+			from = fmt.Sprintf("%s:%d", f.Old, f.OldLine)
+		}
+		if f.New != "" {
+			to = fmt.Sprintf("%s:%d", f.New, f.NewLine)
+		}
+		fmt.Fprintf(bw, "%s %s\n--- %s\n+++ %s\n", f.Status, name(f), from, to)
+		for _, h := range f.Hunks {
+			fmt.Fprintf(bw, "@@ -%d,%d +%d,%d @@\n", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+			for _, l := range h.Lines {
+				fmt.Fprintf(bw, "%s%s\n", l.Op, l.Text)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+func name(f *FuncDiff) string {
+	switch {
+	case f.Old == "":
+		return f.New
+	case f.New == "" || f.Old == f.New:
+		return f.Old
+	}
+	return f.Old + " -> " + f.New
+}
+
+// Changed reports whether any function was added, removed or modified.
+func (d *Diff) Changed() bool {
+	for _, f := range d.Funcs {
+		if f.Status != Unchanged {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package diff
+
+import "strings"
+
+// Context is the number of unchanged lines around each change.
+var Context = 3
+
+// maxCells bounds the table of lcs, larger inputs are compared as a
+// whole replacement past their common prefix and suffix
+const maxCells = 1 << 24
+
+type Line struct {
+	Op   string `json:"op"` // " ", "-" or "+"
+	Text string `json:"text"`
+}
+
+type Hunk struct {
+	OldStart int     `json:"old_start"` // 1-based, in the printed function
+	OldLines int     `json:"old_lines"`
+	NewStart int     `json:"new_start"`
+	NewLines int     `json:"new_lines"`
+	Lines    []*Line `json:"lines"`
+}
+
+func equal(a, b string) bool {
+	return strings.EqualFold(a, b)
+}
+
+// lcs returns the index pairs of a longest common subsequence of a and b
+func lcs(a, b []string, eq func(string, string) bool) [][2]int {
+	var ans [][2]int
+	pre := 0
+	for pre < len(a) && pre < len(b) && eq(a[pre], b[pre]) {
+		ans = append(ans, [2]int{pre, pre})
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && eq(a[len(a)-1-suf], b[len(b)-1-suf]) {
+		suf++
+	}
+	x, y := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	n, m := len(x), len(y)
+	if n > 0 && m > 0 && (n+1)*(m+1) <= maxCells {
+		// t[i][j] is the lcs length of x[i:] and y[j:]
+		t := make([]int32, (n+1)*(m+1))
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if eq(x[i], y[j]) {
+					t[i*(m+1)+j] = t[(i+1)*(m+1)+j+1] + 1
+				} else if l, r := t[(i+1)*(m+1)+j], t[i*(m+1)+j+1]; l >= r {
+					t[i*(m+1)+j] = l
+				} else {
+					t[i*(m+1)+j] = r
+				}
+			}
+		}
+		for i, j := 0, 0; i < n && j < m; {
+			switch {
+			case eq(x[i], y[j]):
+				ans = append(ans, [2]int{pre + i, pre + j})
+				i++
+				j++
+			case t[(i+1)*(m+1)+j] >= t[i*(m+1)+j+1]:
+				i++
+			default:
+				j++
+			}
+		}
+	}
+	for k := suf; k > 0; k-- {
+		ans = append(ans, [2]int{len(a) - k, len(b) - k})
+	}
+	return ans
+}
+
+// hunks diffs two lists of lines
+func hunks(a, b []string) []*Hunk {
+	var ops []*Line
+	var pos [][2]int // line numbers before each op
+	i, j := 0, 0
+	emit := func(op, text string) {
+		ops = append(ops, &Line{Op: op, Text: text})
+		pos = append(pos, [2]int{i, j})
+	}
+	for _, e := range append(lcs(a, b, equal), [2]int{len(a), len(b)}) {
+		for ; i < e[0]; i++ {
+			emit("-", a[i])
+		}
+		for ; j < e[1]; j++ {
+			emit("+", b[j])
+		}
+		if i < len(a) && j < len(b) {
+			emit(" ", b[j])
+			i++
+			j++
+		}
+	}
+
+	var ans []*Hunk
+	for k := 0; k < len(ops); {
+		if ops[k].Op == " " {
+			k++
+			continue
+		}
+		// grow the hunk while changes are within 2*Context lines
+		start := k - Context
+		if start < 0 {
+			start = 0
+		}
+		end, same := k, 0
+		for ; end < len(ops) && same <= 2*Context; end++ {
+			if ops[end].Op == " " {
+				same++
+			} else {
+				same = 0
+			}
+		}
+		if same > Context {
+			end -= same - Context
+		}
+		h := &Hunk{OldStart: pos[start][0] + 1, NewStart: pos[start][1] + 1}
+		for _, l := range ops[start:end] {
+			if l.Op != "+" {
+				h.OldLines++
+			}
+			if l.Op != "-" {
+				h.NewLines++
+			}
+			h.Lines = append(h.Lines, l)
+		}
+		ans = append(ans, h)
+		k = end
+	}
+	return ans
+}
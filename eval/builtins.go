@@ -0,0 +1,727 @@
+package eval
+
+// Builtins without side effects. Everything here only depends on its
+// arguments, so it is safe to run on code taken from a malware sample.
+
+import (
+	"encoding/hex"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+type Builtin func(args []Value) (Value, error)
+
+type builtin struct {
+	min, max int // max -1 for variadic
+	fn       Builtin
+}
+
+var builtins = map[string]builtin{
+	"abs":                  {1, 1, absFn},
+	"asc":                  {1, 1, asc},
+	"ascw":                 {1, 1, ascW},
+	"binary":               {1, 1, binary},
+	"binarylen":            {1, 1, binaryLen},
+	"binarymid":            {2, 3, binaryMid},
+	"binarytostring":       {1, 2, binaryToString},
+	"bitand":               {2, -1, bitAnd},
+	"bitnot":               {1, 1, bitNot},
+	"bitor":                {2, -1, bitOr},
+	"bitrotate":            {1, 3, bitRotate},
+	"bitshift":             {2, 2, bitShift},
+	"bitxor":               {2, -1, bitXor},
+	"ceiling":              {1, 1, ceiling},
+	"chr":                  {1, 1, chr},
+	"chrw":                 {1, 1, chrW},
+	"dec":                  {1, 2, dec},
+	"floor":                {1, 1, floor},
+	"hex":                  {1, 2, hexFn},
+	"int":                  {1, 2, intFn},
+	"isarray":              {1, 1, isKind(Array)},
+	"isbinary":             {1, 1, isKind(Binary)},
+	"isbool":               {1, 1, isKind(Bool)},
+	"isfloat":              {1, 1, isFloat},
+	"isint":                {1, 1, isInt},
+	"isnumber":             {1, 1, isNumber},
+	"isstring":             {1, 1, isKind(String)},
+	"mod":                  {2, 2, mod},
+	"number":               {1, 2, number},
+	"round":                {1, 2, round},
+	"sqrt":                 {1, 1, sqrt},
+	"string":               {1, 1, stringFn},
+	"stringaddcr":          {1, 1, stringAddCR},
+	"stringcompare":        {2, 3, stringCompare},
+	"stringfromasciiarray": {1, 4, stringFromASCIIArray},
+	"stringinstr":          {2, 6, stringInStr},
+	"stringleft":           {2, 2, stringLeft},
+	"stringlen":            {1, 1, stringLen},
+	"stringlower":          {1, 1, stringLower},
+	"stringmid":            {2, 3, stringMid},
+	"stringregexpreplace":  {3, 4, stringRegExpReplace},
+	"stringreplace":        {3, 5, stringReplace},
+	"stringreverse":        {1, 2, stringReverse},
+	"stringright":          {2, 2, stringRight},
+	"stringsplit":          {2, 3, stringSplit},
+	"stringstripws":        {2, 2, stringStripWS},
+	"stringtoasciiarray":   {1, 4, stringToASCIIArray},
+	"stringtobinary":       {1, 2, stringToBinary},
+	"stringtrimleft":       {2, 2, stringTrimLeft},
+	"stringtrimright":      {2, 2, stringTrimRight},
+	"stringupper":          {1, 1, stringUpper},
+	"ubound":               {1, 2, ubound},
+	"vargettype":           {1, 1, varGetType},
+}
+
+// IsPure reports whether a builtin can be evaluated here.
+func IsPure(name string) bool {
+	_, ok := builtins[strings.ToLower(name)]
+	return ok
+}
+
+// Call runs a pure builtin.
+func Call(name string, args []Value) (Value, error) {
+	b, ok := builtins[strings.ToLower(name)]
+	if !ok {
+		return Value{}, ErrUnsupported
+	}
+	if len(args) < b.min || b.max >= 0 && len(args) > b.max {
+		return Value{}, ErrArgs
+	}
+	return b.fn(args)
+}
+
+// opt returns the optional argument i, def when absent or Default
+func opt(args []Value, i int, def Value) Value {
+	if i >= len(args) || args[i].kind == Keyword && strings.EqualFold(args[i].s, "Default") {
+		return def
+	}
+	return args[i]
+}
+
+func runes(v Value) []rune {
+	return []rune(v.Str())
+}
+
+func clamp(n, lo, hi int) int {
+	if n < lo {
+		return lo
+	}
+	if n > hi {
+		return hi
+	}
+	return n
+}
+
+func absFn(args []Value) (Value, error) {
+	n := args[0].Number()
+	if n.kind == Int {
+		if n.i < 0 {
+			return IntValue(-n.i), nil
+		}
+		return n, nil
+	}
+	return FloatValue(math.Abs(n.f)), nil
+}
+
+func asc(args []Value) (Value, error) {
+	b := toANSI(args[0].Str())
+	if len(b) == 0 {
+		return IntValue(0), nil
+	}
+	return IntValue(int64(b[0])), nil
+}
+
+func ascW(args []Value) (Value, error) {
+	r := runes(args[0])
+	if len(r) == 0 {
+		return IntValue(0), nil
+	}
+	return IntValue(int64(r[0])), nil
+}
+
+func chr(args []Value) (Value, error) {
+	n := args[0].Int64()
+	if n < 0 || n > 255 {
+		return StringValue(""), nil
+	}
+	return StringValue(fromANSI([]byte{byte(n)})), nil
+}
+
+func chrW(args []Value) (Value, error) {
+	n := args[0].Int64()
+	if n < 0 || n > 0xffff {
+		return StringValue(""), nil
+	}
+	return StringValue(string(rune(n))), nil
+}
+
+func binary(args []Value) (Value, error) {
+	return BinaryValue(args[0].Bytes()), nil
+}
+
+func binaryLen(args []Value) (Value, error) {
+	return IntValue(int64(len(args[0].Bytes()))), nil
+}
+
+func binaryMid(args []Value) (Value, error) {
+	b := args[0].Bytes()
+	start := clamp(int(args[1].Int64())-1, 0, len(b))
+	end := len(b)
+	if n := opt(args, 2, IntValue(-1)).Int64(); n >= 0 {
+		end = clamp(start+int(n), start, len(b))
+	}
+	return BinaryValue(b[start:end]), nil
+}
+
+// decodeString converts bytes to a string using the flag of
+// BinaryToString: 1 ANSI, 2 UTF-16 LE, 3 UTF-16 BE, 4 UTF-8
+func decodeString(b []byte, flag int64) string {
+	switch flag {
+	case 2, 3:
+		u := make([]uint16, len(b)/2)
+		for i := range u {
+			if flag == 2 {
+				u[i] = uint16(b[2*i]) | uint16(b[2*i+1])<<8
+			} else {
+				u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+			}
+		}
+		return strings.TrimRight(string(utf16.Decode(u)), "\x00")
+	case 4:
+		if utf8.Valid(b) {
+			return strings.TrimRight(string(b), "\x00")
+		}
+	}
+	if i := strings.IndexByte(string(b), 0); i >= 0 {
+		b = b[:i]
+	}
+	return fromANSI(b)
+}
+
+func binaryToString(args []Value) (Value, error) {
+	return StringValue(decodeString(args[0].Bytes(), opt(args, 1, IntValue(1)).Int64())), nil
+}
+
+func stringToBinary(args []Value) (Value, error) {
+	s := args[0].Str()
+	switch opt(args, 1, IntValue(1)).Int64() {
+	case 2, 3:
+		be := opt(args, 1, IntValue(1)).Int64() == 3
+		var b []byte
+		for _, u := range utf16.Encode([]rune(s)) {
+			if be {
+				b = append(b, byte(u>>8), byte(u))
+			} else {
+				b = append(b, byte(u), byte(u>>8))
+			}
+		}
+		return BinaryValue(b), nil
+	case 4:
+		return BinaryValue([]byte(s)), nil
+	}
+	return BinaryValue(toANSI(s)), nil
+}
+
+// bitArgs converts the arguments of the Bit* functions, which work on
+// 32 bits unless a value needs 64
+func bitArgs(args []Value) ([]int64, bool) {
+	wide := false
+	ns := make([]int64, len(args))
+	for i, a := range args {
+		ns[i] = a.Int64()
+		if ns[i] != int64(int32(ns[i])) && ns[i] != int64(uint32(ns[i])) {
+			wide = true
+		}
+	}
+	return ns, wide
+}
+
+func bitResult(n int64, wide bool) Value {
+	if wide {
+		return IntValue(n)
+	}
+	return IntValue(int64(int32(n)))
+}
+
+func bitAnd(args []Value) (Value, error) {
+	ns, wide := bitArgs(args)
+	r := ns[0]
+	for _, n := range ns[1:] {
+		r &= n
+	}
+	return bitResult(r, wide), nil
+}
+
+func bitOr(args []Value) (Value, error) {
+	ns, wide := bitArgs(args)
+	r := ns[0]
+	for _, n := range ns[1:] {
+		r |= n
+	}
+	return bitResult(r, wide), nil
+}
+
+func bitXor(args []Value) (Value, error) {
+	ns, wide := bitArgs(args)
+	r := ns[0]
+	for _, n := range ns[1:] {
+		r ^= n
+	}
+	return bitResult(r, wide), nil
+}
+
+func bitNot(args []Value) (Value, error) {
+	ns, wide := bitArgs(args)
+	return bitResult(^ns[0], wide), nil
+}
+
+// BitShift shifts right for positive counts, left for negative ones
+func bitShift(args []Value) (Value, error) {
+	n := uint32(args[0].Int64())
+	s := args[1].Int64()
+	if s >= 0 {
+		return IntValue(int64(int32(n >> uint(s&31)))), nil
+	}
+	return IntValue(int64(int32(n << uint(-s&31)))), nil
+}
+
+func bitRotate(args []Value) (Value, error) {
+	n := uint64(args[0].Int64())
+	s := opt(args, 1, IntValue(1)).Int64()
+	size := uint(16)
+	switch strings.ToUpper(opt(args, 2, StringValue("W")).Str()) {
+	case "B":
+		size = 8
+	case "D":
+		size = 32
+	case "Q":
+		size = 64
+	}
+	mask := uint64(1)<<size - 1
+	if size == 64 {
+		mask = ^uint64(0)
+	}
+	n &= mask
+	// positive counts rotate left
+	k := uint(((s % int64(size)) + int64(size)) % int64(size))
+	r := (n<<k | n>>(size-k)) & mask
+	if size == 32 {
+		return IntValue(int64(int32(r))), nil
+	}
+	return IntValue(int64(r)), nil
+}
+
+func ceiling(args []Value) (Value, error) {
+	return IntValue(int64(math.Ceil(args[0].Float64()))), nil
+}
+
+func floor(args []Value) (Value, error) {
+	return IntValue(int64(math.Floor(args[0].Float64()))), nil
+}
+
+func dec(args []Value) (Value, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(args[0].Str(), "0x"), "0X")
+	var n uint64
+	for _, c := range strings.ToLower(s) {
+		d := strings.IndexRune("0123456789abcdef", c)
+		if d < 0 {
+			return IntValue(0), nil
+		}
+		n = n<<4 | uint64(d)
+	}
+	if opt(args, 1, IntValue(0)).Int64() == 0 && n <= math.MaxUint32 {
+		return IntValue(int64(int32(n))), nil
+	}
+	return IntValue(int64(n)), nil
+}
+
+func hexFn(args []Value) (Value, error) {
+	v := args[0]
+	var s string
+	switch v.kind {
+	case Binary, String:
+		s = strings.ToUpper(hex.EncodeToString(v.Bytes()))
+		if v.kind == Binary {
+			return StringValue(s), nil
+		}
+	default:
+		n := v.Int64()
+		width := 8
+		if n != int64(int32(n)) {
+			width = 16
+		}
+		if len(args) > 1 {
+			width = clamp(int(args[1].Int64()), 1, 16)
+		}
+		s = strings.ToUpper(hex.EncodeToString([]byte{
+			byte(n >> 56), byte(n >> 48), byte(n >> 40), byte(n >> 32),
+			byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n),
+		}))
+		s = s[16-width:]
+	}
+	return StringValue(s), nil
+}
+
+func intFn(args []Value) (Value, error) {
+	return IntValue(args[0].Int64()), nil
+}
+
+func isKind(k Kind) Builtin {
+	return func(args []Value) (Value, error) {
+		return BoolValue(args[0].kind == k), nil
+	}
+}
+
+func isFloat(args []Value) (Value, error) {
+	n := args[0]
+	if n.kind == String {
+		n = parseNumber(n.s)
+	}
+	return BoolValue(n.kind == Float && n.f != math.Trunc(n.f)), nil
+}
+
+func isInt(args []Value) (Value, error) {
+	n := args[0]
+	return BoolValue(n.kind == Int || n.kind == Float && n.f == math.Trunc(n.f)), nil
+}
+
+func isNumber(args []Value) (Value, error) {
+	return BoolValue(args[0].IsNumber()), nil
+}
+
+func mod(args []Value) (Value, error) {
+	a, b := args[0].Number(), args[1].Number()
+	if a.kind == Int && b.kind == Int {
+		if b.i == 0 {
+			return Value{}, ErrDivByZero
+		}
+		return IntValue(a.i % b.i), nil
+	}
+	if b.Float64() == 0 {
+		return Value{}, ErrDivByZero
+	}
+	return FloatValue(math.Mod(a.Float64(), b.Float64())), nil
+}
+
+func number(args []Value) (Value, error) {
+	return args[0].Number(), nil
+}
+
+func round(args []Value) (Value, error) {
+	d := opt(args, 1, IntValue(0)).Int64()
+	p := math.Pow(10, float64(d))
+	f := math.Round(args[0].Float64()*p) / p
+	if d <= 0 {
+		return IntValue(int64(f)), nil
+	}
+	return FloatValue(f), nil
+}
+
+func sqrt(args []Value) (Value, error) {
+	return FloatValue(math.Sqrt(args[0].Float64())), nil
+}
+
+func stringFn(args []Value) (Value, error) {
+	return StringValue(args[0].Str()), nil
+}
+
+func stringAddCR(args []Value) (Value, error) {
+	s := strings.Replace(args[0].Str(), "\r\n", "\n", -1)
+	return StringValue(strings.Replace(s, "\n", "\r\n", -1)), nil
+}
+
+func stringCompare(args []Value) (Value, error) {
+	a, b := args[0].Str(), args[1].Str()
+	if opt(args, 2, IntValue(0)).Int64() != 1 {
+		a, b = strings.ToLower(a), strings.ToLower(b)
+	}
+	return IntValue(int64(strings.Compare(a, b))), nil
+}
+
+func stringFromASCIIArray(args []Value) (Value, error) {
+	if args[0].kind != Array {
+		return StringValue(""), nil
+	}
+	elems := args[0].arr
+	start := clamp(int(opt(args, 1, IntValue(0)).Int64()), 0, len(elems))
+	end := len(elems)
+	if e := opt(args, 2, IntValue(-1)).Int64(); e >= 0 {
+		end = clamp(int(e)+1, start, len(elems))
+	}
+	var sb strings.Builder
+	ansi := opt(args, 3, IntValue(0)).Int64() == 1
+	for _, e := range elems[start:end] {
+		n := e.Int64()
+		if n == 0 {
+			break
+		}
+		if ansi {
+			sb.WriteString(fromANSI([]byte{byte(n)}))
+		} else {
+			sb.WriteRune(rune(n))
+		}
+	}
+	return StringValue(sb.String()), nil
+}
+
+func stringToASCIIArray(args []Value) (Value, error) {
+	r := runes(args[0])
+	start := clamp(int(opt(args, 1, IntValue(0)).Int64()), 0, len(r))
+	end := len(r)
+	if n := opt(args, 2, IntValue(-1)).Int64(); n >= 0 {
+		end = clamp(start+int(n), start, len(r))
+	}
+	var ans []Value
+	if opt(args, 3, IntValue(0)).Int64() == 1 {
+		for _, b := range toANSI(string(r[start:end])) {
+			ans = append(ans, IntValue(int64(b)))
+		}
+	} else {
+		for _, c := range r[start:end] {
+			ans = append(ans, IntValue(int64(c)))
+		}
+	}
+	return ArrayValue(ans), nil
+}
+
+func stringInStr(args []Value) (Value, error) {
+	s, sub := args[0].Str(), args[1].Str()
+	if opt(args, 2, IntValue(0)).Int64() != 1 {
+		s, sub = strings.ToLower(s), strings.ToLower(sub)
+	}
+	occ := opt(args, 3, IntValue(1)).Int64()
+	rs := []rune(s)
+	start := clamp(int(opt(args, 4, IntValue(1)).Int64())-1, 0, len(rs))
+	if occ <= 0 || sub == "" {
+		// searching backwards isn't needed by the obfuscators seen so far
+		return Value{}, ErrUnsupported
+	}
+	rest := string(rs[start:])
+	pos := start
+	for {
+		i := strings.Index(rest, sub)
+		if i < 0 {
+			return IntValue(0), nil
+		}
+		n := utf8.RuneCountInString(rest[:i])
+		occ--
+		if occ == 0 {
+			return IntValue(int64(pos + n + 1)), nil
+		}
+		pos += n + 1
+		_, size := utf8.DecodeRuneInString(rest[i:])
+		rest = rest[i+size:]
+	}
+}
+
+func stringLeft(args []Value) (Value, error) {
+	r := runes(args[0])
+	n := clamp(int(args[1].Int64()), 0, len(r))
+	return StringValue(string(r[:n])), nil
+}
+
+func stringRight(args []Value) (Value, error) {
+	r := runes(args[0])
+	n := clamp(int(args[1].Int64()), 0, len(r))
+	return StringValue(string(r[len(r)-n:])), nil
+}
+
+func stringLen(args []Value) (Value, error) {
+	return IntValue(int64(len(runes(args[0])))), nil
+}
+
+func stringLower(args []Value) (Value, error) {
+	return StringValue(strings.ToLower(args[0].Str())), nil
+}
+
+func stringUpper(args []Value) (Value, error) {
+	return StringValue(strings.ToUpper(args[0].Str())), nil
+}
+
+func stringMid(args []Value) (Value, error) {
+	r := runes(args[0])
+	start := int(args[1].Int64())
+	if start < 1 || start > len(r) {
+		return StringValue(""), nil
+	}
+	end := len(r)
+	if n := opt(args, 2, IntValue(-1)).Int64(); n >= 0 {
+		end = clamp(start-1+int(n), start-1, len(r))
+	}
+	return StringValue(string(r[start-1 : end])), nil
+}
+
+var pcreBackref = regexp.MustCompile(`\\(\d)|\$(\d)`)
+
+func stringRegExpReplace(args []Value) (Value, error) {
+	re, err := regexp.Compile(args[1].Str())
+	if err != nil {
+		// a PCRE feature RE2 lacks
+		return Value{}, ErrUnsupported
+	}
+	repl := pcreBackref.ReplaceAllString(args[2].Str(), "$${$1$2}")
+	count := opt(args, 3, IntValue(0)).Int64()
+	if count <= 0 {
+		return StringValue(re.ReplaceAllString(args[0].Str(), repl)), nil
+	}
+	s := args[0].Str()
+	var sb strings.Builder
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(s, int(count)) {
+		sb.WriteString(s[last:m[0]])
+		sb.Write(re.ExpandString(nil, repl, s, m))
+		last = m[1]
+	}
+	sb.WriteString(s[last:])
+	return StringValue(sb.String()), nil
+}
+
+func stringReplace(args []Value) (Value, error) {
+	s := args[0].Str()
+	repl := args[2].Str()
+	if args[1].IsNumber() {
+		// replace characters from a position
+		r := []rune(s)
+		pos := int(args[1].Int64()) - 1
+		if pos < 0 || pos >= len(r) {
+			return StringValue(s), nil
+		}
+		nr := []rune(repl)
+		end := clamp(pos+len(nr), pos, len(r))
+		return StringValue(string(r[:pos]) + repl + string(r[end:])), nil
+	}
+	search := args[1].Str()
+	if search == "" {
+		return StringValue(s), nil
+	}
+	occ := int(opt(args, 3, IntValue(0)).Int64())
+	if occ < 0 {
+		return Value{}, ErrUnsupported
+	}
+	if occ == 0 {
+		occ = -1
+	}
+	if opt(args, 4, IntValue(0)).Int64() == 1 {
+		return StringValue(strings.Replace(s, search, repl, occ)), nil
+	}
+	// case insensitive
+	var sb strings.Builder
+	lower, lsearch := strings.ToLower(s), strings.ToLower(search)
+	for occ != 0 {
+		i := strings.Index(lower, lsearch)
+		if i < 0 || len(lower) != len(s) {
+			break
+		}
+		sb.WriteString(s[:i])
+		sb.WriteString(repl)
+		s, lower = s[i+len(search):], lower[i+len(search):]
+		occ--
+	}
+	sb.WriteString(s)
+	return StringValue(sb.String()), nil
+}
+
+func stringReverse(args []Value) (Value, error) {
+	r := runes(args[0])
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return StringValue(string(r)), nil
+}
+
+func stringSplit(args []Value) (Value, error) {
+	s, delims := args[0].Str(), args[1].Str()
+	flag := opt(args, 2, IntValue(0)).Int64()
+	var parts []string
+	switch {
+	case delims == "":
+		for _, r := range s {
+			parts = append(parts, string(r))
+		}
+	case flag&1 != 0:
+		parts = strings.Split(s, delims)
+	default:
+		parts = splitAny(s, delims)
+	}
+	var ans []Value
+	if flag&2 == 0 {
+		ans = append(ans, IntValue(int64(len(parts))))
+	}
+	for _, p := range parts {
+		ans = append(ans, StringValue(p))
+	}
+	return ArrayValue(ans), nil
+}
+
+// splitAny splits on any of the delimiters, keeping empty fields
+func splitAny(s, delims string) []string {
+	var parts []string
+	last := 0
+	for i, r := range s {
+		if strings.ContainsRune(delims, r) {
+			parts = append(parts, s[last:i])
+			last = i + utf8.RuneLen(r)
+		}
+	}
+	return append(parts, s[last:])
+}
+
+func stringStripWS(args []Value) (Value, error) {
+	s := args[0].Str()
+	flag := args[1].Int64()
+	const ws = " \t\n\v\f\r\x00"
+	if flag&8 != 0 {
+		return StringValue(strings.Map(func(r rune) rune {
+			if strings.ContainsRune(ws, r) {
+				return -1
+			}
+			return r
+		}, s)), nil
+	}
+	if flag&1 != 0 {
+		s = strings.TrimLeft(s, ws)
+	}
+	if flag&2 != 0 {
+		s = strings.TrimRight(s, ws)
+	}
+	if flag&4 != 0 {
+		for strings.Contains(s, "  ") {
+			s = strings.Replace(s, "  ", " ", -1)
+		}
+	}
+	return StringValue(s), nil
+}
+
+func stringTrimLeft(args []Value) (Value, error) {
+	r := runes(args[0])
+	n := clamp(int(args[1].Int64()), 0, len(r))
+	return StringValue(string(r[n:])), nil
+}
+
+func stringTrimRight(args []Value) (Value, error) {
+	r := runes(args[0])
+	n := clamp(int(args[1].Int64()), 0, len(r))
+	return StringValue(string(r[:len(r)-n])), nil
+}
+
+func ubound(args []Value) (Value, error) {
+	if args[0].kind != Array {
+		return IntValue(0), nil
+	}
+	// only the first dimension of arrays is modelled
+	if opt(args, 1, IntValue(1)).Int64() != 1 {
+		return Value{}, ErrUnsupported
+	}
+	return IntValue(int64(len(args[0].arr))), nil
+}
+
+func varGetType(args []Value) (Value, error) {
+	v := args[0]
+	if v.kind == Int && v.i == int64(int32(v.i)) {
+		return StringValue("Int32"), nil
+	}
+	return StringValue(v.kind.String()), nil
+}
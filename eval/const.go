@@ -0,0 +1,168 @@
+package eval
+
+import (
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/lexer"
+	"strconv"
+	"strings"
+)
+
+// constant macros
+var macros = map[string]string{
+	"cr":   "\r",
+	"lf":   "\n",
+	"crlf": "\r\n",
+	"tab":  "\t",
+}
+
+// Literal returns the value of a literal, including True, False and
+// the constant macros.
+func Literal(x ast.Expr) (Value, bool) {
+	switch x := x.(type) {
+	case *ast.BasicLit:
+		switch x.Kind {
+		case lexer.StrLit:
+			return StringValue(x.Value), true
+		case lexer.Float64:
+			f, err := strconv.ParseFloat(x.Value, 64)
+			return FloatValue(f), err == nil
+		default:
+			v := parseNumber(x.Value)
+			return v, true
+		}
+	case *ast.KeywordLit:
+		switch strings.ToLower(x.Name) {
+		case "true":
+			return BoolValue(true), true
+		case "false":
+			return BoolValue(false), true
+		}
+		return KeywordValue(x.Name), true
+	case *ast.MacroExpr:
+		s, ok := macros[strings.ToLower(x.Name)]
+		return StringValue(s), ok
+	}
+	return Value{}, false
+}
+
+// Const evaluates an expression made of literals, operators and pure
+// builtins.
+func Const(x ast.Expr) (Value, error) {
+	if v, ok := Literal(x); ok {
+		return v, nil
+	}
+	switch x := x.(type) {
+	case *ast.ParenExpr:
+		return Const(x.X)
+	case *ast.UnaryExpr:
+		v, err := Const(x.X)
+		if err != nil {
+			return v, err
+		}
+		return UnaryOp(x.Op, v)
+	case *ast.BinaryExpr:
+		a, err := Const(x.X)
+		if err != nil {
+			return a, err
+		}
+		// And/Or short circuit like AutoIt
+		if x.Op == lexer.OpAnd && !a.Truth() {
+			return BoolValue(false), nil
+		}
+		if x.Op == lexer.OpOr && a.Truth() {
+			return BoolValue(true), nil
+		}
+		b, err := Const(x.Y)
+		if err != nil {
+			return b, err
+		}
+		return BinaryOp(x.Op, a, b)
+	case *ast.TernaryExpr:
+		c, err := Const(x.Cond)
+		if err != nil {
+			return c, err
+		}
+		if c.Truth() {
+			return Const(x.Then)
+		}
+		return Const(x.Else)
+	case *ast.CallExpr:
+		if !x.IsBuiltin() || !IsPure(x.CalleeName()) {
+			return Value{}, ErrNotConstant
+		}
+		args := make([]Value, len(x.Args))
+		for i, a := range x.Args {
+			v, err := Const(a)
+			if err != nil {
+				return v, err
+			}
+			args[i] = v
+		}
+		return Call(x.CalleeName(), args)
+	case *ast.ArrayLit:
+		elems := make([]Value, len(x.Elts))
+		for i, e := range x.Elts {
+			v, err := Const(e)
+			if err != nil {
+				return v, err
+			}
+			elems[i] = v
+		}
+		return ArrayValue(elems), nil
+	case *ast.IndexExpr:
+		arr, err := Const(x.X)
+		if err != nil {
+			return arr, err
+		}
+		idx, err := Const(x.Index)
+		if err != nil {
+			return idx, err
+		}
+		return Index(arr, idx)
+	}
+	return Value{}, ErrNotConstant
+}
+
+// Index returns an element of an array.
+func Index(arr, idx Value) (Value, error) {
+	if arr.kind != Array {
+		return Value{}, ErrUnsupported
+	}
+	i := idx.Int64()
+	if i < 0 || i >= int64(len(arr.arr)) {
+		return Value{}, ErrIndex
+	}
+	return arr.arr[i], nil
+}
+
+// Expr converts a value back to an expression, false for arrays and
+// keywords other than True and False.
+func Expr(v Value) (ast.Expr, bool) {
+	switch v.kind {
+	case String:
+		return &ast.BasicLit{Kind: lexer.StrLit, Value: v.s}, true
+	case Int:
+		kind := lexer.Int32
+		if v.i != int64(int32(v.i)) {
+			kind = lexer.Int64
+		}
+		if v.i < 0 {
+			return &ast.UnaryExpr{Op: lexer.OpSub, X: &ast.BasicLit{Kind: kind, Value: strconv.FormatInt(-v.i, 10)}}, true
+		}
+		return &ast.BasicLit{Kind: kind, Value: strconv.FormatInt(v.i, 10)}, true
+	case Float:
+		s := strconv.FormatFloat(v.f, 'g', -1, 64)
+		if v.f < 0 {
+			return &ast.UnaryExpr{Op: lexer.OpSub, X: &ast.BasicLit{Kind: lexer.Float64, Value: s[1:]}}, true
+		}
+		return &ast.BasicLit{Kind: lexer.Float64, Value: s}, true
+	case Bool:
+		return &ast.KeywordLit{Name: v.Str()}, true
+	case Binary:
+		return &ast.CallExpr{
+			Fun:  &ast.FuncIdent{Name: "Binary", Builtin: true},
+			Args: []ast.Expr{&ast.BasicLit{Kind: lexer.StrLit, Value: v.Str()}},
+		}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,493 @@
+package eval
+
+import (
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/lexer"
+	"strings"
+)
+
+type ctlKind int
+
+const (
+	ctlNone ctlKind = iota
+	ctlExitLoop
+	ctlContinueLoop
+	ctlContinueCase
+	ctlReturn
+)
+
+// control is how a statement left: normally, or through a branch that
+// has to unwind level loops
+type control struct {
+	kind  ctlKind
+	level int
+}
+
+var normal = control{}
+
+func isStdFunction(name string) bool {
+	for _, f := range lexer.Au3StdFunctions {
+		if strings.EqualFold(f, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (in *Interpreter) block(b *ast.BlockStmt) (control, error) {
+	if b == nil {
+		return normal, nil
+	}
+	for _, s := range b.List {
+		ctl, err := in.exec(s)
+		if err != nil || ctl.kind != ctlNone {
+			return ctl, err
+		}
+	}
+	return normal, nil
+}
+
+// loopCtl handles a branch reaching a loop, brk tells whether the
+// loop has to stop
+func loopCtl(ctl control) (out control, brk bool) {
+	switch ctl.kind {
+	case ctlExitLoop:
+		if ctl.level > 1 {
+			return control{ctlExitLoop, ctl.level - 1}, true
+		}
+		return normal, true
+	case ctlContinueLoop:
+		if ctl.level > 1 {
+			return control{ctlContinueLoop, ctl.level - 1}, true
+		}
+		return normal, false
+	case ctlReturn:
+		return ctl, true
+	}
+	return normal, false
+}
+
+func (in *Interpreter) exec(s ast.Stmt) (control, error) {
+	if err := in.step(s); err != nil {
+		return normal, err
+	}
+	switch s := s.(type) {
+	case *ast.DirectiveStmt, *ast.CommentStmt:
+		return normal, nil
+
+	case *ast.ExprStmt:
+		_, err := in.expr(s.X)
+		return normal, err
+
+	case *ast.DeclStmt:
+		return normal, in.decl(s)
+
+	case *ast.EnumStmt:
+		return normal, in.enum(s)
+
+	case *ast.AssignStmt:
+		return normal, in.assign(s)
+
+	case *ast.ReDimStmt:
+		return normal, in.redim(s)
+
+	case *ast.BlockStmt:
+		return in.block(s)
+
+	case *ast.IfStmt:
+		c, err := in.expr(s.Cond)
+		if err != nil {
+			return normal, err
+		}
+		if c.Truth() {
+			return in.block(s.Body)
+		}
+		if s.Else != nil {
+			return in.exec(s.Else)
+		}
+		return normal, nil
+
+	case *ast.WhileStmt:
+		for {
+			c, err := in.expr(s.Cond)
+			if err != nil || !c.Truth() {
+				return normal, err
+			}
+			ctl, err := in.block(s.Body)
+			if err != nil {
+				return normal, err
+			}
+			if ctl, brk := loopCtl(ctl); brk {
+				return ctl, nil
+			}
+			if err := in.step(s); err != nil {
+				return normal, err
+			}
+		}
+
+	case *ast.DoStmt:
+		for {
+			ctl, err := in.block(s.Body)
+			if err != nil {
+				return normal, err
+			}
+			if ctl, brk := loopCtl(ctl); brk {
+				return ctl, nil
+			}
+			c, err := in.expr(s.Cond)
+			if err != nil || c.Truth() {
+				return normal, err
+			}
+		}
+
+	case *ast.ForStmt:
+		return in.forLoop(s)
+
+	case *ast.ForInStmt:
+		coll, err := in.expr(s.X)
+		if err != nil {
+			return normal, err
+		}
+		if coll.kind != Array {
+			return normal, in.fail(s, ErrUnsupported, "For...In over %s", coll.kind)
+		}
+		for _, e := range coll.arr {
+			if err := in.assignVar(s.Var, e); err != nil {
+				return normal, err
+			}
+			ctl, err := in.block(s.Body)
+			if err != nil {
+				return normal, err
+			}
+			if ctl, brk := loopCtl(ctl); brk {
+				return ctl, nil
+			}
+		}
+		return normal, nil
+
+	case *ast.SelectStmt:
+		for _, c := range s.Cases {
+			match := c.List == nil
+			for _, x := range c.List {
+				v, err := in.expr(x)
+				if err != nil {
+					return normal, err
+				}
+				match = match || v.Truth()
+			}
+			if match {
+				return in.caseBody(c)
+			}
+		}
+		return normal, nil
+
+	case *ast.SwitchStmt:
+		tag, err := in.expr(s.Tag)
+		if err != nil {
+			return normal, err
+		}
+		for _, c := range s.Cases {
+			match := c.List == nil
+			for _, x := range c.List {
+				ok, err := in.caseMatch(tag, x)
+				if err != nil {
+					return normal, err
+				}
+				match = match || ok
+			}
+			if match {
+				return in.caseBody(c)
+			}
+		}
+		return normal, nil
+
+	case *ast.ReturnStmt:
+		if in.frame == nil {
+			return normal, in.fail(s, ErrUnsupported, "Return outside a function")
+		}
+		if s.Result != nil {
+			v, err := in.expr(s.Result)
+			if err != nil {
+				return normal, err
+			}
+			in.frame.ret = copyValue(v)
+		}
+		return control{kind: ctlReturn}, nil
+
+	case *ast.ExitStmt:
+		return normal, in.fail(s, ErrExit, "")
+
+	case *ast.BranchStmt:
+		level := 1
+		if s.Level != nil {
+			v, err := in.expr(s.Level)
+			if err != nil {
+				return normal, err
+			}
+			level = int(v.Int64())
+		}
+		switch strings.ToLower(s.Tok) {
+		case "exitloop":
+			return control{ctlExitLoop, level}, nil
+		case "continueloop":
+			return control{ctlContinueLoop, level}, nil
+		}
+		return control{kind: ctlContinueCase}, nil
+
+	case *ast.FuncDecl:
+		return normal, nil
+	}
+	return normal, in.fail(s, ErrUnsupported, "%T", s)
+}
+
+// caseBody runs a Case, ContinueCase isn't supported and stops
+func (in *Interpreter) caseBody(c *ast.CaseClause) (control, error) {
+	ctl, err := in.block(c.Body)
+	if err == nil && ctl.kind == ctlContinueCase {
+		return normal, in.fail(c, ErrUnsupported, "ContinueCase")
+	}
+	return ctl, err
+}
+
+func (in *Interpreter) caseMatch(tag Value, x ast.Expr) (bool, error) {
+	if r, ok := x.(*ast.RangeExpr); ok {
+		lo, err := in.expr(r.From)
+		if err != nil {
+			return false, err
+		}
+		hi, err := in.expr(r.To)
+		if err != nil {
+			return false, err
+		}
+		return compare(tag, lo) >= 0 && compare(tag, hi) <= 0, nil
+	}
+	v, err := in.expr(x)
+	if err != nil {
+		return false, err
+	}
+	return compare(tag, v) == 0, nil
+}
+
+func (in *Interpreter) forLoop(s *ast.ForStmt) (control, error) {
+	from, err := in.expr(s.From)
+	if err != nil {
+		return normal, err
+	}
+	to, err := in.expr(s.To)
+	if err != nil {
+		return normal, err
+	}
+	step := IntValue(1)
+	if s.Step != nil {
+		if step, err = in.expr(s.Step); err != nil {
+			return normal, err
+		}
+	}
+	from, to, step = from.Number(), to.Number(), step.Number()
+	cur := from
+	for {
+		c := compare(cur, to)
+		if step.Float64() >= 0 && c > 0 || step.Float64() < 0 && c < 0 {
+			return normal, nil
+		}
+		if err := in.assignVar(s.Var, cur); err != nil {
+			return normal, err
+		}
+		ctl, err := in.block(s.Body)
+		if err != nil {
+			return normal, err
+		}
+		if ctl, brk := loopCtl(ctl); brk {
+			return ctl, nil
+		}
+		// the body may change the counter
+		p, _ := in.lookup(s.Var.Name)
+		if cur, err = BinaryOp(lexer.OpAdd, p.Number(), step); err != nil {
+			return normal, err
+		}
+		if err := in.step(s); err != nil {
+			return normal, err
+		}
+	}
+}
+
+// newArray builds an array with the given dimensions
+func (in *Interpreter) newArray(n ast.Node, dims []ast.Expr) (Value, error) {
+	if len(dims) == 0 {
+		return Value{}, nil
+	}
+	d, err := in.expr(dims[0])
+	if err != nil {
+		return d, err
+	}
+	size := d.Int64()
+	if size < 0 || in.limits.MaxLen > 0 && size > int64(in.limits.MaxLen) {
+		return Value{}, in.fail(n, ErrTooLarge, "array of %d elements", size)
+	}
+	arr := make([]Value, size)
+	for i := range arr {
+		if arr[i], err = in.newArray(n, dims[1:]); err != nil {
+			return Value{}, err
+		}
+	}
+	return ArrayValue(arr), nil
+}
+
+func (in *Interpreter) decl(d *ast.DeclStmt) error {
+	global := strings.EqualFold(d.Scope, "Global")
+	for _, spec := range d.Specs {
+		key := strings.ToLower(spec.Name.Name)
+		if d.Static && in.frame != nil {
+			statics := in.statics[in.frame.fn]
+			if statics == nil {
+				statics = make(map[string]*Value)
+				in.statics[in.frame.fn] = statics
+			}
+			if p, ok := statics[key]; ok {
+				// initialized on the first run only
+				in.frame.vars[key] = p
+				continue
+			}
+		}
+		if global && in.limits.ReadOnly {
+			return in.fail(spec, ErrImpure, "declaration of global $%s", spec.Name.Name)
+		}
+
+		v, err := in.newArray(spec, spec.Dims)
+		if err != nil {
+			return err
+		}
+		if spec.Value != nil {
+			init, err := in.expr(spec.Value)
+			if err != nil {
+				return err
+			}
+			if len(spec.Dims) > 0 && init.kind == Array {
+				// an initializer may be shorter than the array
+				copy(v.arr, init.arr)
+			} else {
+				v = init
+			}
+		}
+		if strings.EqualFold(d.Scope, "Dim") && in.frame != nil {
+			if _, ok := in.frame.vars[key]; !ok {
+				if _, ok := in.globals[key]; ok {
+					in.globals[key] = &v
+					continue
+				}
+			}
+		}
+		p := in.declare(spec.Name.Name, v, global)
+		if d.Static && in.frame != nil {
+			in.statics[in.frame.fn][key] = p
+		}
+		if d.Const && (global || in.frame == nil) {
+			in.consts[key] = true
+		}
+	}
+	return nil
+}
+
+func (in *Interpreter) enum(e *ast.EnumStmt) error {
+	step := IntValue(1)
+	if e.Step != nil {
+		var err error
+		if step, err = in.expr(e.Step); err != nil {
+			return err
+		}
+	}
+	op := e.StepOp
+	if op == 0 {
+		op = lexer.OpAdd
+	}
+	cur := IntValue(0)
+	if op == lexer.OpMul {
+		cur = IntValue(1)
+	}
+	for i, spec := range e.Specs {
+		if spec.Value != nil {
+			v, err := in.expr(spec.Value)
+			if err != nil {
+				return err
+			}
+			cur = v.Number()
+		} else if i > 0 {
+			var err error
+			if cur, err = BinaryOp(op, cur, step); err != nil {
+				return err
+			}
+		}
+		in.declare(spec.Name.Name, cur, strings.EqualFold(e.Scope, "Global"))
+	}
+	return nil
+}
+
+func (in *Interpreter) assign(s *ast.AssignStmt) error {
+	v, err := in.expr(s.Rhs)
+	if err != nil {
+		return err
+	}
+	if s.Op != lexer.OpAssign {
+		old, err := in.expr(s.Lhs)
+		if err != nil {
+			return err
+		}
+		var op lexer.TokenType
+		switch s.Op {
+		case lexer.OpAddEq:
+			op = lexer.OpAdd
+		case lexer.OpSubEq:
+			op = lexer.OpSub
+		case lexer.OpMulEq:
+			op = lexer.OpMul
+		case lexer.OpDivEq:
+			op = lexer.OpDiv
+		case lexer.OpConcatAssign:
+			op = lexer.OpConcat
+		default:
+			return in.fail(s, ErrUnsupported, "operator %s", s.Op)
+		}
+		if v, err = BinaryOp(op, old, v); err != nil {
+			return in.fail(s, err, "")
+		}
+		if err := in.checkSize(s, v); err != nil {
+			return err
+		}
+	}
+	if n, ok := s.Lhs.(*ast.Variable); ok {
+		return in.assignVar(n, v)
+	}
+	p, err := in.ref(s.Lhs, false)
+	if err != nil {
+		return err
+	}
+	*p = copyValue(v)
+	return nil
+}
+
+func (in *Interpreter) redim(s *ast.ReDimStmt) error {
+	var dims []ast.Expr
+	x := s.X
+	for {
+		ix, ok := x.(*ast.IndexExpr)
+		if !ok {
+			break
+		}
+		dims = append([]ast.Expr{ix.Index}, dims...)
+		x = ix.X
+	}
+	p, err := in.ref(x, false)
+	if err != nil {
+		return err
+	}
+	v, err := in.newArray(s, dims)
+	if err != nil {
+		return err
+	}
+	if p.kind == Array {
+		// keep what fits
+		copy(v.arr, p.arr)
+	}
+	*p = v
+	return nil
+}
@@ -0,0 +1,587 @@
+package eval
+
+// Interpreter for the side effect free subset of AutoIt.
+// It runs user functions made of variables, arrays, control flow and
+// the pure builtins of this package. Anything else, files, registry,
+// network, DllCall, COM objects, aborts the evaluation with ErrImpure,
+// so running code from a sample can't touch the host.
+
+import (
+	"errors"
+	"fmt"
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/lexer"
+	"github.com/x0r19x91/libautoit/parser"
+	"strings"
+	"time"
+)
+
+var (
+	ErrImpure     = errors.New("side effects not allowed")
+	ErrUndeclared = errors.New("variable used without being declared")
+	ErrUndefined  = errors.New("call to undefined function")
+	ErrStepLimit  = errors.New("step limit exceeded")
+	ErrTimeout    = errors.New("time limit exceeded")
+	ErrDepth      = errors.New("recursion too deep")
+	ErrTooLarge   = errors.New("value too large")
+	ErrExit       = errors.New("script called Exit")
+)
+
+// EvalError tells where an evaluation stopped.
+type EvalError struct {
+	Pos ast.Pos
+	Err error
+	Msg string
+}
+
+func (e *EvalError) Error() string {
+	if e.Msg != "" {
+		return fmt.Sprintf("line %d: %s: %s", e.Pos.Line, e.Err, e.Msg)
+	}
+	return fmt.Sprintf("line %d: %s", e.Pos.Line, e.Err)
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+type Limits struct {
+	MaxSteps int           // statements and calls, 0 for no limit
+	Timeout  time.Duration // 0 for no limit
+	MaxDepth int           // nested user function calls
+	MaxLen   int           // characters of a string or elements of an array
+	ReadOnly bool          // reject assignments to globals
+}
+
+var DefaultLimits = Limits{
+	MaxSteps: 1000000,
+	Timeout:  2 * time.Second,
+	MaxDepth: 256,
+	MaxLen:   1 << 24,
+}
+
+type frame struct {
+	fn   *ast.FuncDecl
+	vars map[string]*Value
+	ret  Value
+}
+
+type Interpreter struct {
+	limits  Limits
+	funcs   map[string]*ast.FuncDecl
+	globals map[string]*Value
+	consts  map[string]bool
+	statics map[*ast.FuncDecl]map[string]*Value
+
+	frame    *frame // nil at the top level
+	depth    int
+	steps    int
+	deadline time.Time
+	err      int64 // @error
+	ext      int64 // @extended
+}
+
+func NewInterpreter(script *ast.Script) *Interpreter {
+	in := &Interpreter{
+		limits:  DefaultLimits,
+		funcs:   make(map[string]*ast.FuncDecl),
+		globals: make(map[string]*Value),
+		consts:  make(map[string]bool),
+		statics: make(map[*ast.FuncDecl]map[string]*Value),
+	}
+	if script != nil {
+		for _, fn := range script.Funcs() {
+			key := strings.ToLower(fn.Name.Name)
+			if _, ok := in.funcs[key]; !ok {
+				in.funcs[key] = fn
+			}
+		}
+	}
+	return in
+}
+
+func (in *Interpreter) SetLimits(l Limits) {
+	in.limits = l
+}
+
+func (in *Interpreter) SetGlobal(name string, v Value) {
+	key := strings.ToLower(strings.TrimPrefix(name, "$"))
+	v = copyValue(v)
+	in.globals[key] = &v
+}
+
+// Global returns the value of a global variable.
+func (in *Interpreter) Global(name string) (Value, bool) {
+	p, ok := in.globals[strings.ToLower(strings.TrimPrefix(name, "$"))]
+	if !ok {
+		return Value{}, false
+	}
+	return *p, true
+}
+
+// HasFunc reports whether the script declares a function.
+func (in *Interpreter) HasFunc(name string) bool {
+	_, ok := in.funcs[strings.ToLower(name)]
+	return ok
+}
+
+// InitConsts evaluates the top level constants of a script whose value
+// can be computed, the others are skipped.
+func (in *Interpreter) InitConsts(script *ast.Script) {
+	for _, s := range script.Stmts {
+		switch d := s.(type) {
+		case *ast.DeclStmt:
+			if !d.Const {
+				continue
+			}
+			for _, spec := range d.Specs {
+				if spec.Value == nil || len(spec.Dims) > 0 {
+					continue
+				}
+				in.start()
+				if v, err := in.Eval(spec.Value); err == nil {
+					in.SetGlobal(spec.Name.Name, v)
+					in.consts[strings.ToLower(spec.Name.Name)] = true
+				}
+			}
+		case *ast.EnumStmt:
+			in.start()
+			if err := in.enum(d); err == nil {
+				for _, spec := range d.Specs {
+					in.consts[strings.ToLower(spec.Name.Name)] = true
+				}
+			}
+		}
+	}
+}
+
+func (in *Interpreter) start() {
+	in.steps = 0
+	in.depth = 0
+	in.frame = nil
+	if in.limits.Timeout > 0 {
+		in.deadline = time.Now().Add(in.limits.Timeout)
+	}
+}
+
+// Run executes the top level statements of a script.
+func (in *Interpreter) Run(script *ast.Script) error {
+	in.start()
+	for _, s := range script.Stmts {
+		if _, ok := s.(*ast.FuncDecl); ok {
+			continue
+		}
+		if _, err := in.exec(s); err != nil {
+			if errors.Is(err, ErrExit) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// CallFunc calls a user function, or a pure builtin, by name.
+func (in *Interpreter) CallFunc(name string, args []Value) (Value, error) {
+	in.start()
+	return in.call(name, args, nil, ast.NoPos)
+}
+
+// Eval evaluates an expression at the top level.
+func (in *Interpreter) Eval(x ast.Expr) (Value, error) {
+	if in.deadline.IsZero() && in.limits.Timeout > 0 {
+		in.start()
+	}
+	return in.expr(x)
+}
+
+func (in *Interpreter) fail(n ast.Node, err error, format string, args ...interface{}) error {
+	var pos ast.Pos
+	if n != nil {
+		pos = n.Pos()
+	}
+	return &EvalError{Pos: pos, Err: err, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (in *Interpreter) step(n ast.Node) error {
+	in.steps++
+	if in.limits.MaxSteps > 0 && in.steps > in.limits.MaxSteps {
+		return in.fail(n, ErrStepLimit, "")
+	}
+	if in.steps&1023 == 0 && !in.deadline.IsZero() && time.Now().After(in.deadline) {
+		return in.fail(n, ErrTimeout, "")
+	}
+	return nil
+}
+
+func (in *Interpreter) checkSize(n ast.Node, v Value) error {
+	if in.limits.MaxLen <= 0 {
+		return nil
+	}
+	if len(v.s) > in.limits.MaxLen || len(v.arr) > in.limits.MaxLen {
+		return in.fail(n, ErrTooLarge, "")
+	}
+	return nil
+}
+
+// copyValue copies arrays, AutoIt assigns them by value
+func copyValue(v Value) Value {
+	if v.kind != Array {
+		return v
+	}
+	arr := make([]Value, len(v.arr))
+	for i, e := range v.arr {
+		arr[i] = copyValue(e)
+	}
+	return ArrayValue(arr)
+}
+
+func (in *Interpreter) lookup(name string) (*Value, bool) {
+	key := strings.ToLower(name)
+	if in.frame != nil {
+		if p, ok := in.frame.vars[key]; ok {
+			return p, true
+		}
+	}
+	p, ok := in.globals[key]
+	return p, ok
+}
+
+// declare creates a variable in the current scope
+func (in *Interpreter) declare(name string, v Value, global bool) *Value {
+	key := strings.ToLower(name)
+	v = copyValue(v)
+	if global || in.frame == nil {
+		in.globals[key] = &v
+		return &v
+	}
+	in.frame.vars[key] = &v
+	return &v
+}
+
+func (in *Interpreter) assignVar(n *ast.Variable, v Value) error {
+	if p, ok := in.lookup(n.Name); ok {
+		if in.consts[strings.ToLower(n.Name)] && p == in.globals[strings.ToLower(n.Name)] {
+			return in.fail(n, ErrImpure, "assignment to constant $%s", n.Name)
+		}
+		if in.limits.ReadOnly && in.frame != nil && p == in.globals[strings.ToLower(n.Name)] {
+			return in.fail(n, ErrImpure, "assignment to global $%s", n.Name)
+		}
+		*p = copyValue(v)
+		return nil
+	}
+	if in.limits.ReadOnly && in.frame == nil {
+		return in.fail(n, ErrImpure, "assignment to global $%s", n.Name)
+	}
+	in.declare(n.Name, v, false)
+	return nil
+}
+
+// ref returns the storage of an lvalue: a variable or an array element
+func (in *Interpreter) ref(x ast.Expr, create bool) (*Value, error) {
+	switch x := x.(type) {
+	case *ast.Variable:
+		if p, ok := in.lookup(x.Name); ok {
+			if in.limits.ReadOnly && in.frame != nil && p == in.globals[strings.ToLower(x.Name)] {
+				return nil, in.fail(x, ErrImpure, "assignment to global $%s", x.Name)
+			}
+			return p, nil
+		}
+		if !create {
+			return nil, in.fail(x, ErrUndeclared, "$%s", x.Name)
+		}
+		return in.declare(x.Name, Value{}, false), nil
+	case *ast.IndexExpr:
+		p, err := in.ref(x.X, false)
+		if err != nil {
+			return nil, err
+		}
+		idx, err := in.expr(x.Index)
+		if err != nil {
+			return nil, err
+		}
+		if p.kind != Array {
+			return nil, in.fail(x, ErrUnsupported, "subscript on a non array")
+		}
+		i := idx.Int64()
+		if i < 0 || i >= int64(len(p.arr)) {
+			return nil, in.fail(x, ErrIndex, "index %d, size %d", i, len(p.arr))
+		}
+		return &p.arr[i], nil
+	case *ast.ParenExpr:
+		return in.ref(x.X, create)
+	}
+	return nil, in.fail(x, ErrUnsupported, "can't assign to %s", ast.ExprString(x))
+}
+
+func (in *Interpreter) expr(x ast.Expr) (Value, error) {
+	if v, ok := Literal(x); ok {
+		return v, nil
+	}
+	switch x := x.(type) {
+	case *ast.Variable:
+		p, ok := in.lookup(x.Name)
+		if !ok {
+			return Value{}, in.fail(x, ErrUndeclared, "$%s", x.Name)
+		}
+		return *p, nil
+	case *ast.MacroExpr:
+		switch strings.ToLower(x.Name) {
+		case "error":
+			return IntValue(in.err), nil
+		case "extended":
+			return IntValue(in.ext), nil
+		}
+		return Value{}, in.fail(x, ErrImpure, "macro @%s", x.Name)
+	case *ast.ParenExpr:
+		return in.expr(x.X)
+	case *ast.UnaryExpr:
+		v, err := in.expr(x.X)
+		if err != nil {
+			return v, err
+		}
+		v, err = UnaryOp(x.Op, v)
+		if err != nil {
+			return v, in.fail(x, err, "")
+		}
+		return v, nil
+	case *ast.BinaryExpr:
+		a, err := in.expr(x.X)
+		if err != nil {
+			return a, err
+		}
+		if x.Op == lexer.OpAnd && !a.Truth() {
+			return BoolValue(false), nil
+		}
+		if x.Op == lexer.OpOr && a.Truth() {
+			return BoolValue(true), nil
+		}
+		b, err := in.expr(x.Y)
+		if err != nil {
+			return b, err
+		}
+		v, err := BinaryOp(x.Op, a, b)
+		if err != nil {
+			return v, in.fail(x, err, "")
+		}
+		return v, in.checkSize(x, v)
+	case *ast.TernaryExpr:
+		c, err := in.expr(x.Cond)
+		if err != nil {
+			return c, err
+		}
+		if c.Truth() {
+			return in.expr(x.Then)
+		}
+		return in.expr(x.Else)
+	case *ast.ArrayLit:
+		elems := make([]Value, len(x.Elts))
+		for i, e := range x.Elts {
+			v, err := in.expr(e)
+			if err != nil {
+				return v, err
+			}
+			elems[i] = v
+		}
+		return ArrayValue(elems), nil
+	case *ast.IndexExpr:
+		arr, err := in.expr(x.X)
+		if err != nil {
+			return arr, err
+		}
+		idx, err := in.expr(x.Index)
+		if err != nil {
+			return idx, err
+		}
+		v, err := Index(arr, idx)
+		if err != nil {
+			return v, in.fail(x, err, "")
+		}
+		return v, nil
+	case *ast.CallExpr:
+		return in.callExpr(x)
+	}
+	return Value{}, in.fail(x, ErrUnsupported, "%s", ast.ExprString(x))
+}
+
+func (in *Interpreter) callExpr(x *ast.CallExpr) (Value, error) {
+	id, ok := x.Fun.(*ast.FuncIdent)
+	if !ok {
+		return Value{}, in.fail(x, ErrImpure, "method or indirect call")
+	}
+	name := strings.ToLower(id.Name)
+
+	// builtins working on the interpreter's own state
+	switch name {
+	case "isdeclared", "eval", "assign":
+		return in.varBuiltin(x, name)
+	}
+
+	args := make([]Value, len(x.Args))
+	for i, a := range x.Args {
+		// ByRef arguments are bound in call
+		v, err := in.expr(a)
+		if err != nil {
+			return v, err
+		}
+		args[i] = v
+	}
+	return in.call(id.Name, args, x.Args, x.Pos())
+}
+
+func (in *Interpreter) varBuiltin(x *ast.CallExpr, name string) (Value, error) {
+	if len(x.Args) == 0 {
+		return Value{}, in.fail(x, ErrArgs, "")
+	}
+	nv, err := in.expr(x.Args[0])
+	if err != nil {
+		return nv, err
+	}
+	vname := strings.TrimPrefix(nv.Str(), "$")
+	p, ok := in.lookup(vname)
+	switch name {
+	case "isdeclared":
+		if !ok {
+			return IntValue(0), nil
+		}
+		if in.frame != nil && p == in.frame.vars[strings.ToLower(vname)] {
+			return IntValue(-1), nil
+		}
+		return IntValue(1), nil
+	case "eval":
+		if !ok {
+			in.err = 1
+			return StringValue(""), nil
+		}
+		return *p, nil
+	}
+	// Assign
+	if len(x.Args) < 2 {
+		return Value{}, in.fail(x, ErrArgs, "")
+	}
+	v, err := in.expr(x.Args[1])
+	if err != nil {
+		return v, err
+	}
+	if err := in.assignVar(&ast.Variable{NamePos: x.Pos(), Name: vname}, v); err != nil {
+		return Value{}, err
+	}
+	return IntValue(1), nil
+}
+
+func (in *Interpreter) call(name string, args []Value, argExprs []ast.Expr, pos ast.Pos) (Value, error) {
+	lower := strings.ToLower(name)
+	fn, ok := in.funcs[lower]
+	if !ok {
+		switch lower {
+		case "seterror":
+			if len(args) > 0 {
+				in.err = args[0].Int64()
+			}
+			if len(args) > 1 {
+				in.ext = args[1].Int64()
+			}
+			if len(args) > 2 {
+				return args[2], nil
+			}
+			return IntValue(1), nil
+		case "setextended":
+			if len(args) > 0 {
+				in.ext = args[0].Int64()
+			}
+			if len(args) > 1 {
+				return args[1], nil
+			}
+			return IntValue(1), nil
+		case "call":
+			if len(args) == 0 {
+				return Value{}, &EvalError{Pos: pos, Err: ErrArgs}
+			}
+			return in.call(args[0].Str(), args[1:], nil, pos)
+		case "execute":
+			if len(args) != 1 {
+				return Value{}, &EvalError{Pos: pos, Err: ErrArgs}
+			}
+			return in.execute(args[0].Str(), pos)
+		}
+		if !IsPure(name) {
+			if isStdFunction(name) {
+				return Value{}, &EvalError{Pos: pos, Err: ErrImpure, Msg: name}
+			}
+			return Value{}, &EvalError{Pos: pos, Err: ErrUndefined, Msg: name}
+		}
+		v, err := Call(name, args)
+		if err != nil {
+			return v, &EvalError{Pos: pos, Err: err, Msg: name}
+		}
+		return v, in.checkSize(nil, v)
+	}
+
+	if in.limits.MaxDepth > 0 && in.depth >= in.limits.MaxDepth {
+		return Value{}, &EvalError{Pos: pos, Err: ErrDepth, Msg: name}
+	}
+	if err := in.step(fn); err != nil {
+		return Value{}, err
+	}
+	if len(args) > len(fn.Params) {
+		return Value{}, &EvalError{Pos: pos, Err: ErrArgs, Msg: name}
+	}
+
+	fr := &frame{fn: fn, vars: make(map[string]*Value)}
+	for i, p := range fn.Params {
+		key := strings.ToLower(p.Name.Name)
+		if i < len(args) && !(args[i].kind == Keyword && strings.EqualFold(args[i].s, "Default") && p.Default != nil) {
+			if p.ByRef && argExprs != nil {
+				if ptr, err := in.ref(argExprs[i], false); err == nil {
+					fr.vars[key] = ptr
+					continue
+				}
+			}
+			v := copyValue(args[i])
+			fr.vars[key] = &v
+			continue
+		}
+		if p.Default == nil {
+			return Value{}, &EvalError{Pos: pos, Err: ErrArgs, Msg: name}
+		}
+		// defaults see the parameters before them
+		saved := in.frame
+		in.frame = fr
+		v, err := in.expr(p.Default)
+		in.frame = saved
+		if err != nil {
+			return v, err
+		}
+		fr.vars[key] = &v
+	}
+
+	saved := in.frame
+	in.frame = fr
+	in.depth++
+	in.err, in.ext = 0, 0
+	_, err := in.block(fn.Body)
+	in.depth--
+	in.frame = saved
+	if err != nil {
+		return Value{}, err
+	}
+	return fr.ret, nil
+}
+
+// execute evaluates the expression of an Execute string
+func (in *Interpreter) execute(src string, pos ast.Pos) (Value, error) {
+	script, err := parser.ParseSource([]byte(src))
+	if err != nil || len(script.Stmts) != 1 {
+		return Value{}, &EvalError{Pos: pos, Err: ErrUnsupported, Msg: "Execute"}
+	}
+	switch s := script.Stmts[0].(type) {
+	case *ast.ExprStmt:
+		return in.expr(s.X)
+	case *ast.AssignStmt:
+		// "$a = 1" is a comparison for Execute
+		if s.Op == lexer.OpAssign {
+			return in.expr(&ast.BinaryExpr{X: s.Lhs, Op: lexer.OpEq, Y: s.Rhs})
+		}
+	}
+	return Value{}, &EvalError{Pos: pos, Err: ErrUnsupported, Msg: "Execute"}
+}
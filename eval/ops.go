@@ -0,0 +1,116 @@
+package eval
+
+import (
+	"errors"
+	"github.com/x0r19x91/libautoit/lexer"
+	"math"
+	"strings"
+)
+
+var (
+	ErrNotConstant = errors.New("expression is not constant")
+	ErrUnsupported = errors.New("unsupported operation")
+	ErrDivByZero   = errors.New("division by zero")
+	ErrArgs        = errors.New("wrong number of arguments")
+	ErrIndex       = errors.New("array index out of range")
+)
+
+// UnaryOp applies a unary operator.
+func UnaryOp(op lexer.TokenType, x Value) (Value, error) {
+	switch op {
+	case lexer.OpNot:
+		return BoolValue(!x.Truth()), nil
+	case lexer.OpAdd:
+		return x.Number(), nil
+	case lexer.OpSub:
+		n := x.Number()
+		if n.kind == Int {
+			return IntValue(-n.i), nil
+		}
+		return FloatValue(-n.f), nil
+	}
+	return Value{}, ErrUnsupported
+}
+
+// BinaryOp applies a binary operator, '=' as a comparison is OpEq.
+func BinaryOp(op lexer.TokenType, x, y Value) (Value, error) {
+	switch op {
+	case lexer.OpConcat:
+		return StringValue(x.Str() + y.Str()), nil
+	case lexer.OpAnd:
+		return BoolValue(x.Truth() && y.Truth()), nil
+	case lexer.OpOr:
+		return BoolValue(x.Truth() || y.Truth()), nil
+	case lexer.OpAdd, lexer.OpSub, lexer.OpMul, lexer.OpDiv, lexer.OpExp:
+		return arith(op, x.Number(), y.Number())
+	case lexer.OpStrEq:
+		return BoolValue(x.Str() == y.Str()), nil
+	case lexer.OpEq, lexer.OpAssign:
+		return BoolValue(compare(x, y) == 0), nil
+	case lexer.OpNe:
+		return BoolValue(compare(x, y) != 0), nil
+	case lexer.OpGt:
+		return BoolValue(compare(x, y) > 0), nil
+	case lexer.OpGe:
+		return BoolValue(compare(x, y) >= 0), nil
+	case lexer.OpLt:
+		return BoolValue(compare(x, y) < 0), nil
+	case lexer.OpLe:
+		return BoolValue(compare(x, y) <= 0), nil
+	}
+	return Value{}, ErrUnsupported
+}
+
+func arith(op lexer.TokenType, x, y Value) (Value, error) {
+	if x.kind == Int && y.kind == Int {
+		switch op {
+		case lexer.OpAdd:
+			return IntValue(x.i + y.i), nil
+		case lexer.OpSub:
+			return IntValue(x.i - y.i), nil
+		case lexer.OpMul:
+			return IntValue(x.i * y.i), nil
+		}
+	}
+	a, b := x.Float64(), y.Float64()
+	switch op {
+	case lexer.OpAdd:
+		return FloatValue(a + b), nil
+	case lexer.OpSub:
+		return FloatValue(a - b), nil
+	case lexer.OpMul:
+		return FloatValue(a * b), nil
+	case lexer.OpDiv:
+		if b == 0 {
+			return Value{}, ErrDivByZero
+		}
+		return FloatValue(a / b), nil
+	}
+	return FloatValue(math.Pow(a, b)), nil
+}
+
+// compare orders two values, strings case insensitively unless one of
+// them is a number
+func compare(x, y Value) int {
+	if x.kind == String && y.kind == String {
+		return strings.Compare(strings.ToLower(x.s), strings.ToLower(y.s))
+	}
+	if x.kind == Binary && y.kind == Binary {
+		return strings.Compare(x.s, y.s)
+	}
+	if x.kind == Int && y.kind == Int {
+		if x.i < y.i {
+			return -1
+		} else if x.i > y.i {
+			return 1
+		}
+		return 0
+	}
+	a, b := x.Float64(), y.Float64()
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
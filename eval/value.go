@@ -0,0 +1,288 @@
+package eval
+
+// Values of the AutoIt variant type and their conversions.
+
+import (
+	"encoding/hex"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type Kind int
+
+const (
+	Empty Kind = iota // an unassigned variable, "" or 0 as needed
+	Int
+	Float
+	String
+	Bool
+	Binary
+	Array
+	Keyword // Null or Default
+)
+
+var kindNames = map[Kind]string{
+	Empty:   "Empty",
+	Int:     "Int64",
+	Float:   "Double",
+	String:  "String",
+	Bool:    "Bool",
+	Binary:  "Binary",
+	Array:   "Array",
+	Keyword: "Keyword",
+}
+
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// Value is an AutoIt variant. Binary data is kept in s.
+type Value struct {
+	kind Kind
+	i    int64
+	f    float64
+	s    string
+	arr  []Value
+}
+
+func IntValue(n int64) Value       { return Value{kind: Int, i: n} }
+func FloatValue(f float64) Value   { return Value{kind: Float, f: f} }
+func StringValue(s string) Value   { return Value{kind: String, s: s} }
+func BinaryValue(b []byte) Value   { return Value{kind: Binary, s: string(b)} }
+func KeywordValue(k string) Value  { return Value{kind: Keyword, s: k} }
+func ArrayValue(arr []Value) Value { return Value{kind: Array, arr: arr} }
+
+func BoolValue(b bool) Value {
+	if b {
+		return Value{kind: Bool, i: 1}
+	}
+	return Value{kind: Bool}
+}
+
+func (v Value) Kind() Kind { return v.kind }
+
+func (v Value) IsNumber() bool {
+	return v.kind == Int || v.kind == Float
+}
+
+// Elems returns the elements of an array.
+func (v Value) Elems() []Value {
+	return v.arr
+}
+
+// Bytes returns binary data, or the bytes of any other value converted
+// the way Binary() does.
+func (v Value) Bytes() []byte {
+	switch v.kind {
+	case Binary:
+		return []byte(v.s)
+	case String:
+		if b, ok := parseHexBinary(v.s); ok {
+			return b
+		}
+		return toANSI(v.s)
+	case Int:
+		n := 4
+		if v.i != int64(int32(v.i)) {
+			n = 8
+		}
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte(v.i >> (8 * uint(i)))
+		}
+		return b
+	case Float:
+		bits := math.Float64bits(v.f)
+		b := make([]byte, 8)
+		for i := range b {
+			b[i] = byte(bits >> (8 * uint(i)))
+		}
+		return b
+	}
+	return nil
+}
+
+// Str converts a value to a string.
+func (v Value) Str() string {
+	switch v.kind {
+	case Int:
+		return strconv.FormatInt(v.i, 10)
+	case Float:
+		return formatFloat(v.f)
+	case String, Keyword:
+		return v.s
+	case Bool:
+		if v.i != 0 {
+			return "True"
+		}
+		return "False"
+	case Binary:
+		return "0x" + strings.ToUpper(hex.EncodeToString([]byte(v.s)))
+	}
+	return ""
+}
+
+// Int64 converts a value to an integer, truncating doubles.
+func (v Value) Int64() int64 {
+	switch v.kind {
+	case Int, Bool:
+		return v.i
+	case Float:
+		return int64(v.f)
+	case String:
+		return parseNumber(v.s).Int64()
+	case Binary:
+		var n int64
+		b := []byte(v.s)
+		// little endian, the bytes past the 8th ignored
+		if len(b) > 8 {
+			b = b[:8]
+		}
+		for i := len(b) - 1; i >= 0; i-- {
+			n = n<<8 | int64(b[i])
+		}
+		return n
+	}
+	return 0
+}
+
+// Float64 converts a value to a double.
+func (v Value) Float64() float64 {
+	switch v.kind {
+	case Float:
+		return v.f
+	case String:
+		return parseNumber(v.s).Float64()
+	}
+	return float64(v.Int64())
+}
+
+// Number converts a value to Int or Float, like Number().
+func (v Value) Number() Value {
+	switch v.kind {
+	case Int, Float:
+		return v
+	case String:
+		return parseNumber(v.s)
+	}
+	return IntValue(v.Int64())
+}
+
+// Truth converts a value to a boolean.
+func (v Value) Truth() bool {
+	switch v.kind {
+	case Int, Bool:
+		return v.i != 0
+	case Float:
+		return v.f != 0
+	case String:
+		return v.s != ""
+	case Binary:
+		return len(v.s) > 0
+	case Array:
+		return true
+	}
+	return false
+}
+
+// Equal reports whether two values have the same type and contents.
+func (v Value) Equal(w Value) bool {
+	if v.kind != w.kind {
+		return false
+	}
+	switch v.kind {
+	case Array:
+		if len(v.arr) != len(w.arr) {
+			return false
+		}
+		for i := range v.arr {
+			if !v.arr[i].Equal(w.arr[i]) {
+				return false
+			}
+		}
+		return true
+	case Float:
+		return v.f == w.f
+	}
+	return v.i == w.i && v.s == w.s
+}
+
+func formatFloat(f float64) string {
+	if f == math.Trunc(f) && math.Abs(f) < 1e15 {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'g', 15, 64)
+}
+
+// parseNumber reads the longest number at the start of s, 0 if none
+func parseNumber(s string) Value {
+	s = strings.TrimLeft(s, " \t\r\n")
+	neg := false
+	t := s
+	if strings.HasPrefix(t, "-") || strings.HasPrefix(t, "+") {
+		neg = t[0] == '-'
+		t = t[1:]
+	}
+	if len(t) > 2 && (t[:2] == "0x" || t[:2] == "0X") {
+		end := 2
+		for end < len(t) && strings.IndexByte("0123456789abcdefABCDEF", t[end]) >= 0 {
+			end++
+		}
+		n, err := strconv.ParseUint(t[2:end], 16, 64)
+		if err != nil || end == 2 {
+			return IntValue(0)
+		}
+		if neg {
+			return IntValue(-int64(n))
+		}
+		return IntValue(int64(n))
+	}
+	// longest prefix that parses
+	end := 0
+	for end < len(s) && strings.IndexByte("0123456789.eE+-", s[end]) >= 0 {
+		end++
+	}
+	for ; end > 0; end-- {
+		if n, err := strconv.ParseInt(s[:end], 10, 64); err == nil {
+			return IntValue(n)
+		}
+		if f, err := strconv.ParseFloat(s[:end], 64); err == nil {
+			return FloatValue(f)
+		}
+	}
+	return IntValue(0)
+}
+
+func parseHexBinary(s string) ([]byte, bool) {
+	if len(s) < 2 || s[0] != '0' || (s[1] != 'x' && s[1] != 'X') {
+		return nil, false
+	}
+	h := s[2:]
+	if len(h)%2 != 0 {
+		return nil, false
+	}
+	b, err := hex.DecodeString(h)
+	return b, err == nil
+}
+
+// toANSI converts a string to single byte characters, characters out
+// of Latin-1 become '?'
+func toANSI(s string) []byte {
+	var b []byte
+	for _, r := range s {
+		if r > 0xff {
+			r = '?'
+		}
+		b = append(b, byte(r))
+	}
+	return b
+}
+
+func fromANSI(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
@@ -0,0 +1,254 @@
+package libautoit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultManifest is the manifest written by ExtractAll.
+const DefaultManifest = "manifest.json"
+
+type ExtractOptions struct {
+	KeepDirs bool // recreate the directories of the resource paths
+	Derived  bool // also write the resources in Derived
+	// Manifest names the manifest, DefaultManifest when "" and none
+	// when "-".
+	Manifest string
+	// Data returns what to write for a resource, r.Data when nil. A
+	// decompiler can tidy the scripts here.
+	Data func(r *AutoItResource) []byte
+	// Name returns the Windows path a resource is written under before
+	// SafePath, its Path when nil.
+	Name func(r *AutoItResource) string
+}
+
+// ManifestEntry describes a file written by ExtractAll.
+type ManifestEntry struct {
+	File     string    `json:"file"` // relative to the directory, '/' separated
+	Tag      string    `json:"tag"`
+	Path     string    `json:"path"`
+	Parent   string    `json:"parent,omitempty"` // file of the script a derived resource was found in
+	Size     int       `json:"size"`
+	SHA256   string    `json:"sha256"`
+	Created  time.Time `json:"created"`
+	Modified time.Time `json:"modified"`
+	Error    string    `json:"error,omitempty"` // why the file couldn't be written, File is then ""
+}
+
+var reservedNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true, "conin$": true, "conout$": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true,
+	"com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true,
+	"lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+const maxNameLen = 200
+
+// safeName makes a single path element safe on any file system, ""
+// when nothing is left
+func safeName(s string) string {
+	var sb strings.Builder
+	for _, c := range s {
+		switch {
+		case c < 0x20 || c == 0x7f || strings.ContainsRune(`<>:"/\|?*`, c):
+			sb.WriteByte('_')
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	name := strings.TrimRight(strings.TrimSpace(sb.String()), ". ")
+	if strings.Trim(name, "_") == "" {
+		return ""
+	}
+	base := name
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	if reservedNames[strings.ToLower(strings.TrimSpace(base))] {
+		name = "_" + name
+	}
+	if len(name) > maxNameLen {
+		ext := path.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		cut := maxNameLen - len(ext)
+		// on a rune boundary
+		for cut > 0 && !utf8.RuneStart(name[cut]) {
+			cut--
+		}
+		name = name[:cut] + ext
+	}
+	return name
+}
+
+// SafePath maps the Windows path of a resource to a relative path, '/'
+// separated, that stays inside the directory it is joined to. Drive
+// letters, UNC and device prefixes, "." and ".." are dropped, reserved
+// characters replaced and device names such as CON prefixed with '_'.
+// Only the file name is kept unless keepDirs is set.
+func SafePath(p string, keepDirs bool) string {
+	var parts []string
+	for _, elem := range strings.FieldsFunc(p, func(c rune) bool { return c == '\\' || c == '/' }) {
+		if len(elem) == 2 && elem[1] == ':' {
+			continue // drive, also after \\?\
+		}
+		if elem == "." || elem == ".." || elem == "?" {
+			continue
+		}
+		if name := safeName(elem); name != "" {
+			parts = append(parts, name)
+		}
+	}
+	if len(parts) == 0 {
+		return "resource"
+	}
+	if !keepDirs {
+		return parts[len(parts)-1]
+	}
+	return strings.Join(parts, "/")
+}
+
+// extractor writes files without ever replacing one
+type extractor struct {
+	dir  string
+	real string // dir with its links resolved
+	used map[string]bool
+}
+
+// reserve returns a free name for rel, adding _2, _3... before the
+// extension on collisions
+func (x *extractor) reserve(rel string) string {
+	ext := path.Ext(rel)
+	if strings.Contains(ext, "/") || ext == rel {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(rel, ext)
+	name := rel
+	for i := 2; ; i++ {
+		if !x.used[strings.ToLower(name)] {
+			if _, err := os.Lstat(filepath.Join(x.dir, filepath.FromSlash(name))); os.IsNotExist(err) {
+				break
+			}
+		}
+		name = fmt.Sprintf("%s_%d%s", stem, i, ext)
+	}
+	x.used[strings.ToLower(name)] = true
+	return name
+}
+
+func (x *extractor) write(rel string, data []byte) error {
+	dst := filepath.Join(x.dir, filepath.FromSlash(rel))
+	parent := filepath.Dir(dst)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return err
+	}
+	// a link already in the directory could lead outside of it
+	real, err := filepath.EvalSymlinks(parent)
+	if err != nil {
+		return err
+	}
+	if real != x.real && !strings.HasPrefix(real, x.real+string(filepath.Separator)) {
+		return fmt.Errorf("%s leads outside of %s", rel, x.dir)
+	}
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ExtractAll writes the resources to dir under names derived from their
+// paths, see SafePath, and a manifest of what was written. Existing
+// files are never replaced, names that collide get a number. A resource
+// that can't be written has the error in its entry and the others are
+// still written, the manifest always is. The entries of the manifest
+// are returned with the first error.
+func (f *AutoItFile) ExtractAll(dir string, opts ExtractOptions) ([]*ManifestEntry, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+	x := &extractor{dir: dir, real: real, used: make(map[string]bool)}
+	manifest := opts.Manifest
+	if manifest == "" {
+		manifest = DefaultManifest
+	}
+	if manifest != "-" {
+		manifest = x.reserve(SafePath(manifest, false))
+	}
+
+	list := f.Resources
+	if opts.Derived {
+		list = append(append([]*AutoItResource(nil), f.Resources...), f.Derived...)
+	}
+	var entries []*ManifestEntry
+	var first error
+	files := make(map[*AutoItResource]string)
+	for _, r := range list {
+		p := r.Path
+		if r.Parent != nil || p == "" {
+			p = r.Tag // the path of a derived resource is a location in its script
+		}
+		if opts.Name != nil {
+			p = opts.Name(r)
+		}
+		rel := x.reserve(SafePath(p, opts.KeepDirs))
+		data := r.Data
+		if opts.Data != nil {
+			data = opts.Data(r)
+		}
+		err := x.write(rel, data)
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			rel = ""
+		}
+		files[r] = rel
+		sum := sha256.Sum256(data)
+		e := &ManifestEntry{
+			File:     rel,
+			Tag:      r.Tag,
+			Path:     r.Path,
+			Size:     len(data),
+			SHA256:   hex.EncodeToString(sum[:]),
+			Created:  r.CreationTime,
+			Modified: r.ModifiedTime,
+		}
+		if r.Parent != nil {
+			e.Parent = files[r.Parent]
+		}
+		if err != nil {
+			e.Error = err.Error()
+		}
+		entries = append(entries, e)
+	}
+	if manifest == "-" {
+		return entries, first
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err == nil {
+		err = x.write(manifest, append(data, '\n'))
+	}
+	if first == nil {
+		first = err
+	}
+	return entries, first
+}
@@ -0,0 +1,142 @@
+package ioc
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type jsonIndicator struct {
+	Type    Type   `json:"type"`
+	Value   string `json:"value"`
+	Line    int    `json:"line"`
+	Token   int    `json:"token"`
+	Func    string `json:"func,omitempty"`
+	Source  string `json:"source"`
+	Context string `json:"context,omitempty"`
+}
+
+// WriteJSON writes the indicators as an indented JSON array.
+func WriteJSON(w io.Writer, inds []*Indicator) error {
+	out := []jsonIndicator{}
+	for _, ind := range inds {
+		out = append(out, jsonIndicator{
+			Type:    ind.Type,
+			Value:   ind.Value,
+			Line:    ind.Pos.Line,
+			Token:   ind.Pos.Token,
+			Func:    ind.Func,
+			Source:  ind.Source,
+			Context: ind.Context,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+type stixIndicator struct {
+	Type        string `json:"type"`
+	SpecVersion string `json:"spec_version"`
+	ID          string `json:"id"`
+	Created     string `json:"created"`
+	Modified    string `json:"modified"`
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	PatternType string `json:"pattern_type"`
+	ValidFrom   string `json:"valid_from"`
+	Line        int    `json:"x_autoit_line"`
+	Func        string `json:"x_autoit_func,omitempty"`
+	Source      string `json:"x_autoit_source"`
+	Context     string `json:"x_autoit_context,omitempty"`
+}
+
+type stixBundle struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id"`
+	Objects []stixIndicator `json:"objects"`
+}
+
+// stixID derives an identifier from the content, so the same indicator
+// gets the same id in every report
+func stixID(typ string, parts ...string) string {
+	h := sha1.Sum([]byte(strings.Join(parts, "\x00")))
+	h[6] = h[6]&0x0f | 0x50
+	h[8] = h[8]&0x3f | 0x80
+	return fmt.Sprintf("%s--%x-%x-%x-%x-%x", typ, h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+func quote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return "'" + strings.Replace(s, "'", `\'`, -1) + "'"
+}
+
+// Pattern returns the STIX pattern matching an indicator.
+func (ind *Indicator) Pattern() string {
+	v := quote(ind.Value)
+	switch ind.Type {
+	case URL:
+		return "[url:value = " + v + "]"
+	case IP:
+		return "[ipv4-addr:value = " + v + "]"
+	case Domain:
+		return "[domain-name:value = " + v + "]"
+	case Email:
+		return "[email-addr:value = " + v + "]"
+	case Path:
+		i := strings.LastIndexByte(ind.Value, '\\')
+		if i < 0 {
+			return "[file:name = " + v + "]"
+		}
+		return "[file:name = " + quote(ind.Value[i+1:]) + " AND file:parent_directory_ref.path = " + quote(ind.Value[:i]) + "]"
+	case Registry:
+		return "[windows-registry-key:key = " + v + "]"
+	case Mutex:
+		return "[mutex:name = " + v + "]"
+	case Service:
+		return "[process:extensions.'windows-service-ext'.service_name = " + v + "]"
+	case Task:
+		return "[process:command_line = " + v + "]"
+	}
+	return ""
+}
+
+// WriteSTIX writes the indicators as a STIX 2.1 bundle of indicator
+// objects. Indicators seen more than once are written once, with the
+// first position.
+func WriteSTIX(w io.Writer, inds []*Indicator, created time.Time) error {
+	ts := created.UTC().Format("2006-01-02T15:04:05.000Z")
+	out := stixBundle{Type: "bundle", Objects: []stixIndicator{}}
+	seen := make(map[string]bool)
+	var ids []string
+	for _, ind := range inds {
+		id := stixID("indicator", string(ind.Type), ind.Value)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+		out.Objects = append(out.Objects, stixIndicator{
+			Type:        "indicator",
+			SpecVersion: "2.1",
+			ID:          id,
+			Created:     ts,
+			Modified:    ts,
+			Name:        string(ind.Type) + ": " + ind.Value,
+			Pattern:     ind.Pattern(),
+			PatternType: "stix",
+			ValidFrom:   ts,
+			Line:        ind.Pos.Line,
+			Func:        ind.Func,
+			Source:      ind.Source,
+			Context:     ind.Context,
+		})
+	}
+	out.ID = stixID("bundle", ids...)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
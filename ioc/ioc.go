@@ -0,0 +1,325 @@
+package ioc
+
+// Indicators of compromise found in the strings of a script.
+// String literals are scanned as written and constant expressions, such
+// as Chr() chains or split concatenations, are folded first. Arguments
+// of calls that name a registry key, a mutex, a service or a host are
+// reported even when they don't look like one.
+
+import (
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/eval"
+	"github.com/x0r19x91/libautoit/lexer"
+	"sort"
+	"strings"
+)
+
+type Type string
+
+const (
+	URL      Type = "url"
+	IP       Type = "ipv4"
+	Domain   Type = "domain"
+	Email    Type = "email"
+	Path     Type = "path"
+	Registry Type = "registry"
+	Service  Type = "service"
+	Mutex    Type = "mutex"
+	Task     Type = "task"
+)
+
+const (
+	Literal = "literal" // found in a string literal
+	Folded  = "folded"  // found in a folded constant expression
+)
+
+type Indicator struct {
+	Type    Type
+	Value   string
+	Pos     ast.Pos
+	Func    string // enclosing function, "" at the top level
+	Source  string // Literal or Folded
+	Context string // innermost call the string is given to, "" if none
+}
+
+// macros expanded in paths, "@AppDataDir & '\x.exe'" is reported as
+// "%APPDATA%\x.exe"
+var dirMacros = map[string]string{
+	"appdatadir":           "%APPDATA%",
+	"appdatacommondir":     "%ALLUSERSPROFILE%",
+	"localappdatadir":      "%LOCALAPPDATA%",
+	"tempdir":              "%TEMP%",
+	"homedrive":            "%HOMEDRIVE%",
+	"userprofiledir":       "%USERPROFILE%",
+	"windowsdir":           "%WINDIR%",
+	"systemdir":            "%WINDIR%\\System32",
+	"programfilesdir":      "%PROGRAMFILES%",
+	"commonfilesdir":       "%COMMONPROGRAMFILES%",
+	"mydocumentsdir":       "%USERPROFILE%\\Documents",
+	"desktopdir":           "%USERPROFILE%\\Desktop",
+	"startupdir":           "%APPDATA%\\Microsoft\\Windows\\Start Menu\\Programs\\Startup",
+	"startupcommondir":     "%ALLUSERSPROFILE%\\Microsoft\\Windows\\Start Menu\\Programs\\Startup",
+	"favoritesdir":         "%USERPROFILE%\\Favorites",
+	"programsdir":          "%APPDATA%\\Microsoft\\Windows\\Start Menu\\Programs",
+	"scriptdir":            "%SCRIPTDIR%",
+	"workingdir":           "%CD%",
+	"autoitexe":            "%AUTOITEXE%",
+	"scriptfullpath":       "%SCRIPTFULLPATH%",
+	"desktopcommondir":     "%PUBLIC%\\Desktop",
+	"documentscommondir":   "%PUBLIC%\\Documents",
+	"programscommondir":    "%ALLUSERSPROFILE%\\Microsoft\\Windows\\Start Menu\\Programs",
+	"favoritescommondir":   "%USERPROFILE%\\Favorites",
+	"startmenudir":         "%APPDATA%\\Microsoft\\Windows\\Start Menu",
+	"startmenucommondir":   "%ALLUSERSPROFILE%\\Microsoft\\Windows\\Start Menu",
+	"userprofiledirectory": "%USERPROFILE%",
+}
+
+type key struct {
+	pos ast.Pos
+	typ Type
+	val string
+}
+
+type extractor struct {
+	fn    string
+	stack []ast.Node
+	seen  map[key]bool
+	inds  []*Indicator
+}
+
+// Extract returns the indicators of a script in source order. Run it on
+// a deobfuscated script to also get the strings built at run time.
+func Extract(script *ast.Script) []*Indicator {
+	e := &extractor{seen: make(map[key]bool)}
+	ast.Inspect(script, e.visit)
+	sort.SliceStable(e.inds, func(i, j int) bool {
+		return e.inds[i].Pos.Token < e.inds[j].Pos.Token
+	})
+	return e.inds
+}
+
+func (e *extractor) visit(n ast.Node) bool {
+	if n == nil {
+		e.stack = e.stack[:len(e.stack)-1]
+		return true
+	}
+	switch n := n.(type) {
+	case *ast.FuncDecl:
+		e.fn = n.Name.Name
+		ast.Inspect(n.Body, e.visit)
+		e.fn = ""
+		return false
+
+	case *ast.CallExpr:
+		if n.IsBuiltin() {
+			e.call(n)
+			if s, src, ok := e.str(n); ok {
+				e.scan(n.Pos(), s, src)
+				return false
+			}
+		} else if strings.EqualFold(n.CalleeName(), "_Singleton") && len(n.Args) > 0 {
+			e.arg(n.Args[0], Mutex, n.CalleeName())
+		}
+
+	case *ast.BasicLit, *ast.BinaryExpr, *ast.ParenExpr:
+		if s, src, ok := e.str(n.(ast.Expr)); ok {
+			e.scan(n.Pos(), s, src)
+			if src == Folded {
+				return false
+			}
+		}
+	}
+	e.stack = append(e.stack, n)
+	return true
+}
+
+// str returns the string value of x. Concatenations starting with a
+// directory macro are expanded when the rest is constant.
+func (e *extractor) str(x ast.Expr) (string, string, bool) {
+	if lit, ok := x.(*ast.BasicLit); ok {
+		return lit.Value, Literal, lit.Kind == lexer.StrLit
+	}
+	v, err := eval.Const(x)
+	if err == nil {
+		if v.Kind() != eval.String {
+			return "", "", false
+		}
+		return v.Str(), Folded, true
+	}
+	b, ok := x.(*ast.BinaryExpr)
+	if !ok || b.Op != lexer.OpConcat {
+		return "", "", false
+	}
+	var parts []ast.Expr
+	for ok && b.Op == lexer.OpConcat {
+		parts = append([]ast.Expr{b.Y}, parts...)
+		x = b.X
+		b, ok = x.(*ast.BinaryExpr)
+	}
+	m, ok := x.(*ast.MacroExpr)
+	if !ok {
+		return "", "", false
+	}
+	dir, ok := dirMacros[strings.ToLower(m.Name)]
+	if !ok {
+		return "", "", false
+	}
+	var sb strings.Builder
+	sb.WriteString(dir)
+	for _, p := range parts {
+		v, err := eval.Const(p)
+		if err != nil {
+			return "", "", false
+		}
+		sb.WriteString(v.Str())
+	}
+	return sb.String(), Folded, true
+}
+
+// context returns the innermost call holding the current node
+func (e *extractor) context() string {
+	for i := len(e.stack) - 1; i >= 0; i-- {
+		if call, ok := e.stack[i].(*ast.CallExpr); ok {
+			return call.CalleeName()
+		}
+	}
+	return ""
+}
+
+func (e *extractor) add(pos ast.Pos, typ Type, val, src, ctx string) {
+	val = strings.TrimSpace(val)
+	k := key{pos, typ, strings.ToLower(val)}
+	if val == "" || e.seen[k] {
+		return
+	}
+	e.seen[k] = true
+	e.inds = append(e.inds, &Indicator{
+		Type:    typ,
+		Value:   val,
+		Pos:     pos,
+		Func:    e.fn,
+		Source:  src,
+		Context: ctx,
+	})
+}
+
+// arg reports a call argument as typ whatever it looks like
+func (e *extractor) arg(x ast.Expr, typ Type, ctx string) {
+	if s, src, ok := e.str(x); ok {
+		e.add(x.Pos(), typ, s, src, ctx)
+	}
+}
+
+func (e *extractor) call(n *ast.CallExpr) {
+	name := strings.ToLower(n.CalleeName())
+	args := n.Args
+	if len(args) == 0 {
+		return
+	}
+	switch name {
+	case "regread", "regwrite", "regdelete", "regenumkey", "regenumval":
+		e.arg(args[0], Registry, n.CalleeName())
+	case "tcpnametoip":
+		e.arg(args[0], Domain, n.CalleeName())
+	case "tcpconnect", "udpopen", "udpbind", "tcplisten", "ping":
+		if s, _, ok := e.str(args[0]); ok && validIP(s) {
+			e.arg(args[0], IP, n.CalleeName())
+		} else if ok && !strings.ContainsAny(s, " \\/:") && strings.Contains(s, ".") {
+			e.arg(args[0], Domain, n.CalleeName())
+		}
+	case "dllcall":
+		if len(args) < 3 {
+			return
+		}
+		api, _, _ := e.str(args[2])
+		api = strings.ToLower(api)
+		switch {
+		case strings.Contains(api, "mutex"):
+			e.strArgs(n, Mutex, -1)
+		case strings.HasPrefix(api, "createservice"), strings.HasPrefix(api, "openservice"):
+			e.strArgs(n, Service, 1)
+		}
+	}
+}
+
+// strArgs reports the str and wstr values of a DllCall argument list,
+// the first max of them or all when max < 0
+func (e *extractor) strArgs(n *ast.CallExpr, typ Type, max int) {
+	args := n.Args[3:]
+	for i := 0; i+1 < len(args) && max != 0; i += 2 {
+		t, _, _ := e.str(args[i])
+		t = strings.ToLower(t)
+		if t != "str" && t != "wstr" {
+			continue
+		}
+		e.arg(args[i+1], typ, "DllCall")
+		max--
+	}
+}
+
+// scan matches the patterns against a string
+func (e *extractor) scan(pos ast.Pos, s, src string) {
+	ctx := e.context()
+	rest := []byte(s)
+	blank := func(loc []int) {
+		for i := loc[0]; i < loc[1]; i++ {
+			rest[i] = ' '
+		}
+	}
+	host := func(h string) {
+		if validIP(h) {
+			e.add(pos, IP, h, src, ctx)
+		} else if h != "" {
+			e.add(pos, Domain, h, src, ctx)
+		}
+	}
+	for _, loc := range reURL.FindAllIndex(rest, -1) {
+		url := strings.TrimRight(s[loc[0]:loc[1]], ".,;")
+		e.add(pos, URL, url, src, ctx)
+		host(hostOf(url))
+		blank(loc)
+	}
+	for _, loc := range reEmail.FindAllIndex(rest, -1) {
+		e.add(pos, Email, s[loc[0]:loc[1]], src, ctx)
+		blank(loc)
+	}
+	for _, loc := range reRegistry.FindAllIndex(rest, -1) {
+		e.add(pos, Registry, s[loc[0]:loc[1]], src, ctx)
+		blank(loc)
+	}
+	for _, m := range reService.FindAllStringSubmatch(string(rest), -1) {
+		e.add(pos, Service, m[1]+m[2], src, ctx)
+	}
+	if reTask.Match(rest) {
+		e.add(pos, Task, s, src, ctx)
+	}
+	for off := 0; ; {
+		loc := rePath.FindIndex(rest[off:])
+		if loc == nil {
+			break
+		}
+		loc[0], loc[1] = loc[0]+off, loc[1]+off
+		// a path ends where an argument or another path starts, or at a
+		// space after its extension
+		if cut := rePathEnd.FindIndex(rest[loc[0]+1 : loc[1]]); cut != nil {
+			loc[1] = loc[0] + 1 + cut[0]
+		}
+		if m := reExtEnd.FindSubmatchIndex(rest[loc[0]:loc[1]]); m != nil {
+			loc[1] = loc[0] + m[2]
+		}
+		e.add(pos, Path, s[loc[0]:loc[1]], src, ctx)
+		blank(loc)
+		off = loc[1]
+	}
+	for _, loc := range reIP.FindAllIndex(rest, -1) {
+		if ip := s[loc[0]:loc[1]]; validIP(ip) {
+			e.add(pos, IP, ip, src, ctx)
+			blank(loc)
+		}
+	}
+	for _, m := range reDomain.FindAllSubmatchIndex(rest, -1) {
+		if isTLD(s[m[2]:m[3]]) {
+			e.add(pos, Domain, strings.ToLower(s[m[0]:m[1]]), src, ctx)
+		}
+	}
+}
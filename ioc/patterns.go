@@ -0,0 +1,59 @@
+package ioc
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+var (
+	reURL      = regexp.MustCompile(`(?i)\b(?:https?|ftp)://[^\s"'<>()\[\]{}|\\^` + "`" + `]+`)
+	reIP       = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	reEmail    = regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)
+	reDomain   = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+([a-z]{2,24})\b`)
+	rePath     = regexp.MustCompile(`(?i)(?:\b[a-z]:\\|\\\\[a-z0-9][a-z0-9._$-]*\\|%[a-z_]+%\\)[^"*?<>|\r\n]*`)
+	reRegistry = regexp.MustCompile(`(?i)\b(?:HKLM|HKCU|HKCR|HKU|HKCC|HKEY_LOCAL_MACHINE|HKEY_CURRENT_USER|HKEY_CLASSES_ROOT|HKEY_USERS|HKEY_CURRENT_CONFIG)(?:64)?\\[^"\r\n]*`)
+	rePathEnd  = regexp.MustCompile(`(?i)\s+(?:[a-z]:\\|%[a-z_]+%\\|[/-]\w|&|\|)`)
+	reExtEnd   = regexp.MustCompile(`\.[A-Za-z0-9]{1,4}(\s)`)
+	reService  = regexp.MustCompile(`(?i)\bsc(?:\.exe)?\s+(?:create|config|start|delete)\s+"?([^\s"]+)|New-Service\s+(?:-Name\s+)?"?([^\s"]+)`)
+	reTask     = regexp.MustCompile(`(?i)\bschtasks(?:\.exe)?\b.*/create\b.*`)
+)
+
+// TLDs accepted for bare domain names, so file names such as
+// kernel32.dll aren't taken for domains.
+var TLDs = []string{
+	"com", "net", "org", "info", "biz", "io", "co", "me", "xyz", "top",
+	"online", "site", "club", "ru", "su", "cn", "de", "uk", "fr", "nl",
+	"br", "in", "ir", "kr", "jp", "pl", "ua", "tk", "ml", "ga", "cf",
+	"gq", "cc", "pw", "ws", "us", "eu", "tv", "onion", "duckdns", "ngrok",
+}
+
+func isTLD(s string) bool {
+	s = strings.ToLower(s)
+	for _, t := range TLDs {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
+func validIP(s string) bool {
+	ip := net.ParseIP(s)
+	return ip != nil && ip.To4() != nil && !ip.IsUnspecified()
+}
+
+// hostOf returns the host of a URL
+func hostOf(url string) string {
+	s := url[strings.Index(url, "://")+3:]
+	if i := strings.IndexAny(s, "/?#"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.LastIndexByte(s, '@'); i >= 0 {
+		s = s[i+1:]
+	}
+	if h, _, err := net.SplitHostPort(s); err == nil {
+		s = h
+	}
+	return strings.ToLower(s)
+}
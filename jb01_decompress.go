@@ -1,6 +1,10 @@
 package libautoit
 
-import "encoding/binary"
+import (
+	"context"
+	"encoding/binary"
+	"io"
+)
 
 // Open Source Implementation of JB01 Decompressor
 // from https://www.autoitscript.com/site/code/
@@ -59,9 +63,19 @@ type jb01Decomp struct {
 	nHuffmanOffsetsLeft       int
 	bHuffmanOffsetFullyActive bool
 	nHuffmanOffsetIncrement   int
+
+	in  io.ByteReader // instead of inputBuffer when streaming
+	err error
 }
 
 func (r *jb01Decomp) Decompress() ([]byte, error) {
+	return r.decompress(context.Background(), 0)
+}
+
+func (r *jb01Decomp) decompress(ctx context.Context, maxSize int) ([]byte, error) {
+	if len(r.inputBuffer) < 8 {
+		return nil, ErrInvalidSignature
+	}
 	maxPos := r.decompressedSize
 	_ = u32(r.inputBuffer[:4]) // JB01, JB00
 	size := int(binary.BigEndian.Uint32(r.inputBuffer[4:8]))
@@ -71,26 +85,27 @@ func (r *jb01Decomp) Decompress() ([]byte, error) {
 		r.decompressedSize = size
 		r.nDataSize = size
 	}
+	if maxSize > 0 && r.decompressedSize > maxSize {
+		return nil, ErrResourceTooLarge
+	}
 	r.outputBuffer = make([]byte, r.decompressedSize)
+	nPages := 0
 	for r.nDataPos < r.decompressedSize {
-		nTemp := r.compressedStreamReadLiteral()
-		if nTemp < Jb01HuffLiteralLenstart {
-			r.bData[r.nDataPos&Jb01DataMask] = byte(nTemp)
-			r.nDataPos++
-			r.nDataUsed++
-		} else {
-			nLen := Jb01Minmatchlen + r.compressedStreamReadLen(nTemp)
-			nOffset := int(r.compressedStreamReadOffset())
-			nTempPos := r.nDataPos - nOffset
-			for nLen > 0 {
-				nLen--
-				r.bData[r.nDataPos&Jb01DataMask] = r.bData[nTempPos&Jb01DataMask]
-				nTempPos++
-				r.nDataPos++
-				r.nDataUsed++
+		if r.nDataPos/4096 != nPages {
+			nPages = r.nDataPos / 4096
+			if err := ctx.Err(); err != nil {
+				return nil, err
 			}
 		}
+		r.symbol()
+		if r.err != nil {
+			return nil, r.err
+		}
 		for r.nDataWritePos < r.nDataPos {
+			// a match running past the end
+			if r.outPos >= len(r.outputBuffer) {
+				return nil, ErrDecompressFailed
+			}
 			r.outputBuffer[r.outPos] = r.bData[r.nDataWritePos&Jb01DataMask]
 			r.outPos++
 			r.nDataWritePos++
@@ -100,6 +115,27 @@ func (r *jb01Decomp) Decompress() ([]byte, error) {
 	return r.outputBuffer, nil
 }
 
+// symbol decodes a literal or a match into the window
+func (r *jb01Decomp) symbol() {
+	nTemp := r.compressedStreamReadLiteral()
+	if nTemp < Jb01HuffLiteralLenstart {
+		r.bData[r.nDataPos&Jb01DataMask] = byte(nTemp)
+		r.nDataPos++
+		r.nDataUsed++
+	} else {
+		nLen := Jb01Minmatchlen + r.compressedStreamReadLen(nTemp)
+		nOffset := int(r.compressedStreamReadOffset())
+		nTempPos := r.nDataPos - nOffset
+		for nLen > 0 {
+			nLen--
+			r.bData[r.nDataPos&Jb01DataMask] = r.bData[nTempPos&Jb01DataMask]
+			nTempPos++
+			r.nDataPos++
+			r.nDataUsed++
+		}
+	}
+}
+
 func (r *jb01Decomp) compressedStreamReadOffset() uint32 {
 	nCode := r.compressedStreamReadHuffman(r.huffmanOffsetTree, Jb01HuffOffsetAlphabetsize)
 	r.huffmanOffsetTree[nCode].nFrequency++
@@ -192,6 +228,26 @@ func (r *jb01Decomp) compressedStreamReadBits(nbits int) uint32 {
 }
 
 func (r *jb01Decomp) nextWord() uint32 {
+	if r.in != nil {
+		a, err := r.in.ReadByte()
+		var b byte
+		if err == nil {
+			b, err = r.in.ReadByte()
+		}
+		if err != nil {
+			if r.err == nil {
+				r.err = io.ErrUnexpectedEOF
+			}
+			return 0
+		}
+		return uint32(a)<<8 | uint32(b)
+	}
+	if r.inPos+2 > len(r.inputBuffer) {
+		if r.err == nil {
+			r.err = ErrOutOfBounds
+		}
+		return 0
+	}
 	tmp := uint32(r.inputBuffer[r.inPos]) << 8
 	tmp |= uint32(r.inputBuffer[r.inPos+1])
 	r.inPos += 2
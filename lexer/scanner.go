@@ -1,8 +1,10 @@
 package lexer
 
 import (
+	"bufio"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"math"
 	"strings"
 	"unicode/utf16"
@@ -133,6 +135,7 @@ type Lexer struct {
 	mark       int // trackback
 	state      int
 	fieldName  string
+	in         io.ByteReader // instead of src when streaming
 }
 
 func (lex *Lexer) NumberOfLines() int {
@@ -147,6 +150,27 @@ func NewLexer(inStream []byte) ITokenizer {
 	}
 }
 
+// NewLexerReader is NewLexer reading the compiled script from r as the
+// tokens are consumed, for example from a decompressing reader.
+func NewLexerReader(r io.Reader) (ITokenizer, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	var hdr [4]byte
+	for i := range hdr {
+		c, err := br.ReadByte()
+		if err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		hdr[i] = c
+	}
+	return &Lexer{
+		in:     br,
+		nLines: int(binary.LittleEndian.Uint32(hdr[:])),
+	}, nil
+}
+
 func (tt TokenType) String() string {
 	return Au3TokenTypes[tt]
 }
@@ -246,7 +270,13 @@ func GetTokenFromID(tokID int) Token {
 }
 
 func (lex *Lexer) nextByte() byte {
-	if lex.readOffset >= len(lex.src) {
+	if lex.in != nil {
+		if c, err := lex.in.ReadByte(); err == nil {
+			lex.ch = int(c)
+		} else {
+			lex.ch = -1
+		}
+	} else if lex.readOffset >= len(lex.src) {
 		lex.ch = -1
 	} else {
 		lex.ch = int(lex.src[lex.readOffset])
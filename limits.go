@@ -0,0 +1,85 @@
+package libautoit
+
+import (
+	"context"
+	"github.com/x0r19x91/libautoit/progress"
+	"time"
+)
+
+// Limits bound the work done on a file from an untrusted source, zero
+// fields are not enforced. Sizes are checked against the headers before
+// anything is allocated.
+type Limits struct {
+	MaxTotal     int64     // bytes decompressed over all resources
+	MaxResource  int64     // bytes decompressed for one resource
+	MaxResources int       // resources in a file
+	Deadline     time.Time // for unpacking and decompressing
+}
+
+// DefaultLimits are generous for real scripts and stop decompression
+// bombs.
+var DefaultLimits = Limits{
+	MaxTotal:     1 << 30,
+	MaxResource:  256 << 20,
+	MaxResources: 4096,
+}
+
+func (l *Limits) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if l.Deadline.IsZero() {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, l.Deadline)
+}
+
+// GetScriptsContext is GetScripts, stopping when ctx is done and
+// failing with ErrTooManyResources past l.MaxResources. The limits are
+// kept for DecompressContext.
+func GetScriptsContext(ctx context.Context, data []byte, l Limits) (*AutoItFile, error) {
+	defer progress.End(ctx, "")
+	ctx, cancel := l.context(ctx)
+	defer cancel()
+	f, err := getScripts(ctx, data, &l)
+	if f != nil {
+		f.limits = l
+	}
+	return f, err
+}
+
+// DecompressContext decompresses the resources within the limits the file
+// was unpacked with. A resource too large is left compressed and the
+// others are still decompressed. Past the deadline, when ctx is done or
+// l.MaxTotal is reached it stops. The first error is returned.
+func (f *AutoItFile) DecompressContext(ctx context.Context) error {
+	defer progress.End(ctx, "")
+	ctx, cancel := f.limits.context(ctx)
+	defer cancel()
+	var total int64
+	var first error
+	for _, r := range f.Resources {
+		if r.State != Au3Initialized {
+			total += int64(len(r.Data))
+			continue
+		}
+		max, byTotal := f.limits.MaxResource, false
+		if f.limits.MaxTotal > 0 {
+			if left := f.limits.MaxTotal - total; max <= 0 || left < max {
+				max, byTotal = left, true
+			}
+			if max <= 0 {
+				return ErrOutputTooLarge
+			}
+		}
+		err := r.DecompressContext(ctx, max)
+		if err == ErrResourceTooLarge && byTotal {
+			return ErrOutputTooLarge
+		}
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+		total += int64(len(r.Data))
+	}
+	return first
+}
@@ -0,0 +1,119 @@
+package libautoit
+
+import (
+	"context"
+	"crypto/sha256"
+	"github.com/x0r19x91/libautoit/progress"
+)
+
+// DefaultMaxDepth bounds GetScriptsRecursive when no depth is given.
+const DefaultMaxDepth = 8
+
+// GetScriptsRecursive is GetScriptsContext, the resources decompressed,
+// run again on every resource holding a compiled script, down to
+// maxDepth levels below data. Nested files are linked to the resource
+// they were found in and each content is unpacked once, at the
+// shallowest level it appears. The limits apply to every file. A
+// resource that fails to decompress is skipped, the error kept in the Err
+// of its file. The tree is returned with the error of the top file.
+func GetScriptsRecursive(ctx context.Context, data []byte, l Limits, maxDepth int) (*AutoItFile, error) {
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	// a single Done for the whole tree
+	defer progress.End(ctx, "")
+	ctx = progress.Own(ctx)
+	root, err := GetScriptsContext(ctx, data, l)
+	if err != nil {
+		return root, err
+	}
+	// the resources that did decompress are still searched
+	if root.Err = root.DecompressContext(ctx); ctx.Err() != nil {
+		return root, root.Err
+	}
+	b := &budget{limits: l}
+	b.charge(root)
+	seen := map[[sha256.Size]byte]bool{sha256.Sum256(data): true}
+	// breadth first, for the shallowest copy to win
+	queue := []*AutoItFile{root}
+	for len(queue) > 0 {
+		f := queue[0]
+		queue = queue[1:]
+		if f.Depth >= maxDepth {
+			continue
+		}
+		for _, r := range f.Resources {
+			if len(r.Data) == 0 || r.IsCompressed && r.State == Au3Initialized {
+				continue
+			}
+			sum := sha256.Sum256(r.Data)
+			if seen[sum] {
+				continue
+			}
+			seen[sum] = true
+			left, err := b.left()
+			if err != nil {
+				return root, err
+			}
+			child, err := GetScriptsContext(ctx, r.Data, left)
+			if err == ErrScriptNotFound {
+				continue
+			}
+			if err == nil {
+				err = child.DecompressContext(ctx)
+			}
+			if e := ctx.Err(); e != nil {
+				return root, e
+			}
+			if child == nil {
+				child = &AutoItFile{}
+			}
+			b.charge(child)
+			child.Parent, child.Source, child.Depth, child.Err = f, r, f.Depth+1, err
+			f.Children = append(f.Children, child)
+			queue = append(queue, child)
+		}
+	}
+	return root, root.Err
+}
+
+// budget is what the files of a tree have used of its limits
+type budget struct {
+	limits    Limits
+	total     int64
+	resources int
+}
+
+func (b *budget) charge(f *AutoItFile) {
+	b.resources += len(f.Resources)
+	for _, r := range f.Resources {
+		b.total += int64(len(r.Data))
+	}
+}
+
+// left returns the limits of the next file
+func (b *budget) left() (Limits, error) {
+	l := b.limits
+	if l.MaxTotal > 0 {
+		if l.MaxTotal -= b.total; l.MaxTotal <= 0 {
+			return l, ErrOutputTooLarge
+		}
+	}
+	if l.MaxResources > 0 {
+		if l.MaxResources -= b.resources; l.MaxResources <= 0 {
+			return l, ErrTooManyResources
+		}
+	}
+	return l, nil
+}
+
+// Walk calls fn on f and the files nested in it, depth first, skipping
+// the children of a file fn returns false for.
+func (f *AutoItFile) Walk(fn func(*AutoItFile) bool) {
+	if !fn(f) {
+		return
+	}
+	for _, c := range f.Children {
+		c.Walk(fn)
+	}
+}
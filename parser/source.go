@@ -0,0 +1,216 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	lexer2 "github.com/x0r19x91/libautoit/lexer"
+	"math/bits"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// sourceTokenizer scans the text of a script for the tree parser. Unlike
+// lexer.NewTokenizer, which tidy depends on, it keeps the arguments of
+// directives, reads doubled quotes and tabs, and yields brackets and the
+// ternary operator as tokens of their own.
+type sourceTokenizer struct {
+	input     []byte
+	pos       int
+	structRef string // field following a '.'
+}
+
+// NewSourceTokenizer returns the tokenizer ParseSource reads the text of
+// a script with.
+func NewSourceTokenizer(src []byte) lexer2.ITokenizer {
+	src = bytes.ReplaceAll(src, []byte{13, 10}, []byte{10})
+	return &sourceTokenizer{input: append(src, 10)}
+}
+
+func (s *sourceTokenizer) NumberOfLines() int {
+	return bytes.Count(s.input, []byte{10})
+}
+
+func (s *sourceTokenizer) peekAt(i int) byte {
+	if s.pos+i < len(s.input) {
+		return s.input[s.pos+i]
+	}
+	return 0
+}
+
+func (s *sourceTokenizer) ident() string {
+	start := s.pos
+	for s.pos < len(s.input) {
+		c := rune(s.input[s.pos])
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' {
+			break
+		}
+		s.pos++
+	}
+	return string(s.input[start:s.pos])
+}
+
+// strLit reads a literal up to its closing quote, a doubled quote
+// standing for one. An unterminated literal ends at the newline.
+func (s *sourceTokenizer) strLit(q byte) string {
+	start := s.pos
+	s.pos++
+	for s.input[s.pos] != '\n' {
+		c := s.input[s.pos]
+		s.pos++
+		if c == q {
+			if s.input[s.pos] != q {
+				break
+			}
+			s.pos++
+		}
+	}
+	return string(s.input[start:s.pos])
+}
+
+func canonical(list []string, word string) string {
+	for _, w := range list {
+		if strings.EqualFold(w, word) {
+			return w
+		}
+	}
+	return word
+}
+
+func isIn(list []string, word string) bool {
+	for _, w := range list {
+		if strings.EqualFold(w, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatted like the compiled token stream
+func formatInt(u uint64) string {
+	if bits.Len64(u) <= 32 {
+		if n := int32(u); n < 0 {
+			return fmt.Sprintf("%d", n)
+		}
+		return fmt.Sprintf("%#x", int32(u))
+	}
+	if n := int64(u); n < 0 {
+		return fmt.Sprintf("%d", n)
+	}
+	return fmt.Sprintf("%#x", int64(u))
+}
+
+func (s *sourceTokenizer) number() *lexer2.Token {
+	if c := s.peekAt(1); s.input[s.pos] == '0' && (c == 'x' || c == 'X') {
+		s.pos += 2
+		var u uint64
+		for {
+			d := strings.IndexRune("0123456789abcdef", unicode.ToLower(rune(s.input[s.pos])))
+			if d < 0 {
+				break
+			}
+			s.pos++
+			u = u*16 + uint64(d)
+		}
+		if bits.Len64(u) <= 32 {
+			return &lexer2.Token{TokType: lexer2.Int32, Value: formatInt(u)}
+		}
+		return &lexer2.Token{TokType: lexer2.Int64, Value: formatInt(u)}
+	}
+	start := s.pos
+	for strings.IndexByte("0123456789.eE", s.input[s.pos]) >= 0 ||
+		(s.input[s.pos] == '+' || s.input[s.pos] == '-') && (s.input[s.pos-1] == 'e' || s.input[s.pos-1] == 'E') {
+		s.pos++
+	}
+	buf := strings.ToLower(string(s.input[start:s.pos]))
+	if _, err := strconv.ParseInt(buf, 10, 32); err == nil {
+		return &lexer2.Token{TokType: lexer2.Int32, Value: buf}
+	}
+	if _, err := strconv.ParseInt(buf, 10, 64); err == nil {
+		return &lexer2.Token{TokType: lexer2.Int64, Value: buf}
+	}
+	if _, err := strconv.ParseFloat(buf, 64); err == nil {
+		return &lexer2.Token{TokType: lexer2.Float64, Value: buf}
+	}
+	s.pos = start
+	return nil
+}
+
+var sourceOps = []struct {
+	op  string
+	typ lexer2.TokenType
+}{
+	{"+=", lexer2.OpAddEq}, {"-=", lexer2.OpSubEq}, {"*=", lexer2.OpMulEq},
+	{"/=", lexer2.OpDivEq}, {"&=", lexer2.OpConcatAssign}, {">=", lexer2.OpGe},
+	{"<=", lexer2.OpLe}, {"==", lexer2.OpStrEq}, {"<>", lexer2.OpNe},
+	{"^", lexer2.OpExp}, {"*", lexer2.OpMul}, {"/", lexer2.OpDiv},
+	{"+", lexer2.OpAdd}, {"-", lexer2.OpSub}, {"&", lexer2.OpConcat},
+	{">", lexer2.OpGt}, {"<", lexer2.OpLt}, {"=", lexer2.OpAssign},
+	{"?", lexer2.OpTernaryQuestion}, {":", lexer2.OpTernaryColon},
+	{"(", lexer2.LParen}, {")", lexer2.RParen}, {"[", lexer2.LBracket},
+	{"]", lexer2.RBracket}, {",", lexer2.Comma},
+}
+
+func (s *sourceTokenizer) NextToken() *lexer2.Token {
+	if s.structRef != "" {
+		field := s.structRef
+		s.structRef = ""
+		return &lexer2.Token{TokType: lexer2.StructField, Value: field}
+	}
+	for s.pos < len(s.input) && (s.input[s.pos] == ' ' || s.input[s.pos] == '\t') {
+		s.pos++
+	}
+	if s.pos >= len(s.input) {
+		return &lexer2.Token{TokType: lexer2.EOF, Value: ""}
+	}
+	c := s.input[s.pos]
+	switch {
+	case c == '\n':
+		s.pos++
+		return &lexer2.Token{TokType: lexer2.EOL, Value: "\n"}
+	case c == ';':
+		for s.input[s.pos] != '\n' {
+			s.pos++
+		}
+		return &lexer2.Token{TokType: lexer2.EOL, Value: ""}
+	case c >= '0' && c <= '9' || c == '.' && s.peekAt(1) >= '0' && s.peekAt(1) <= '9':
+		if t := s.number(); t != nil {
+			return t
+		}
+	case c == '#':
+		// the arguments stay with the directive
+		start := s.pos
+		for s.input[s.pos] != '\n' {
+			s.pos++
+		}
+		return &lexer2.Token{TokType: lexer2.Directive, Value: strings.TrimRight(string(s.input[start:s.pos]), " \t\r")}
+	case c == '$':
+		s.pos++
+		return &lexer2.Token{TokType: lexer2.Identifier, Value: "$" + s.ident()}
+	case c == '@':
+		s.pos++
+		return &lexer2.Token{TokType: lexer2.Macro, Value: "@" + canonical(lexer2.Au3Macros, s.ident())}
+	case c == '"' || c == '\'':
+		return &lexer2.Token{TokType: lexer2.StrLit, Value: s.strLit(c)}
+	case c == '.':
+		s.pos++
+		s.structRef = s.ident()
+		return &lexer2.Token{TokType: lexer2.OpStructRef, Value: "."}
+	}
+	if word := s.ident(); word != "" {
+		switch {
+		case isIn(lexer2.Au3Keywords, word):
+			return &lexer2.Token{TokType: lexer2.Keyword, Value: canonical(lexer2.Au3Keywords, word)}
+		case isIn(lexer2.Au3StdFunctions, word):
+			return &lexer2.Token{TokType: lexer2.StdFunction, Value: canonical(lexer2.Au3StdFunctions, word)}
+		}
+		return &lexer2.Token{TokType: lexer2.UserFunction, Value: canonical(lexer2.Au3UserFunctions, word)}
+	}
+	for _, op := range sourceOps {
+		if bytes.HasPrefix(s.input[s.pos:], []byte(op.op)) {
+			s.pos += len(op.op)
+			return &lexer2.Token{TokType: op.typ, Value: op.op}
+		}
+	}
+	return &lexer2.TokenInvalid
+}
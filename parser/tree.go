@@ -0,0 +1,849 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/x0r19x91/libautoit/ast"
+	lexer2 "github.com/x0r19x91/libautoit/lexer"
+	"strconv"
+	"strings"
+)
+
+// Error is a syntax error found while building a tree.
+type Error struct {
+	Pos ast.Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Pos.Line, e.Msg)
+}
+
+// ErrorList is returned by ParseScript when some lines could not be
+// parsed. Those lines are kept in the tree as *ast.BadStmt.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// bailout is used to unwind to the start of the current statement
+type bailout struct{}
+
+type treeParser struct {
+	toks     []*lexer2.Token
+	lines    []int
+	pos      int
+	tok      *lexer2.Token
+	errs     ErrorList
+	goQuoted bool       // string literals are quoted with %q
+	closers  [][]string // terminators of the enclosing blocks
+}
+
+// ParseScript builds the syntax tree of a script. It returns a tree
+// even if some lines fail to parse, together with an ErrorList.
+func ParseScript(lex lexer2.ITokenizer) (*ast.Script, error) {
+	p := newTreeParser(lex)
+	script := &ast.Script{}
+	for {
+		p.skipEOL()
+		if p.at(lexer2.EOF) {
+			break
+		}
+		script.Stmts = append(script.Stmts, p.parseStmt())
+	}
+	if len(p.errs) > 0 {
+		return script, p.errs
+	}
+	return script, nil
+}
+
+// ParseSource parses the text of a script.
+func ParseSource(src []byte) (*ast.Script, error) {
+	return ParseScript(NewSourceTokenizer(src))
+}
+
+// ParseExpr parses a single expression, as passed to Execute.
+func ParseExpr(lex lexer2.ITokenizer) (expr ast.Expr, err error) {
+	p := newTreeParser(lex)
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			expr, err = nil, p.errs
+		}
+	}()
+	p.skipEOL()
+	expr = p.parseExpr()
+	p.skipEOL()
+	if !p.at(lexer2.EOF) {
+		p.errorf("unexpected %s after expression", p.tok.Value)
+	}
+	if len(p.errs) > 0 {
+		return expr, p.errs
+	}
+	return expr, nil
+}
+
+func newTreeParser(lex lexer2.ITokenizer) *treeParser {
+	p := &treeParser{}
+	_, p.goQuoted = lex.(*lexer2.Lexer)
+	line := 1
+	continued := false
+	for {
+		t := lex.NextToken()
+		if t.TokType == lexer2.EOF {
+			break
+		}
+		if t.TokType == lexer2.InvalidToken {
+			p.errs = append(p.errs, &Error{
+				Pos: ast.Pos{Line: line, Token: len(p.toks)},
+				Msg: "invalid token",
+			})
+			break
+		}
+		tok := *t
+		switch {
+		case tok.TokType == lexer2.Keyword && strings.EqualFold(tok.Value, "And"):
+			tok.TokType = lexer2.OpAnd
+		case tok.TokType == lexer2.Keyword && strings.EqualFold(tok.Value, "Or"):
+			tok.TokType = lexer2.OpOr
+		case tok.TokType == lexer2.Keyword && strings.EqualFold(tok.Value, "Not"):
+			tok.TokType = lexer2.OpNot
+		case tok.TokType == lexer2.LParen && tok.Value == "[":
+			tok.TokType = lexer2.LBracket
+		case tok.TokType == lexer2.RParen && tok.Value == "]":
+			tok.TokType = lexer2.RBracket
+		}
+		if tok.TokType == lexer2.EOL {
+			if tok.Value == "" {
+				// end of a comment, the newline follows
+				continue
+			}
+			line++
+			if continued {
+				// "_" at the end of the line joins it with the next one
+				continued = false
+				continue
+			}
+		}
+		if continued {
+			// the "_" was a plain identifier after all
+			p.toks = append(p.toks, &lexer2.Token{TokType: lexer2.UserFunction, Value: "_"})
+			p.lines = append(p.lines, line)
+			continued = false
+		}
+		if tok.TokType == lexer2.UserFunction && tok.Value == "_" {
+			continued = true
+			continue
+		}
+		p.toks = append(p.toks, &tok)
+		p.lines = append(p.lines, line)
+	}
+	p.toks = append(p.toks, &lexer2.Token{TokType: lexer2.EOF, Value: "EOF"})
+	p.lines = append(p.lines, line)
+	p.tok = p.toks[0]
+	return p
+}
+
+func (p *treeParser) next() {
+	if p.pos < len(p.toks)-1 {
+		p.pos++
+	}
+	p.tok = p.toks[p.pos]
+}
+
+func (p *treeParser) peek() *lexer2.Token {
+	if p.pos+1 < len(p.toks) {
+		return p.toks[p.pos+1]
+	}
+	return p.toks[len(p.toks)-1]
+}
+
+func (p *treeParser) posOf(i int) ast.Pos {
+	return ast.Pos{Line: p.lines[i], Token: i}
+}
+
+func (p *treeParser) position() ast.Pos {
+	return p.posOf(p.pos)
+}
+
+func (p *treeParser) at(tt lexer2.TokenType) bool {
+	return p.tok.TokType == tt
+}
+
+func (p *treeParser) atEOL() bool {
+	return p.at(lexer2.EOL) || p.at(lexer2.EOF)
+}
+
+func isKeyword(t *lexer2.Token, names ...string) bool {
+	if t.TokType != lexer2.Keyword {
+		return false
+	}
+	for _, n := range names {
+		if strings.EqualFold(t.Value, n) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *treeParser) atKeyword(names ...string) bool {
+	return isKeyword(p.tok, names...)
+}
+
+// record an error without giving up on the statement
+func (p *treeParser) report(pos ast.Pos, format string, args ...interface{}) {
+	p.errs = append(p.errs, &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// record an error and give up on the statement
+func (p *treeParser) errorf(format string, args ...interface{}) {
+	p.report(p.position(), format, args...)
+	panic(bailout{})
+}
+
+func (p *treeParser) expect(tt lexer2.TokenType, what string) ast.Pos {
+	pos := p.position()
+	if !p.at(tt) {
+		p.errorf("expected %s, found %q", what, p.tok.Value)
+	}
+	p.next()
+	return pos
+}
+
+func (p *treeParser) expectKeyword(name string) ast.Pos {
+	pos := p.position()
+	if !p.atKeyword(name) {
+		p.errorf("expected %s, found %q", name, p.tok.Value)
+	}
+	p.next()
+	return pos
+}
+
+func (p *treeParser) expectEOL() {
+	if !p.atEOL() {
+		p.errorf("expected end of line, found %q", p.tok.Value)
+	}
+	p.next()
+}
+
+func (p *treeParser) skipEOL() {
+	for p.at(lexer2.EOL) {
+		p.next()
+	}
+}
+
+// statements
+
+func (p *treeParser) parseStmt() (s ast.Stmt) {
+	start := p.pos
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			for !p.atEOL() {
+				p.next()
+			}
+			s = &ast.BadStmt{From: p.posOf(start), Tokens: p.toks[start:p.pos]}
+			p.next()
+		}
+	}()
+
+	if p.at(lexer2.Directive) {
+		return p.parseDirective()
+	}
+	if p.at(lexer2.Keyword) {
+		switch strings.ToLower(p.tok.Value) {
+		case "func", "volatile":
+			return p.parseFunc()
+		case "if":
+			s := p.parseIf()
+			if s.SingleLine {
+				p.expectEOL()
+			}
+			return s
+		case "while":
+			return p.parseWhile()
+		case "do":
+			return p.parseDo()
+		case "for":
+			return p.parseFor()
+		case "select":
+			return p.parseSelect()
+		case "switch":
+			return p.parseSwitch()
+		case "with":
+			return p.parseWith()
+		}
+	}
+	s = p.parseSimpleStmt()
+	p.expectEOL()
+	return s
+}
+
+// parseSimpleStmt parses a statement that fits on a single line
+func (p *treeParser) parseSimpleStmt() ast.Stmt {
+	pos := p.position()
+	if p.at(lexer2.Keyword) {
+		switch strings.ToLower(p.tok.Value) {
+		case "global", "local", "dim", "static", "const":
+			return p.parseDecl()
+		case "return":
+			p.next()
+			s := &ast.ReturnStmt{Return: pos}
+			if !p.atEOL() {
+				s.Result = p.parseExpr()
+			}
+			return s
+		case "exit":
+			p.next()
+			s := &ast.ExitStmt{Exit: pos}
+			if !p.atEOL() {
+				s.Code = p.parseExpr()
+			}
+			return s
+		case "exitloop", "continueloop", "continuecase":
+			s := &ast.BranchStmt{TokPos: pos, Tok: p.tok.Value}
+			p.next()
+			if !p.atEOL() {
+				s.Level = p.parseExpr()
+			}
+			return s
+		case "redim":
+			p.next()
+			return &ast.ReDimStmt{ReDimPos: pos, X: p.parsePostfix()}
+		case "true", "false", "null", "default":
+			// an expression statement
+		default:
+			p.errorf("unexpected %s", p.tok.Value)
+		}
+	}
+
+	lhs := p.parsePostfix()
+	if p.tok.TokType.IsAssignOp() {
+		switch lhs.(type) {
+		case *ast.Variable, *ast.IndexExpr, *ast.SelectorExpr, *ast.MacroExpr:
+		default:
+			p.errorf("cannot assign to %s", ast.ExprString(lhs))
+		}
+		op := p.tok.TokType
+		opPos := p.position()
+		p.next()
+		return &ast.AssignStmt{Lhs: lhs, TokPos: opPos, Op: op, Rhs: p.parseExpr()}
+	}
+	return &ast.ExprStmt{X: lhs}
+}
+
+func (p *treeParser) parseDirective() ast.Stmt {
+	pos := p.position()
+	text := p.tok.Value
+	p.next()
+	var rest strings.Builder
+	for !p.atEOL() {
+		rest.WriteString(p.tok.Value)
+		if p.at(lexer2.Comma) {
+			rest.WriteByte(' ')
+		}
+		p.next()
+	}
+	if rest.Len() > 0 {
+		text = strings.TrimSpace(text) + " " + rest.String()
+	}
+	p.next()
+	return &ast.DirectiveStmt{DirPos: pos, Text: text}
+}
+
+func (p *treeParser) parseDecl() ast.Stmt {
+	pos := p.position()
+	var scope string
+	var static, isConst bool
+	for p.atKeyword("Global", "Local", "Dim", "Static", "Const") {
+		switch strings.ToLower(p.tok.Value) {
+		case "static":
+			static = true
+		case "const":
+			isConst = true
+		default:
+			scope = p.tok.Value
+		}
+		p.next()
+	}
+	if p.atKeyword("Enum") {
+		return p.parseEnum(pos, scope, isConst)
+	}
+	decl := &ast.DeclStmt{DeclPos: pos, Scope: scope, Static: static, Const: isConst}
+	for {
+		decl.Specs = append(decl.Specs, p.parseVarSpec(true))
+		if !p.at(lexer2.Comma) {
+			break
+		}
+		p.next()
+	}
+	return decl
+}
+
+func (p *treeParser) parseVariable() *ast.Variable {
+	pos := p.position()
+	if !p.at(lexer2.Identifier) {
+		p.errorf("expected variable, found %q", p.tok.Value)
+	}
+	name := strings.TrimPrefix(p.tok.Value, "$")
+	p.next()
+	return &ast.Variable{NamePos: pos, Name: name}
+}
+
+func (p *treeParser) parseVarSpec(allowDims bool) *ast.VarSpec {
+	spec := &ast.VarSpec{Name: p.parseVariable()}
+	for allowDims && p.at(lexer2.LBracket) {
+		p.next()
+		spec.Dims = append(spec.Dims, p.parseExpr())
+		p.expect(lexer2.RBracket, "']'")
+	}
+	if p.at(lexer2.OpAssign) {
+		p.next()
+		spec.Value = p.parseExpr()
+	}
+	return spec
+}
+
+func (p *treeParser) parseEnum(pos ast.Pos, scope string, isConst bool) ast.Stmt {
+	p.next() // Enum
+	enum := &ast.EnumStmt{EnumPos: pos, Scope: scope, Const: isConst}
+	if p.atKeyword("Step") {
+		p.next()
+		switch p.tok.TokType {
+		case lexer2.OpAdd, lexer2.OpSub, lexer2.OpMul:
+			enum.StepOp = p.tok.TokType
+			p.next()
+		}
+		enum.Step = p.parsePrimary()
+	}
+	for {
+		enum.Specs = append(enum.Specs, p.parseVarSpec(false))
+		if !p.at(lexer2.Comma) {
+			break
+		}
+		p.next()
+	}
+	return enum
+}
+
+func (p *treeParser) parseFunc() ast.Stmt {
+	pos := p.position()
+	fn := &ast.FuncDecl{Func: pos}
+	if p.atKeyword("Volatile") {
+		fn.Volatile = true
+		p.next()
+	}
+	p.expectKeyword("Func")
+	if !p.at(lexer2.UserFunction) && !p.at(lexer2.StdFunction) {
+		p.errorf("expected function name, found %q", p.tok.Value)
+	}
+	fn.Name = &ast.FuncIdent{NamePos: p.position(), Name: p.tok.Value}
+	p.next()
+	p.expect(lexer2.LParen, "'('")
+	for !p.at(lexer2.RParen) {
+		fn.Params = append(fn.Params, p.parseParam())
+		if !p.at(lexer2.Comma) {
+			break
+		}
+		p.next()
+	}
+	p.expect(lexer2.RParen, "')'")
+	p.expectEOL()
+	fn.Body = p.parseBlock("EndFunc", "Func")
+	p.closeBlock(fn.Func, "EndFunc")
+	return fn
+}
+
+func (p *treeParser) parseParam() *ast.Param {
+	par := &ast.Param{}
+	for p.atKeyword("ByRef", "Const") {
+		if strings.EqualFold(p.tok.Value, "ByRef") {
+			par.ByRef = true
+		} else {
+			par.Const = true
+		}
+		p.next()
+	}
+	par.Name = p.parseVariable()
+	if p.at(lexer2.OpAssign) {
+		p.next()
+		par.Default = p.parseExpr()
+	}
+	return par
+}
+
+// parseBlock parses statements up to one of the closing keywords, which
+// is left for the caller. Closers of the enclosing blocks also stop it
+// so a missing EndIf doesn't swallow the rest of the function.
+func (p *treeParser) parseBlock(closers ...string) *ast.BlockStmt {
+	block := &ast.BlockStmt{Start: p.position()}
+	p.closers = append(p.closers, closers)
+	defer func() {
+		p.closers = p.closers[:len(p.closers)-1]
+	}()
+	for {
+		p.skipEOL()
+		if p.at(lexer2.EOF) {
+			return block
+		}
+		for i := len(p.closers) - 1; i >= 0; i-- {
+			if p.atKeyword(p.closers[i]...) {
+				return block
+			}
+		}
+		block.List = append(block.List, p.parseStmt())
+	}
+}
+
+// closeBlock consumes the line closing a block, a missing closer is
+// reported but doesn't fail the block
+func (p *treeParser) closeBlock(open ast.Pos, name string) {
+	if !p.atKeyword(name) {
+		p.report(p.position(), "expected %s for block at line %d, found %q", name, open.Line, p.tok.Value)
+		return
+	}
+	p.next()
+	if !p.atEOL() {
+		p.report(p.position(), "expected end of line after %s", name)
+		for !p.atEOL() {
+			p.next()
+		}
+	}
+}
+
+func (p *treeParser) parseIf() *ast.IfStmt {
+	pos := p.position()
+	p.next()
+	cond := p.parseExpr()
+	p.expectKeyword("Then")
+	if !p.atEOL() {
+		body := p.parseSimpleStmt()
+		return &ast.IfStmt{
+			If:         pos,
+			Cond:       cond,
+			Body:       &ast.BlockStmt{Start: body.Pos(), List: []ast.Stmt{body}},
+			SingleLine: true,
+		}
+	}
+	p.expectEOL()
+	s := &ast.IfStmt{If: pos, Cond: cond}
+	s.Body = p.parseBlock("ElseIf", "Else", "EndIf")
+	curr := s
+	for p.atKeyword("ElseIf") {
+		elsePos := p.position()
+		p.next()
+		cond := p.parseExpr()
+		p.expectKeyword("Then")
+		p.expectEOL()
+		elseIf := &ast.IfStmt{If: elsePos, Cond: cond}
+		elseIf.Body = p.parseBlock("ElseIf", "Else", "EndIf")
+		curr.Else = elseIf
+		curr = elseIf
+	}
+	if p.atKeyword("Else") {
+		p.next()
+		p.expectEOL()
+		curr.Else = p.parseBlock("EndIf")
+	}
+	p.closeBlock(pos, "EndIf")
+	return s
+}
+
+func (p *treeParser) parseWhile() ast.Stmt {
+	pos := p.position()
+	p.next()
+	s := &ast.WhileStmt{While: pos, Cond: p.parseExpr()}
+	p.expectEOL()
+	s.Body = p.parseBlock("WEnd")
+	p.closeBlock(pos, "WEnd")
+	return s
+}
+
+func (p *treeParser) parseDo() ast.Stmt {
+	pos := p.position()
+	p.next()
+	p.expectEOL()
+	s := &ast.DoStmt{Do: pos}
+	s.Body = p.parseBlock("Until")
+	if !p.atKeyword("Until") {
+		p.report(p.position(), "expected Until for block at line %d, found %q", pos.Line, p.tok.Value)
+		s.Cond = &ast.BadExpr{From: p.position()}
+		return s
+	}
+	p.next()
+	s.Cond = p.parseExpr()
+	p.expectEOL()
+	return s
+}
+
+func (p *treeParser) parseFor() ast.Stmt {
+	pos := p.position()
+	p.next()
+	v := p.parseVariable()
+	if p.atKeyword("In") {
+		p.next()
+		s := &ast.ForInStmt{For: pos, Var: v, X: p.parseExpr()}
+		p.expectEOL()
+		s.Body = p.parseBlock("Next")
+		p.closeBlock(pos, "Next")
+		return s
+	}
+	p.expect(lexer2.OpAssign, "'='")
+	s := &ast.ForStmt{For: pos, Var: v, From: p.parseExpr()}
+	p.expectKeyword("To")
+	s.To = p.parseExpr()
+	if p.atKeyword("Step") {
+		p.next()
+		s.Step = p.parseExpr()
+	}
+	p.expectEOL()
+	s.Body = p.parseBlock("Next")
+	p.closeBlock(pos, "Next")
+	return s
+}
+
+func (p *treeParser) parseSelect() ast.Stmt {
+	pos := p.position()
+	p.next()
+	p.expectEOL()
+	s := &ast.SelectStmt{Select: pos}
+	p.skipEOL()
+	for p.atKeyword("Case") {
+		casePos := p.position()
+		p.next()
+		cc := &ast.CaseClause{Case: casePos}
+		if p.atKeyword("Else") {
+			p.next()
+		} else {
+			cc.List = []ast.Expr{p.parseExpr()}
+		}
+		p.expectEOL()
+		cc.Body = p.parseBlock("Case", "EndSelect")
+		s.Cases = append(s.Cases, cc)
+	}
+	p.closeBlock(pos, "EndSelect")
+	return s
+}
+
+func (p *treeParser) parseSwitch() ast.Stmt {
+	pos := p.position()
+	p.next()
+	s := &ast.SwitchStmt{Switch: pos, Tag: p.parseExpr()}
+	p.expectEOL()
+	p.skipEOL()
+	for p.atKeyword("Case") {
+		casePos := p.position()
+		p.next()
+		cc := &ast.CaseClause{Case: casePos}
+		if p.atKeyword("Else") {
+			p.next()
+		} else {
+			cc.List = []ast.Expr{}
+			for {
+				x := p.parseExpr()
+				if p.atKeyword("To") {
+					p.next()
+					x = &ast.RangeExpr{From: x, To: p.parseExpr()}
+				}
+				cc.List = append(cc.List, x)
+				if !p.at(lexer2.Comma) {
+					break
+				}
+				p.next()
+			}
+		}
+		p.expectEOL()
+		cc.Body = p.parseBlock("Case", "EndSwitch")
+		s.Cases = append(s.Cases, cc)
+	}
+	p.closeBlock(pos, "EndSwitch")
+	return s
+}
+
+func (p *treeParser) parseWith() ast.Stmt {
+	pos := p.position()
+	p.next()
+	s := &ast.WithStmt{With: pos, X: p.parseExpr()}
+	p.expectEOL()
+	s.Body = p.parseBlock("EndWith")
+	p.closeBlock(pos, "EndWith")
+	return s
+}
+
+// expressions
+
+func (p *treeParser) parseExpr() ast.Expr {
+	x := p.parseBinary(0)
+	if p.at(lexer2.OpTernaryQuestion) {
+		p.next()
+		t := &ast.TernaryExpr{Cond: x, Then: p.parseExpr()}
+		p.expect(lexer2.OpTernaryColon, "':'")
+		t.Else = p.parseExpr()
+		return t
+	}
+	return x
+}
+
+func (p *treeParser) parseBinary(prec int) ast.Expr {
+	var x ast.Expr
+	if up := p.tok.TokType.GetUnaryPrec(); up != 0 {
+		pos := p.position()
+		op := p.tok.TokType
+		p.next()
+		x = &ast.UnaryExpr{OpPos: pos, Op: op, X: p.parseBinary(up)}
+	} else {
+		x = p.parsePostfix()
+	}
+	for {
+		op := p.tok.TokType
+		if op == lexer2.OpAssign {
+			// '=' inside an expression is a comparison
+			op = lexer2.OpEq
+		}
+		bp := ast.BinaryPrec(op)
+		if op == lexer2.OpStructRef || bp == 0 || bp <= prec {
+			return x
+		}
+		pos := p.position()
+		p.next()
+		x = &ast.BinaryExpr{X: x, OpPos: pos, Op: op, Y: p.parseBinary(bp)}
+	}
+}
+
+func (p *treeParser) parsePostfix() ast.Expr {
+	x := p.parsePrimary()
+	for {
+		switch p.tok.TokType {
+		case lexer2.LBracket:
+			p.next()
+			x = &ast.IndexExpr{X: x, Index: p.parseExpr()}
+			p.expect(lexer2.RBracket, "']'")
+		case lexer2.OpStructRef:
+			x = p.parseSelector(x)
+		case lexer2.LParen:
+			switch x.(type) {
+			case *ast.SelectorExpr, *ast.Variable, *ast.IndexExpr:
+				// method call or call through a function variable
+				x = &ast.CallExpr{Fun: x, Args: p.parseArgs()}
+			default:
+				return x
+			}
+		default:
+			return x
+		}
+	}
+}
+
+func (p *treeParser) parseSelector(x ast.Expr) ast.Expr {
+	dot := p.position()
+	p.next()
+	switch p.tok.TokType {
+	case lexer2.StructField, lexer2.UserFunction, lexer2.StdFunction, lexer2.Keyword:
+	default:
+		p.errorf("expected member name, found %q", p.tok.Value)
+	}
+	sel := &ast.SelectorExpr{Dot: dot, X: x, Sel: p.tok.Value}
+	p.next()
+	return sel
+}
+
+func (p *treeParser) parseArgs() []ast.Expr {
+	p.expect(lexer2.LParen, "'('")
+	args := []ast.Expr{}
+	for !p.at(lexer2.RParen) {
+		args = append(args, p.parseExpr())
+		if !p.at(lexer2.Comma) {
+			break
+		}
+		p.next()
+	}
+	p.expect(lexer2.RParen, "')'")
+	return args
+}
+
+func (p *treeParser) parsePrimary() ast.Expr {
+	pos := p.position()
+	tok := p.tok
+	switch tok.TokType {
+	case lexer2.Int32, lexer2.Int64, lexer2.Float64:
+		p.next()
+		return &ast.BasicLit{ValuePos: pos, Kind: tok.TokType, Value: tok.Value}
+
+	case lexer2.StrLit:
+		p.next()
+		return &ast.BasicLit{ValuePos: pos, Kind: lexer2.StrLit, Value: p.unquote(tok.Value)}
+
+	case lexer2.Macro:
+		p.next()
+		return &ast.MacroExpr{NamePos: pos, Name: strings.TrimPrefix(tok.Value, "@")}
+
+	case lexer2.Identifier:
+		return p.parseVariable()
+
+	case lexer2.UserFunction, lexer2.StdFunction:
+		p.next()
+		fn := &ast.FuncIdent{NamePos: pos, Name: tok.Value, Builtin: tok.TokType == lexer2.StdFunction}
+		if p.at(lexer2.LParen) {
+			return &ast.CallExpr{Fun: fn, Args: p.parseArgs()}
+		}
+		return fn
+
+	case lexer2.Keyword:
+		if isKeyword(tok, "True", "False", "Null", "Default") {
+			p.next()
+			return &ast.KeywordLit{NamePos: pos, Name: tok.Value}
+		}
+
+	case lexer2.LParen:
+		p.next()
+		x := &ast.ParenExpr{Lparen: pos, X: p.parseExpr()}
+		p.expect(lexer2.RParen, "')'")
+		return x
+
+	case lexer2.LBracket:
+		p.next()
+		lit := &ast.ArrayLit{Lbrack: pos, Elts: []ast.Expr{}}
+		for !p.at(lexer2.RBracket) {
+			lit.Elts = append(lit.Elts, p.parseExpr())
+			if !p.at(lexer2.Comma) {
+				break
+			}
+			p.next()
+		}
+		p.expect(lexer2.RBracket, "']'")
+		return lit
+
+	case lexer2.OpStructRef:
+		// member of the object of a With block
+		return p.parseSelector(nil)
+	}
+	p.errorf("expected expression, found %q", tok.Value)
+	return nil
+}
+
+func (p *treeParser) unquote(v string) string {
+	if p.goQuoted {
+		if s, err := strconv.Unquote(v); err == nil {
+			return s
+		}
+	}
+	if len(v) == 0 || (v[0] != '"' && v[0] != '\'') {
+		return v
+	}
+	q := v[:1]
+	v = v[1:]
+	if strings.HasSuffix(v, q) {
+		v = v[:len(v)-1]
+	}
+	return strings.ReplaceAll(v, q+q, q)
+}
@@ -0,0 +1,56 @@
+package payload
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Magic identifies a file type by the bytes at its start.
+type Magic struct {
+	Type string
+	Ext  string
+	Sig  []byte
+}
+
+// Magics are tried in order, the first match wins.
+var Magics = []Magic{
+	{"PE", "exe", []byte("MZ")},
+	{"MZ", "exe", []byte("MZ")}, // truncated or damaged PE
+	{"ZIP", "zip", []byte("PK\x03\x04")},
+	{"RAR", "rar", []byte("Rar!\x1a\x07")},
+	{"7Z", "7z", []byte("7z\xbc\xaf\x27\x1c")},
+	{"GZIP", "gz", []byte("\x1f\x8b")},
+	{"CAB", "cab", []byte("MSCF")},
+	{"ELF", "elf", []byte("\x7fELF")},
+	{"OLE", "ole", []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")},
+	{"PDF", "pdf", []byte("%PDF")},
+	{"PNG", "png", []byte("\x89PNG\r\n\x1a\n")},
+	{"JPEG", "jpg", []byte("\xff\xd8\xff")},
+	{"GIF", "gif", []byte("GIF8")},
+	{"ICO", "ico", []byte("\x00\x00\x01\x00")},
+	{"AU3", "a3x", []byte("\xa3\x48\x4b\xbe\x98\x6c\x4a\xa9")},
+	{"AU3", "a3x", []byte("\xa3\x48\x4b\xbe\x98\x6c\xa9\x4a")},
+}
+
+// Identify returns the type and the usual extension of data, "" and
+// "bin" when unknown.
+func Identify(data []byte) (typ, ext string) {
+	for _, m := range Magics {
+		if !bytes.HasPrefix(data, m.Sig) {
+			continue
+		}
+		if m.Type == "PE" && !isPE(data) {
+			continue
+		}
+		return m.Type, m.Ext
+	}
+	return "", "bin"
+}
+
+func isPE(data []byte) bool {
+	if len(data) < 0x40 {
+		return false
+	}
+	off := int(binary.LittleEndian.Uint32(data[0x3c:]))
+	return off >= 0x40 && off+4 <= len(data) && bytes.Equal(data[off:off+4], []byte("PE\x00\x00"))
+}
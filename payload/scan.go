@@ -0,0 +1,253 @@
+package payload
+
+// Extraction of binaries embedded in string literals.
+// Droppers keep executables, shellcode or archives in long hex or
+// base64 strings, often split over concatenations or "&=" statements.
+// The parts are joined per variable, decoded and identified by their
+// magic bytes.
+
+import (
+	"encoding/base64"
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/eval"
+	"github.com/x0r19x91/libautoit/lexer"
+	"sort"
+	"strings"
+)
+
+const DefaultMinSize = 64
+
+type Options struct {
+	MinSize int // smallest blob kept in decoded bytes, DefaultMinSize when 0
+}
+
+type Blob struct {
+	Pos      ast.Pos // where the blob, or its first part, is written
+	Func     string  // enclosing function, "" at the top level
+	Var      string  // variable holding it, "" when used directly
+	Encoding string  // "hex", "base64" or "string"
+	Type     string  // PE, ZIP, ..., "" when unknown
+	Ext      string
+	Data     []byte
+}
+
+// pending is a string being built in a variable
+type pending struct {
+	pos  ast.Pos
+	name string
+	sb   strings.Builder
+}
+
+type scanner struct {
+	min     int
+	fn      string
+	globals map[string]*pending
+	locals  map[string]*pending
+	blobs   []*Blob
+}
+
+// Scan finds the binaries hidden in the strings of a script.
+func Scan(script *ast.Script, opts Options) []*Blob {
+	s := &scanner{min: opts.MinSize, globals: make(map[string]*pending)}
+	if s.min <= 0 {
+		s.min = DefaultMinSize
+	}
+	ast.Inspect(script, s.visit)
+	s.flushAll(s.globals)
+	return s.blobs
+}
+
+func (s *scanner) visit(n ast.Node) bool {
+	switch n := n.(type) {
+	case *ast.FuncDecl:
+		s.fn = n.Name.Name
+		s.locals = make(map[string]*pending)
+		ast.Inspect(n.Body, s.visit)
+		s.flushAll(s.locals)
+		s.fn, s.locals = "", nil
+		return false
+
+	case *ast.AssignStmt:
+		v, ok := n.Lhs.(*ast.Variable)
+		if !ok {
+			break
+		}
+		switch n.Op {
+		case lexer.OpAssign:
+			if rest, ok := appended(v, n.Rhs); ok {
+				return !s.assign(v, rest, true)
+			}
+			return !s.assign(v, []ast.Expr{n.Rhs}, false)
+		case lexer.OpConcatAssign:
+			return !s.assign(v, []ast.Expr{n.Rhs}, true)
+		}
+
+	case *ast.VarSpec:
+		if n.Value != nil {
+			return !s.assign(n.Name, []ast.Expr{n.Value}, false)
+		}
+
+	case *ast.BasicLit, *ast.BinaryExpr, *ast.CallExpr:
+		if str, ok := constString(n.(ast.Expr)); ok {
+			s.add(n.Pos(), "", str)
+			return false
+		}
+	}
+	return true
+}
+
+// appended matches "$v = $v & x & y", returning x and y
+func appended(v *ast.Variable, x ast.Expr) ([]ast.Expr, bool) {
+	var rest []ast.Expr
+	for {
+		b, ok := x.(*ast.BinaryExpr)
+		if !ok || b.Op != lexer.OpConcat {
+			break
+		}
+		rest = append([]ast.Expr{b.Y}, rest...)
+		x = b.X
+	}
+	w, ok := x.(*ast.Variable)
+	return rest, ok && len(rest) > 0 && strings.EqualFold(w.Name, v.Name)
+}
+
+func constString(x ast.Expr) (string, bool) {
+	v, err := eval.Const(x)
+	if err != nil || v.Kind() != eval.String && v.Kind() != eval.Binary {
+		return "", false
+	}
+	return v.Str(), true
+}
+
+// bufs returns the strings being built in the scope of v
+func (s *scanner) bufs(v *ast.Variable) map[string]*pending {
+	key := strings.ToLower(v.Name)
+	if s.locals == nil {
+		return s.globals
+	}
+	if _, ok := s.locals[key]; !ok {
+		if _, ok := s.globals[key]; ok {
+			return s.globals
+		}
+	}
+	return s.locals
+}
+
+// assign records the constant parts given to v, false when they aren't
+// constant
+func (s *scanner) assign(v *ast.Variable, parts []ast.Expr, appending bool) bool {
+	m := s.bufs(v)
+	key := strings.ToLower(v.Name)
+	var sb strings.Builder
+	for _, x := range parts {
+		str, ok := constString(x)
+		if !ok {
+			// the variable isn't a plain string anymore
+			s.flush(m, key)
+			return false
+		}
+		sb.WriteString(str)
+	}
+	p, ok := m[key]
+	if !appending || !ok {
+		s.flush(m, key)
+		p = &pending{pos: v.Pos(), name: v.Name}
+		m[key] = p
+	}
+	p.sb.WriteString(sb.String())
+	return true
+}
+
+func (s *scanner) flush(m map[string]*pending, key string) {
+	if p, ok := m[key]; ok {
+		delete(m, key)
+		s.add(p.pos, p.name, p.sb.String())
+	}
+}
+
+func (s *scanner) flushAll(m map[string]*pending) {
+	// in source order
+	var list []*pending
+	for _, p := range m {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].pos.Token < list[j].pos.Token
+	})
+	for _, p := range list {
+		s.add(p.pos, p.name, p.sb.String())
+	}
+	for k := range m {
+		delete(m, k)
+	}
+}
+
+func (s *scanner) add(pos ast.Pos, name, str string) {
+	data, enc := Decode(str, s.min)
+	if data == nil {
+		return
+	}
+	typ, ext := Identify(data)
+	s.blobs = append(s.blobs, &Blob{
+		Pos:      pos,
+		Func:     s.fn,
+		Var:      name,
+		Encoding: enc,
+		Type:     typ,
+		Ext:      ext,
+		Data:     data,
+	})
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return len(s)%2 == 0
+}
+
+func isBase64(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '+' || c == '/' || c == '=') {
+			return false
+		}
+	}
+	return true
+}
+
+// Decode turns a string holding at least min bytes of hex or base64
+// into the bytes, nil if it holds neither. Strings of raw bytes, as
+// returned by BinaryToString, are kept only when their type is known.
+func Decode(s string, min int) (data []byte, encoding string) {
+	if len(s) >= 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') && isHex(s[2:]) {
+		if len(s)-2 >= 2*min {
+			return eval.StringValue(s).Bytes(), "hex"
+		}
+		return nil, ""
+	}
+	if len(s) >= 2*min && isHex(s) {
+		return eval.StringValue("0x" + s).Bytes(), "hex"
+	}
+	s64 := strings.NewReplacer("\r", "", "\n", "").Replace(s)
+	if len(s64) >= 4*min/3 && isBase64(s64) {
+		enc := base64.StdEncoding
+		if !strings.HasSuffix(s64, "=") && len(s64)%4 != 0 {
+			enc = base64.RawStdEncoding
+		}
+		if b, err := enc.DecodeString(s64); err == nil && len(b) >= min {
+			return b, "base64"
+		}
+		return nil, ""
+	}
+	if len(s) >= min {
+		b := eval.StringValue(s).Bytes()
+		if typ, _ := Identify(b); typ != "" {
+			return b, "string"
+		}
+	}
+	return nil, ""
+}
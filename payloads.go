@@ -0,0 +1,84 @@
+package libautoit
+
+import (
+	"context"
+	"fmt"
+	"github.com/x0r19x91/libautoit/payload"
+	"strings"
+)
+
+// PayloadError is a script ExtractPayloads couldn't scan.
+type PayloadError struct {
+	Resource *AutoItResource
+	Err      error
+}
+
+func (e *PayloadError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Resource.Name(), e.Err)
+}
+
+// PayloadErrors lists the scripts that failed, the others were scanned.
+type PayloadErrors []*PayloadError
+
+func (l PayloadErrors) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// ExtractPayloads scans the scripts for binaries hidden in string
+// literals and adds them to Derived, each one pointing back to the
+// script and the variable or function it was found in. The resources
+// are left as they are, those not yet decompressed are decompressed into
+// a copy. A script that fails to decompress or parse is skipped and
+// reported in the PayloadErrors returned.
+func (f *AutoItFile) ExtractPayloads(opts payload.Options) error {
+	f.Derived = nil
+	var errs PayloadErrors
+	for _, orig := range f.Resources {
+		r := orig
+		if r.State == Au3Initialized {
+			c := *orig
+			if err := c.DecompressContext(context.Background(), 0); err != nil {
+				errs = append(errs, &PayloadError{orig, err})
+				continue
+			}
+			r = &c
+		}
+		if !r.IsAutoItScript(500) {
+			continue
+		}
+		script, err := r.Parse()
+		if script == nil {
+			errs = append(errs, &PayloadError{orig, err})
+			continue
+		}
+		for _, b := range payload.Scan(script, opts) {
+			where := b.Func
+			if b.Var != "" {
+				where = "$" + b.Var
+				if b.Func != "" {
+					where += " in " + b.Func
+				}
+			}
+			f.Derived = append(f.Derived, &AutoItResource{
+				Tag:              fmt.Sprintf("payload_%d.%s", len(f.Derived)+1, b.Ext),
+				Path:             fmt.Sprintf("%s:%d %s", r.Name(), b.Pos.Line, where),
+				CompressedSize:   uint32(len(b.Data)),
+				DecompressedSize: uint32(len(b.Data)),
+				CreationTime:     r.CreationTime,
+				ModifiedTime:     r.ModifiedTime,
+				Data:             b.Data,
+				State:            Au3Decompressed,
+				Parent:           orig,
+				Origin:           b,
+			})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package progress
+
+// Progress of the decoding pipeline.
+// The entry points, GetScriptsContext, DecompressContext and TidyContext,
+// each end with a Done event, a pipeline of several calls under Own with
+// the one its owner sends.
+// A Func travels in the context given to the Context variants of the
+// pipeline and is called synchronously, in order, by the goroutine doing
+// the work, so it needs no locking of its own unless the same context is
+// shared by several goroutines.
+
+import "context"
+
+type Stage int
+
+const (
+	Locate     Stage = iota // searching the keys for the script headers
+	Decrypt                 // unpacking the resources
+	Decompress              // decompressing a resource
+	Tokenize                // reading the tokens of a script
+	Tidy                    // tidying a script
+	Done                    // an entry point or an owned pipeline finished
+)
+
+var stageNames = []string{"locate", "decrypt", "decompress", "tokenize", "tidy", "done"}
+
+func (s Stage) String() string {
+	if s >= 0 && int(s) < len(stageNames) {
+		return stageNames[s]
+	}
+	return "unknown"
+}
+
+// Event reports Done of Total units of a stage, bytes or lines. The last
+// event of a stage has Done == Total.
+type Event struct {
+	Stage Stage
+	Name  string // resource the event is about, "" for the whole file
+	Done  int
+	Total int
+}
+
+type Func func(Event)
+
+type key struct{}
+
+// WithFunc returns a context reporting to fn, nil to report nothing.
+func WithFunc(ctx context.Context, fn Func) context.Context {
+	return context.WithValue(ctx, key{}, fn)
+}
+
+// FromContext returns the Func of ctx, nil when there is none.
+func FromContext(ctx context.Context) Func {
+	fn, _ := ctx.Value(key{}).(Func)
+	return fn
+}
+
+type ownedKey struct{}
+
+// Own returns a context for a pipeline made of several calls. The entry
+// points given it leave the Done event to the owner, who sends a single
+// one with Finish.
+func Own(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ownedKey{}, true)
+}
+
+// End sends the Done event closing a call to an entry point of the
+// pipeline, unless ctx belongs to an owned pipeline.
+func End(ctx context.Context, name string) {
+	if owned, _ := ctx.Value(ownedKey{}).(bool); !owned {
+		Finish(ctx, name)
+	}
+}
+
+// Finish sends the Done event of a pipeline.
+func Finish(ctx context.Context, name string) {
+	Report(ctx, Event{Stage: Done, Name: name})
+}
+
+// Report calls the Func of ctx, if any.
+func Report(ctx context.Context, ev Event) {
+	if fn := FromContext(ctx); fn != nil {
+		fn(ev)
+	}
+}
@@ -0,0 +1,181 @@
+package rename
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Hint names the variables around a builtin: the one receiving its
+// result and the ones passed as arguments, "" when there's nothing to
+// learn.
+type Hint struct {
+	Result string
+	Args   []string
+}
+
+// Hints is keyed by the lower case name of the builtin.
+var Hints = map[string]Hint{
+	"fileopen":           {"hFile", []string{"sFile"}},
+	"fileread":           {"sData", []string{"hFile"}},
+	"filereadline":       {"sLine", []string{"hFile"}},
+	"filewrite":          {"", []string{"hFile", "sData"}},
+	"filewriteline":      {"", []string{"hFile", "sLine"}},
+	"fileclose":          {"", []string{"hFile"}},
+	"filedelete":         {"", []string{"sFile"}},
+	"fileexists":         {"bExists", []string{"sPath"}},
+	"filegetsize":        {"iSize", []string{"sFile"}},
+	"filecopy":           {"", []string{"sSource", "sDest"}},
+	"filemove":           {"", []string{"sSource", "sDest"}},
+	"fileinstall":        {"", []string{"sSource", "sDest"}},
+	"filesetattrib":      {"", []string{"sFile", "sAttrib"}},
+	"filefindfirstfile":  {"hSearch", []string{"sPattern"}},
+	"filefindnextfile":   {"sFile", []string{"hSearch"}},
+	"filegetshortname":   {"sShortName", []string{"sFile"}},
+	"filecreateshortcut": {"", []string{"sFile", "sLink"}},
+	"dircreate":          {"", []string{"sDir"}},
+	"dirremove":          {"", []string{"sDir"}},
+	"inetget":            {"hDownload", []string{"sUrl", "sFile"}},
+	"inetread":           {"bData", []string{"sUrl"}},
+	"inetgetsize":        {"iSize", []string{"sUrl"}},
+	"inetgetinfo":        {"", []string{"hDownload"}},
+	"inetclose":          {"", []string{"hDownload"}},
+	"tcpconnect":         {"iSocket", []string{"sIP", "iPort"}},
+	"tcplisten":          {"iListen", []string{"sIP", "iPort"}},
+	"tcpaccept":          {"iSocket", []string{"iListen"}},
+	"tcpsend":            {"", []string{"iSocket", "sData"}},
+	"tcprecv":            {"sRecv", []string{"iSocket"}},
+	"tcpclosesocket":     {"", []string{"iSocket"}},
+	"tcpnametoip":        {"sIP", []string{"sHost"}},
+	"udpopen":            {"aSocket", []string{"sIP", "iPort"}},
+	"udpsend":            {"", []string{"aSocket", "sData"}},
+	"udprecv":            {"sRecv", []string{"aSocket"}},
+	"regread":            {"sValue", []string{"sKey", "sValueName"}},
+	"regwrite":           {"", []string{"sKey", "sValueName", "sType", "vData"}},
+	"regdelete":          {"", []string{"sKey", "sValueName"}},
+	"regenumkey":         {"sSubKey", []string{"sKey", "iIndex"}},
+	"regenumval":         {"sValueName", []string{"sKey", "iIndex"}},
+	"run":                {"iPID", []string{"sCmd", "sWorkDir"}},
+	"runwait":            {"iExitCode", []string{"sCmd", "sWorkDir"}},
+	"shellexecute":       {"", []string{"sFile", "sParams", "sWorkDir"}},
+	"shellexecutewait":   {"iExitCode", []string{"sFile", "sParams", "sWorkDir"}},
+	"processexists":      {"iPID", []string{"sProcess"}},
+	"processclose":       {"", []string{"sProcess"}},
+	"processlist":        {"aProcesses", []string{"sProcess"}},
+	"stdoutread":         {"sOutput", []string{"iPID"}},
+	"dllopen":            {"hDll", []string{"sDll"}},
+	"dllclose":           {"", []string{"hDll"}},
+	"dllcall":            {"aRet", []string{"hDll", "sRetType", "sFunc"}},
+	"dllcalladdress":     {"aRet", []string{"sRetType", "pFunc"}},
+	"dllstructcreate":    {"tStruct", []string{"sTag", "pData"}},
+	"dllstructgetptr":    {"pStruct", []string{"tStruct"}},
+	"dllstructgetsize":   {"iSize", []string{"tStruct"}},
+	"dllstructgetdata":   {"vData", []string{"tStruct"}},
+	"dllstructsetdata":   {"", []string{"tStruct"}},
+	"objcreate":          {"oObj", []string{"sClass"}},
+	"objget":             {"oObj", []string{"sPath"}},
+	"stringsplit":        {"aParts", []string{"sString", "sDelim"}},
+	"stringregexp":       {"aMatches", []string{"sString", "sPattern"}},
+	"stringreplace":      {"sString", []string{"sString"}},
+	"stringlen":          {"iLen", []string{"sString"}},
+	"stringinstr":        {"iPos", []string{"sString", "sSubString"}},
+	"stringmid":          {"sSub", []string{"sString", "iStart", "iCount"}},
+	"stringleft":         {"sSub", []string{"sString", "iCount"}},
+	"stringright":        {"sSub", []string{"sString", "iCount"}},
+	"stringreverse":      {"sString", []string{"sString"}},
+	"stringtobinary":     {"bData", []string{"sString"}},
+	"binarytostring":     {"sString", []string{"bData"}},
+	"binarylen":          {"iLen", []string{"bData"}},
+	"binarymid":          {"bData", []string{"bData", "iStart", "iCount"}},
+	"ubound":             {"iCount", []string{"aArray"}},
+	"chr":                {"sChar", []string{"iCode"}},
+	"chrw":               {"sChar", []string{"iCode"}},
+	"asc":                {"iCode", []string{"sChar"}},
+	"ascw":               {"iCode", []string{"sChar"}},
+	"random":             {"iRand", nil},
+	"timerinit":          {"hTimer", nil},
+	"timerdiff":          {"iElapsed", []string{"hTimer"}},
+	"guicreate":          {"hGUI", []string{"sTitle"}},
+	"wingethandle":       {"hWnd", []string{"sTitle"}},
+	"wingettitle":        {"sTitle", []string{"hWnd"}},
+	"winexists":          {"bExists", []string{"sTitle"}},
+	"envget":             {"sEnv", []string{"sEnvVar"}},
+	"iniread":            {"sValue", []string{"sIniFile", "sSection", "sKey"}},
+	"iniwrite":           {"", []string{"sIniFile", "sSection", "sKey", "sValue"}},
+	"clipget":            {"sClip", nil},
+}
+
+// Category groups the builtins that give a function its name.
+type Category struct {
+	Name  string
+	Funcs []string // lower case, a trailing '*' matches a prefix
+}
+
+// Categories are tried in order, a function is named after the one
+// most of its calls belong to, _Func_Download for instance.
+var Categories = []Category{
+	{"Download", []string{"inet*", "httpsetproxy", "ftpsetproxy"}},
+	{"Network", []string{"tcp*", "udp*"}},
+	{"Registry", []string{"reg*"}},
+	{"Process", []string{"run", "runwait", "runas", "runaswait", "shellexecute*", "process*", "stdoutread", "stderrread", "stdinwrite"}},
+	{"File", []string{"file*", "dir*", "ini*"}},
+	{"Native", []string{"dll*"}},
+	{"COM", []string{"obj*"}},
+	{"Decrypt", []string{"bitxor", "bitand", "bitor", "bitnot", "bitshift", "bitrotate", "chr", "chrw", "asc", "ascw", "binarytostring", "stringtobinary", "binarymid"}},
+	{"String", []string{"string*"}},
+	{"GUI", []string{"guictrl*", "gui*"}},
+	{"Window", []string{"win*", "control*"}},
+}
+
+func (c *Category) has(name string) bool {
+	for _, f := range c.Funcs {
+		if strings.HasSuffix(f, "*") && strings.HasPrefix(name, f[:len(f)-1]) || f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Obfuscated guesses whether a name was generated by an obfuscator:
+// long names made mostly of digits, with a long word without vowels
+// or with random case. Names with underscores are left alone, people
+// write those.
+func Obfuscated(name string) bool {
+	name = strings.TrimLeft(name, "_$")
+	if len(name) < 6 || strings.Contains(name, "_") {
+		return false
+	}
+	var digits, flips, letters, vowels int
+	prev := rune(0)
+	for _, r := range name {
+		switch {
+		case unicode.IsDigit(r):
+			digits++
+		case unicode.IsLetter(r):
+			if unicode.IsLower(prev) && unicode.IsUpper(r) {
+				// a new word of a camel case name
+				if letters >= 5 && vowels == 0 {
+					return true
+				}
+				letters, vowels = 0, 0
+			}
+			if unicode.IsLetter(prev) && unicode.IsUpper(prev) != unicode.IsUpper(r) {
+				flips++
+			}
+			letters++
+			if strings.ContainsRune("aeiouyAEIOUY", r) {
+				vowels++
+			}
+		}
+		prev = r
+	}
+	switch {
+	case digits >= 3 && digits*4 >= len(name):
+		return true
+	case letters >= 5 && vowels == 0 && (flips > 0 || letters > 8):
+		// short upper case names are abbreviations, HSRCSV
+		return true
+	case flips*2 >= len(name) && len(name) >= 8:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,412 @@
+package rename
+
+// Renaming of obfuscated identifiers.
+// Variables are named after the builtins they are given to or get
+// their value from ($hFile for the result of FileOpen, $sUrl for the
+// first argument of InetGet), functions after the kind of builtins they
+// mostly call (_Func_Download), and copies of known UDFs get their
+// original names back. Renaming follows the scopes of the symbols
+// package, so a local never ends up hiding a global.
+
+import (
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/lexer"
+	"github.com/x0r19x91/libautoit/symbols"
+	"github.com/x0r19x91/libautoit/udf"
+	"strconv"
+	"strings"
+)
+
+type Options struct {
+	// Map renames identifiers whatever they look like, "$name" for the
+	// variables and "name" for the functions. It applies to every scope.
+	Map map[string]string
+	// DB gives copies of known UDFs their names back.
+	DB *udf.DB
+	// All renames every identifier instead of the ones Obfuscated
+	// reports.
+	All bool
+}
+
+const (
+	ByMap   = "map"
+	ByUDF   = "udf"
+	ByUsage = "usage"
+	Generic = "generic"
+)
+
+type Rename struct {
+	Kind   symbols.SymbolKind
+	Func   string // function of a local, "" for globals and functions
+	Old    string
+	New    string
+	Reason string // ByMap, ByUDF, ByUsage or Generic
+}
+
+type renamer struct {
+	info    *symbols.Info
+	opts    Options
+	strs    map[string]bool // words found in string literals
+	votes   map[*symbols.Symbol]map[string]int
+	order   map[*symbols.Symbol][]string // candidates in order found
+	newName map[*symbols.Symbol]string
+	reason  map[*symbols.Symbol]string
+
+	funcNames map[string]bool
+	globals   map[string]bool // old and new names of the globals
+	locals    map[*symbols.Scope]map[string]bool
+	anyLocal  map[string]bool // names used by a local somewhere
+}
+
+// Apply renames the identifiers of a script in place.
+// Names that appear in a string literal are left alone unless listed in
+// opts.Map, Execute, Eval and Call could refer to them.
+func Apply(script *ast.Script, opts Options) []*Rename {
+	r := &renamer{
+		info:      symbols.Resolve(script),
+		opts:      opts,
+		strs:      make(map[string]bool),
+		votes:     make(map[*symbols.Symbol]map[string]int),
+		order:     make(map[*symbols.Symbol][]string),
+		newName:   make(map[*symbols.Symbol]string),
+		reason:    make(map[*symbols.Symbol]string),
+		funcNames: make(map[string]bool),
+		globals:   make(map[string]bool),
+		locals:    make(map[*symbols.Scope]map[string]bool),
+		anyLocal:  make(map[string]bool),
+	}
+	r.reserve()
+	r.collect(script)
+
+	var ans []*Rename
+	funcs := r.info.Funcs()
+	scopes := []*symbols.Scope{r.info.Global}
+	for _, fn := range funcs {
+		if sc := r.info.Scopes[fn.Decl.(*ast.FuncDecl)]; sc != nil {
+			scopes = append(scopes, sc)
+		}
+	}
+
+	r.byMap(funcs, scopes)
+	if opts.DB != nil {
+		r.byUDF(funcs)
+	}
+	for _, fn := range funcs {
+		if r.candidate(fn) {
+			r.setName(fn, r.unique(funcName(fn.Decl.(*ast.FuncDecl)), r.funcNames), ByUsage)
+		}
+	}
+	for _, sc := range scopes {
+		for _, sym := range sc.Symbols() {
+			if r.candidate(sym) {
+				r.varName(sym)
+			}
+		}
+	}
+
+	for _, sym := range funcs {
+		ans = r.apply(ans, sym)
+	}
+	for _, sc := range scopes {
+		for _, sym := range sc.Symbols() {
+			ans = r.apply(ans, sym)
+		}
+	}
+	return ans
+}
+
+// reserve records the names in use, builtins included
+func (r *renamer) reserve() {
+	for _, f := range lexer.Au3StdFunctions {
+		r.funcNames[strings.ToLower(f)] = true
+	}
+	for _, fn := range r.info.Funcs() {
+		r.funcNames[strings.ToLower(fn.Name)] = true
+	}
+	for _, sym := range r.info.Global.Symbols() {
+		r.globals[strings.ToLower(sym.Name)] = true
+	}
+	for _, sc := range r.info.Scopes {
+		names := make(map[string]bool)
+		for _, sym := range sc.Symbols() {
+			names[strings.ToLower(sym.Name)] = true
+			r.anyLocal[strings.ToLower(sym.Name)] = true
+		}
+		r.locals[sc] = names
+	}
+}
+
+func isWordChar(r rune) bool {
+	return r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+func (r *renamer) vote(sym *symbols.Symbol, name string, weight int) {
+	if sym == nil || name == "" || sym.Kind == symbols.Func {
+		return
+	}
+	m := r.votes[sym]
+	if m == nil {
+		m = make(map[string]int)
+		r.votes[sym] = m
+	}
+	if _, ok := m[name]; !ok {
+		r.order[sym] = append(r.order[sym], name)
+	}
+	m[name] += weight
+}
+
+// literalName names a variable holding a literal
+func literalName(x ast.Expr) string {
+	switch x := x.(type) {
+	case *ast.BasicLit:
+		switch x.Kind {
+		case lexer.StrLit:
+			return "sText"
+		case lexer.Float64:
+			return "fValue"
+		}
+		return "iValue"
+	case *ast.KeywordLit:
+		switch strings.ToLower(x.Name) {
+		case "true", "false":
+			return "bFlag"
+		}
+	case *ast.ArrayLit:
+		return "aArray"
+	case *ast.MacroExpr:
+		return "s" + x.Name
+	}
+	return ""
+}
+
+// valueOf votes for the name of a variable from the value it gets
+func (r *renamer) valueOf(v *ast.Variable, x ast.Expr) {
+	sym := r.info.SymbolOf(v)
+	if call, ok := x.(*ast.CallExpr); ok && call.IsBuiltin() {
+		r.vote(sym, Hints[strings.ToLower(call.CalleeName())].Result, 3)
+		return
+	}
+	r.vote(sym, literalName(x), 1)
+}
+
+// collect gathers the words of the string literals and the usage of
+// the variables
+func (r *renamer) collect(script *ast.Script) {
+	ast.Inspect(script, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BasicLit:
+			if n.Kind == lexer.StrLit {
+				for _, w := range strings.FieldsFunc(n.Value, func(c rune) bool { return !isWordChar(c) }) {
+					r.strs[strings.ToLower(w)] = true
+				}
+			}
+		case *ast.CallExpr:
+			if !n.IsBuiltin() {
+				break
+			}
+			hint := Hints[strings.ToLower(n.CalleeName())]
+			for i, a := range n.Args {
+				if v, ok := a.(*ast.Variable); ok && i < len(hint.Args) {
+					r.vote(r.info.SymbolOf(v), hint.Args[i], 2)
+				}
+			}
+		case *ast.AssignStmt:
+			if v, ok := n.Lhs.(*ast.Variable); ok && n.Op == lexer.OpAssign {
+				r.valueOf(v, n.Rhs)
+			}
+		case *ast.VarSpec:
+			if n.Value != nil {
+				r.valueOf(n.Name, n.Value)
+			} else if len(n.Dims) > 0 {
+				r.vote(r.info.SymbolOf(n.Name), "aArray", 1)
+			}
+		case *ast.ForStmt:
+			r.vote(r.info.SymbolOf(n.Var), "i", 3)
+		case *ast.ForInStmt:
+			r.vote(r.info.SymbolOf(n.Var), "vItem", 3)
+		}
+		return true
+	})
+}
+
+// candidate reports whether sym is still to be renamed
+func (r *renamer) candidate(sym *symbols.Symbol) bool {
+	if _, done := r.newName[sym]; done {
+		return false
+	}
+	if r.strs[strings.ToLower(sym.Name)] {
+		return false
+	}
+	return r.opts.All || Obfuscated(sym.Name)
+}
+
+func (r *renamer) setName(sym *symbols.Symbol, name, reason string) {
+	r.newName[sym] = name
+	r.reason[sym] = reason
+	key := strings.ToLower(name)
+	switch {
+	case sym.Kind == symbols.Func:
+		r.funcNames[key] = true
+	case sym.IsGlobal():
+		r.globals[key] = true
+	default:
+		r.locals[sym.Scope][key] = true
+		r.anyLocal[key] = true
+	}
+}
+
+// unique appends a number to base until it's free in every set
+func (r *renamer) unique(base string, taken ...map[string]bool) string {
+	free := func(s string) bool {
+		for _, m := range taken {
+			if m[strings.ToLower(s)] {
+				return false
+			}
+		}
+		return true
+	}
+	if free(base) {
+		return base
+	}
+	for i := 2; ; i++ {
+		if s := base + strconv.Itoa(i); free(s) {
+			return s
+		}
+	}
+}
+
+func (r *renamer) byMap(funcs []*symbols.Symbol, scopes []*symbols.Scope) {
+	if len(r.opts.Map) == 0 {
+		return
+	}
+	m := make(map[string]string, len(r.opts.Map))
+	for k, v := range r.opts.Map {
+		m[strings.ToLower(k)] = strings.TrimPrefix(v, "$")
+	}
+	for _, fn := range funcs {
+		if to, ok := m[strings.ToLower(fn.Name)]; ok {
+			r.setName(fn, to, ByMap)
+		}
+	}
+	for _, sc := range scopes {
+		for _, sym := range sc.Symbols() {
+			if to, ok := m["$"+strings.ToLower(sym.Name)]; ok {
+				r.setName(sym, to, ByMap)
+			}
+		}
+	}
+}
+
+// byUDF gives copies of UDFs, and their variables, the original names
+func (r *renamer) byUDF(funcs []*symbols.Symbol) {
+	for _, fn := range funcs {
+		if !r.candidate(fn) {
+			continue
+		}
+		decl := fn.Decl.(*ast.FuncDecl)
+		e, vars, ok := r.opts.DB.MatchShape(decl)
+		if !ok || e.Name == "" || r.funcNames[strings.ToLower(e.Name)] {
+			continue
+		}
+		r.setName(fn, e.Name, ByUDF)
+		sc := r.info.Scopes[decl]
+		if sc == nil {
+			continue
+		}
+		for i, v := range udf.FuncShape(decl).Vars {
+			sym := sc.LookupLocal(v)
+			if sym == nil || i >= len(vars) || !r.candidate(sym) {
+				continue
+			}
+			name := strings.TrimPrefix(vars[i], "$")
+			if !r.globals[strings.ToLower(name)] && !r.locals[sc][strings.ToLower(name)] {
+				r.setName(sym, name, ByUDF)
+			}
+		}
+	}
+}
+
+// funcName names a function after the category of most of its calls
+func funcName(fn *ast.FuncDecl) string {
+	counts := make([]int, len(Categories))
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok && call.IsBuiltin() {
+			name := strings.ToLower(call.CalleeName())
+			for i := range Categories {
+				if Categories[i].has(name) {
+					counts[i]++
+					break
+				}
+			}
+		}
+		return true
+	})
+	best := -1
+	for i, c := range counts {
+		if c > 0 && (best < 0 || c > counts[best]) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return "_Func"
+	}
+	return "_Func_" + Categories[best].Name
+}
+
+func (r *renamer) varName(sym *symbols.Symbol) {
+	name, reason := "", ByUsage
+	best := 0
+	for _, cand := range r.order[sym] {
+		if w := r.votes[sym][cand]; w > best {
+			name, best = cand, w
+		}
+	}
+	if name == "" {
+		reason = Generic
+		name = "vVar"
+		if sym.Kind == symbols.Param {
+			name = "vParam"
+		}
+	}
+	if sym.IsGlobal() {
+		// a local of the same name would hide it
+		name = r.unique(name, r.globals, r.anyLocal)
+	} else {
+		name = r.unique(name, r.globals, r.locals[sym.Scope])
+	}
+	r.setName(sym, name, reason)
+}
+
+func (r *renamer) apply(ans []*Rename, sym *symbols.Symbol) []*Rename {
+	name, ok := r.newName[sym]
+	if !ok || name == sym.Name {
+		return ans
+	}
+	for _, ref := range sym.Refs {
+		switch n := ref.(type) {
+		case *ast.Variable:
+			n.Name = name
+		case *ast.FuncIdent:
+			n.Name = name
+		}
+	}
+	rn := &Rename{Kind: sym.Kind, Old: sym.Name, New: name, Reason: r.reason[sym]}
+	if sym.Kind != symbols.Func && !sym.IsGlobal() {
+		rn.Func = sym.Scope.Func.Name.Name
+	}
+	sym.Name = name
+	return append(ans, rn)
+}
+
+// Names returns the renames as a map usable as Options.Map.
+func Names(renames []*Rename) map[string]string {
+	m := make(map[string]string)
+	for _, rn := range renames {
+		if rn.Kind == symbols.Func {
+			m[rn.Old] = rn.New
+		} else if rn.Func == "" {
+			m["$"+rn.Old] = "$" + rn.New
+		}
+	}
+	return m
+}
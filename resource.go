@@ -2,6 +2,7 @@ package libautoit
 
 import (
 	"fmt"
+	"github.com/x0r19x91/libautoit/payload"
 	"strings"
 	"time"
 )
@@ -47,6 +48,9 @@ type AutoItResource struct {
 	State            AutoItState
 	Decompressor     IDecompressor
 	KeySet           IKeySet
+	Archive          *Archive        // the resource is in, nil when derived
+	Parent           *AutoItResource // script a derived resource was found in
+	Origin           *payload.Blob   // where in the script
 }
 
 func (res *AutoItResource) Name() string {
@@ -0,0 +1,108 @@
+package rules
+
+// Default holds behaviours common in AutoIt malware.
+var Default = []*Rule{
+	{
+		Name:        "startup-folder-persistence",
+		Description: "copies a file to the startup folder",
+		Tags:        []string{"persistence"},
+		All: []*Pattern{
+			{Call: "FileCopy|FileMove|FileInstall|FileCreateShortcut", AnyArg: `@Startup(Common)?Dir|\\Start Menu\\Programs\\Startup`},
+		},
+	},
+	{
+		Name:        "run-key-persistence",
+		Description: "writes a Run or RunOnce registry value",
+		Tags:        []string{"persistence"},
+		Any: []*Pattern{
+			{Call: "RegWrite", Args: []string{`\\CurrentVersion\\Run(Once)?\b`}},
+		},
+	},
+	{
+		Name:        "scheduled-task",
+		Description: "creates a scheduled task",
+		Tags:        []string{"persistence"},
+		Any: []*Pattern{
+			{Call: "Run|RunWait|ShellExecute|ShellExecuteWait", AnyArg: `schtasks.*/create`},
+		},
+	},
+	{
+		Name:        "download-execute",
+		Description: "downloads a file then runs something",
+		Tags:        []string{"download"},
+		Sequence: []*Pattern{
+			{Call: "InetGet|_?URLDownloadToFile|_INetGetSource"},
+			{Call: "Run|RunWait|ShellExecute|ShellExecuteWait"},
+		},
+	},
+	{
+		Name:        "self-delete",
+		Description: "deletes its own executable",
+		Tags:        []string{"evasion"},
+		Any: []*Pattern{
+			{Call: "Run|RunWait|ShellExecute|ShellExecuteWait", AnyArg: `\b(del|erase)\b.*@(ScriptFullPath|AutoItExe)`},
+			{Call: "FileDelete", Args: []string{`^@(ScriptFullPath|AutoItExe)$`}},
+		},
+	},
+	{
+		Name:        "hide-file",
+		Description: "sets the hidden or system attribute",
+		Tags:        []string{"evasion"},
+		Any: []*Pattern{
+			{Call: "FileSetAttrib", Args: []string{"", `\+[RASHNOT]*[SH]`}},
+		},
+	},
+	{
+		Name:        "disable-security-tools",
+		Description: "disables the task manager, registry editor or UAC",
+		Tags:        []string{"evasion"},
+		Any: []*Pattern{
+			{Call: "RegWrite", AnyArg: `^(DisableTaskMgr|DisableRegistryTools|DisableCMD|EnableLUA|DisableAntiSpyware)$`},
+		},
+	},
+	{
+		Name:        "uac-bypass",
+		Description: "hijacks a shell open command of an auto elevated binary",
+		Tags:        []string{"privilege-escalation"},
+		Any: []*Pattern{
+			{Call: "RegWrite", Args: []string{`\\(ms-settings|mscfile|exefile)\\shell\\open\\command`}},
+		},
+	},
+	{
+		Name:        "anti-analysis",
+		Description: "looks for virtual machines, sandboxes or analysis tools",
+		Tags:        []string{"anti-analysis"},
+		Scope:       ScopeScript,
+		Any: []*Pattern{
+			{Call: "ProcessExists|ProcessClose|WinExists", AnyArg: `vmtoolsd|vmwaretray|vboxservice|vboxtray|sandboxie|wireshark|procmon|procexp|ollydbg|x32dbg|x64dbg|ida(64)?\.exe`},
+			{String: `SbieDll\.dll|VBoxMiniRdrDN|VBoxGuest|vmci\.sys`},
+		},
+	},
+	{
+		Name:        "keylogger",
+		Description: "polls keys and writes them to a file",
+		Tags:        []string{"collection"},
+		All: []*Pattern{
+			{Call: "_IsPressed"},
+			{Call: "FileWrite|FileWriteLine"},
+		},
+	},
+	{
+		Name:        "http-request",
+		Description: "sends an HTTP request through COM",
+		Tags:        []string{"network"},
+		All: []*Pattern{
+			{Call: "ObjCreate", Args: []string{`WinHttp\.WinHttpRequest|XMLHTTP`}},
+			{Method: "Send"},
+		},
+	},
+	{
+		Name:        "hidden-tray",
+		Description: "hides the tray icon",
+		Tags:        []string{"evasion"},
+		Scope:       ScopeScript,
+		Any: []*Pattern{
+			{Call: "Opt|AutoItSetOption", Args: []string{"^TrayIconHide$", "^1$"}},
+		},
+	},
+}
@@ -0,0 +1,264 @@
+package rules
+
+import (
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/eval"
+	"github.com/x0r19x91/libautoit/lexer"
+	"sort"
+)
+
+const (
+	evCall = iota
+	evMethod
+	evMacro
+	evString
+)
+
+// event is a call, macro or string of the script
+type event struct {
+	kind int
+	pos  ast.Pos
+	fn   string
+	name string
+	args []string
+	text string
+}
+
+type Evidence struct {
+	Pos  ast.Pos
+	Func string // enclosing function, "" at the top level
+	Text string // source of the call or macro, value of the string
+}
+
+type Match struct {
+	Rule     *Rule
+	Func     string // function matched, "" for the top level and script rules
+	Evidence []Evidence
+}
+
+type Engine struct {
+	rules []*rule
+}
+
+// NewEngine compiles rules, failing on the first invalid one.
+func NewEngine(rules []*Rule) (*Engine, error) {
+	e := &Engine{}
+	for _, r := range rules {
+		cr, err := compileRule(r)
+		if err != nil {
+			return nil, err
+		}
+		e.rules = append(e.rules, cr)
+	}
+	return e, nil
+}
+
+// Match evaluates the rules over a script. Matches are in rule order,
+// function scoped rules report each function they match in.
+func (e *Engine) Match(script *ast.Script) []*Match {
+	units := collect(script)
+	var all []*event
+	for _, u := range units {
+		all = append(all, u...)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].pos.Token < all[j].pos.Token
+	})
+	var ans []*Match
+	for _, r := range e.rules {
+		if r.Scope == ScopeScript {
+			if m := r.match(all); m != nil {
+				ans = append(ans, m)
+			}
+			continue
+		}
+		for _, u := range units {
+			if m := r.match(u); m != nil {
+				if len(u) > 0 {
+					m.Func = u[0].fn
+				}
+				ans = append(ans, m)
+			}
+		}
+	}
+	return ans
+}
+
+func (r *rule) match(evs []*event) *Match {
+	m := &Match{Rule: r.Rule}
+	seen := make(map[*event]bool)
+	add := func(ev *event) {
+		if !seen[ev] {
+			seen[ev] = true
+			m.Evidence = append(m.Evidence, Evidence{Pos: ev.pos, Func: ev.fn, Text: ev.text})
+		}
+	}
+	for _, p := range r.not {
+		for _, ev := range evs {
+			if p.match(ev) {
+				return nil
+			}
+		}
+	}
+	for _, p := range r.all {
+		found := false
+		for _, ev := range evs {
+			if p.match(ev) {
+				found = true
+				add(ev)
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	if len(r.any) > 0 {
+		found := false
+		for _, ev := range evs {
+			for _, p := range r.any {
+				if p.match(ev) {
+					found = true
+					add(ev)
+					break
+				}
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	if len(r.seq) > 0 {
+		i := 0
+		for _, ev := range evs {
+			if i < len(r.seq) && r.seq[i].match(ev) {
+				add(ev)
+				i++
+			}
+		}
+		if i < len(r.seq) {
+			return nil
+		}
+	}
+	sort.SliceStable(m.Evidence, func(i, j int) bool {
+		return m.Evidence[i].Pos.Token < m.Evidence[j].Pos.Token
+	})
+	return m
+}
+
+func (p *pattern) match(ev *event) bool {
+	if p.kind != ev.kind {
+		return false
+	}
+	if p.kind == evString {
+		return p.anyArg.MatchString(ev.text)
+	}
+	if !p.name.MatchString(ev.name) {
+		return false
+	}
+	for i, re := range p.args {
+		if re != nil && (i >= len(ev.args) || !re.MatchString(ev.args[i])) {
+			return false
+		}
+	}
+	if p.anyArg != nil {
+		for _, a := range ev.args {
+			if p.anyArg.MatchString(a) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+type collector struct {
+	fn  string
+	evs []*event
+}
+
+// collect returns the events of the top level code followed by those
+// of each function, in source order
+func collect(script *ast.Script) [][]*event {
+	top := &collector{}
+	var ans [][]*event
+	for _, st := range script.Stmts {
+		if fn, ok := st.(*ast.FuncDecl); ok {
+			c := &collector{fn: fn.Name.Name}
+			ast.Inspect(fn.Body, c.visit)
+			ans = append(ans, c.evs)
+			continue
+		}
+		ast.Inspect(st, top.visit)
+	}
+	return append([][]*event{top.evs}, ans...)
+}
+
+// argText is the constant value of x or its source. The constant parts
+// of a concatenation are folded and joined to the source of the others,
+// @ComSpec & " /c " & Chr(100) & "el" becomes "@ComSpec /c del".
+func argText(x ast.Expr) string {
+	if v, err := eval.Const(x); err == nil {
+		return v.Str()
+	}
+	if b, ok := x.(*ast.BinaryExpr); ok && b.Op == lexer.OpConcat {
+		return argText(b.X) + argText(b.Y)
+	}
+	return ast.ExprString(x)
+}
+
+func (c *collector) add(kind int, pos ast.Pos, name, text string, args []string) {
+	c.evs = append(c.evs, &event{kind: kind, pos: pos, fn: c.fn, name: name, args: args, text: text})
+}
+
+func (c *collector) visit(n ast.Node) bool {
+	switch n := n.(type) {
+	case *ast.CallExpr:
+		c.call(n)
+		if n.IsBuiltin() {
+			return c.folded(n)
+		}
+	case *ast.MacroExpr:
+		c.add(evMacro, n.Pos(), n.Name, "@"+n.Name, nil)
+	case *ast.BasicLit:
+		if n.Kind == lexer.StrLit {
+			c.add(evString, n.Pos(), "", n.Value, nil)
+		}
+	case *ast.BinaryExpr, *ast.ParenExpr:
+		return c.folded(n.(ast.Expr))
+	}
+	return true
+}
+
+func (c *collector) call(n *ast.CallExpr) {
+	var args []string
+	for _, a := range n.Args {
+		args = append(args, argText(a))
+	}
+	if name := n.CalleeName(); name != "" {
+		c.add(evCall, n.Pos(), name, ast.ExprString(n), args)
+	} else if sel, ok := n.Fun.(*ast.SelectorExpr); ok {
+		c.add(evMethod, sel.Dot, sel.Sel, ast.ExprString(n), args)
+	}
+}
+
+// folded records a constant string expression as a whole. Calls and
+// macros inside it are still recorded, its parts aren't.
+func (c *collector) folded(x ast.Expr) bool {
+	v, err := eval.Const(x)
+	if err != nil || v.Kind() != eval.String {
+		return true
+	}
+	c.add(evString, x.Pos(), "", v.Str(), nil)
+	ast.Inspect(x, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if n != x {
+				c.call(n)
+			}
+		case *ast.MacroExpr:
+			c.add(evMacro, n.Pos(), n.Name, "@"+n.Name, nil)
+		}
+		return true
+	})
+	return false
+}
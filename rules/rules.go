@@ -0,0 +1,153 @@
+package rules
+
+// A small rule language for behaviours of decompiled scripts.
+// Rules are Go values or JSON documents. Each rule lists patterns over
+// the calls, method calls, macros and strings of a function, or of the
+// whole script, and matches when they are all present, when any of them
+// is, or when they appear in a given order.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const (
+	ScopeFunction = "function" // patterns must match within one function or the top level code
+	ScopeScript   = "script"   // patterns may match anywhere
+)
+
+type Rule struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Scope       string   `json:"scope,omitempty"` // ScopeFunction when empty
+
+	All      []*Pattern `json:"all,omitempty"`      // every pattern matches
+	Any      []*Pattern `json:"any,omitempty"`      // some pattern matches
+	Sequence []*Pattern `json:"sequence,omitempty"` // the patterns match in source order
+	Not      []*Pattern `json:"not,omitempty"`      // no pattern matches
+}
+
+// Pattern matches one call, method call, macro or string. Names are
+// regular expressions matched case insensitively against the whole
+// name, Args and AnyArg against part of the argument. An argument is
+// its constant value when it has one and its source text otherwise, with
+// the constant parts of concatenations folded, so `@StartupDir\\a` matches
+// FileCopy($s, @StartupDir & "\a.exe").
+type Pattern struct {
+	Call   string   `json:"call,omitempty"`    // builtin or user function
+	Method string   `json:"method,omitempty"`  // COM method, $o.Name(...)
+	Args   []string `json:"args,omitempty"`    // by position, "" matches anything
+	AnyArg string   `json:"any_arg,omitempty"` // some argument
+	Macro  string   `json:"macro,omitempty"`   // macro name with or without '@'
+	String string   `json:"string,omitempty"`  // string literal or constant expression
+}
+
+// Load reads a JSON array of rules.
+func Load(r io.Reader) ([]*Rule, error) {
+	var rules []*Rule
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+type pattern struct {
+	kind   int
+	name   *regexp.Regexp
+	args   []*regexp.Regexp // nil matches anything
+	anyArg *regexp.Regexp
+}
+
+type rule struct {
+	*Rule
+	all, any, seq, not []*pattern
+}
+
+func compileName(s string) (*regexp.Regexp, error) {
+	return regexp.Compile("(?i)^(?:" + s + ")$")
+}
+
+func compileArg(s string) (*regexp.Regexp, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return regexp.Compile("(?i)" + s)
+}
+
+func compilePattern(p *Pattern) (*pattern, error) {
+	var ans pattern
+	var name string
+	n := 0
+	if p.Call != "" {
+		ans.kind, name = evCall, p.Call
+		n++
+	}
+	if p.Method != "" {
+		ans.kind, name = evMethod, p.Method
+		n++
+	}
+	if p.Macro != "" {
+		ans.kind, name = evMacro, strings.TrimPrefix(p.Macro, "@")
+		n++
+	}
+	if p.String != "" {
+		ans.kind = evString
+		n++
+	}
+	if n != 1 {
+		return nil, errors.New("pattern needs exactly one of call, method, macro or string")
+	}
+	if (len(p.Args) > 0 || p.AnyArg != "") && ans.kind != evCall && ans.kind != evMethod {
+		return nil, errors.New("args given without call or method")
+	}
+	var err error
+	if ans.kind == evString {
+		ans.anyArg, err = compileArg(p.String)
+		return &ans, err
+	}
+	if ans.name, err = compileName(name); err != nil {
+		return nil, err
+	}
+	for _, a := range p.Args {
+		re, err := compileArg(a)
+		if err != nil {
+			return nil, err
+		}
+		ans.args = append(ans.args, re)
+	}
+	ans.anyArg, err = compileArg(p.AnyArg)
+	return &ans, err
+}
+
+func compileRule(r *Rule) (*rule, error) {
+	if r.Name == "" {
+		return nil, errors.New("rule without a name")
+	}
+	if r.Scope != "" && r.Scope != ScopeFunction && r.Scope != ScopeScript {
+		return nil, fmt.Errorf("rule %s: unknown scope %q", r.Name, r.Scope)
+	}
+	if len(r.All)+len(r.Any)+len(r.Sequence) == 0 {
+		return nil, fmt.Errorf("rule %s: nothing to match", r.Name)
+	}
+	ans := &rule{Rule: r}
+	for _, x := range []struct {
+		src []*Pattern
+		dst *[]*pattern
+	}{{r.All, &ans.all}, {r.Any, &ans.any}, {r.Sequence, &ans.seq}, {r.Not, &ans.not}} {
+		for _, p := range x.src {
+			cp, err := compilePattern(p)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %v", r.Name, err)
+			}
+			*x.dst = append(*x.dst, cp)
+		}
+	}
+	return ans, nil
+}
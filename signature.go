@@ -0,0 +1,114 @@
+package libautoit
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/x0r19x91/libautoit/progress"
+)
+
+// SignatureHit is a script header found by FindSignatures.
+type SignatureHit struct {
+	Offset int  // of the first byte of the header
+	Key    byte // the header is XORed with it
+	Header int  // index in Au3Headers
+}
+
+// The XOR of neighbouring bytes is the same under every key, so the
+// headers under the 256 keys are found in a single pass as one run of
+// differences, searched with bytes.Index, the key being the first byte
+// XORed with the first of the header. The headers share their first
+// bytes, the run of those is searched and the whole header checked.
+var sigPrefix = func() []byte {
+	n := 0
+	for n < len(Au3Headers[0]) && Au3Headers[0][n] == Au3Headers[1][n] {
+		n++
+	}
+	return diffs(nil, Au3Headers[0][:n])
+}()
+
+// diffs returns the XOR of each byte of p with the next, in dst when it
+// is large enough
+func diffs(dst, p []byte) []byte {
+	if len(p) < 2 {
+		return dst[:0]
+	}
+	n := len(p) - 1
+	if cap(dst) < n {
+		dst = make([]byte, n)
+	}
+	dst = dst[:n]
+	i := 0
+	// eight at a time
+	for ; i+9 <= len(p); i += 8 {
+		binary.LittleEndian.PutUint64(dst[i:], binary.LittleEndian.Uint64(p[i:])^binary.LittleEndian.Uint64(p[i+1:]))
+	}
+	for ; i < n; i++ {
+		dst[i] = p[i] ^ p[i+1]
+	}
+	return dst
+}
+
+// header returns the index in Au3Headers of the header XORed with key
+// at the start of p, -1 for none
+func header(p []byte, key byte) int {
+	for id, hdr := range Au3Headers {
+		if len(p) < len(hdr) {
+			continue
+		}
+		ok := true
+		for i, c := range hdr {
+			if p[i]^key != c {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return id
+		}
+	}
+	return -1
+}
+
+// FindSignatures finds the script headers under every XOR key in a
+// single pass, in the order of their offsets. data is not modified.
+func FindSignatures(data []byte) []SignatureHit {
+	hits, _ := findSignatures(context.Background(), data)
+	return hits
+}
+
+const sigChunk = 1 << 20
+
+func findSignatures(ctx context.Context, data []byte) ([]SignatureHit, error) {
+	var hits []SignatureHit
+	var diff []byte
+	for start := 0; start < len(data); start += sigChunk {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		progress.Report(ctx, progress.Event{Stage: progress.Locate, Done: start, Total: len(data)})
+		end := start + sigChunk
+		if end > len(data) {
+			end = len(data)
+		}
+		// the differences of the headers starting in the chunk
+		last := end + len(sigPrefix)
+		if last > len(data) {
+			last = len(data)
+		}
+		diff = diffs(diff, data[start:last])
+		for i := 0; ; i++ {
+			n := bytes.Index(diff[i:], sigPrefix)
+			if n < 0 || start+i+n >= end {
+				break
+			}
+			i += n
+			p := start + i
+			if id := header(data[p:], data[p]^Au3Headers[0][0]); id >= 0 {
+				hits = append(hits, SignatureHit{Offset: p, Key: data[p] ^ Au3Headers[0][0], Header: id})
+			}
+		}
+	}
+	progress.Report(ctx, progress.Event{Stage: progress.Locate, Done: len(data), Total: len(data)})
+	return hits, nil
+}
@@ -0,0 +1,44 @@
+package libautoit
+
+import (
+	"github.com/x0r19x91/libautoit/lexer"
+	"github.com/x0r19x91/libautoit/similarity"
+)
+
+// Fingerprint returns the similarity fingerprint of the scripts in the
+// file.
+func (f *AutoItFile) Fingerprint() (*similarity.Fingerprint, error) {
+	var lexers []lexer.ITokenizer
+	for _, r := range f.Resources {
+		if r.State == Au3Initialized && !r.Decompress() {
+			continue
+		}
+		// text read as the tree parser does, tabs and all
+		if r.IsAutoItScript(500) || IsPrintable(r.Data) && validTokens(r.sourceTokenizer(), 500) {
+			lexers = append(lexers, r.sourceTokenizer())
+		}
+	}
+	if len(lexers) == 0 {
+		return nil, ErrScriptNotFound
+	}
+	return similarity.FromTokens(lexers...), nil
+}
+
+// Cluster groups files whose scripts have a similarity of at least
+// threshold, see similarity.Cluster. Files without a script are left
+// alone.
+func Cluster(files []*AutoItFile, threshold float64) [][]*AutoItFile {
+	fps := make([]*similarity.Fingerprint, len(files))
+	for i, f := range files {
+		fps[i], _ = f.Fingerprint()
+	}
+	var ans [][]*AutoItFile
+	for _, group := range similarity.Cluster(fps, threshold) {
+		var list []*AutoItFile
+		for _, i := range group {
+			list = append(list, files[i])
+		}
+		ans = append(ans, list)
+	}
+	return ans
+}
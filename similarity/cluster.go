@@ -0,0 +1,45 @@
+package similarity
+
+// Cluster groups fingerprints whose similarity reaches threshold,
+// transitively. It returns the indexes of each group, groups ordered
+// by their first member. A nil fingerprint is a group of its own.
+func Cluster(fps []*Fingerprint, threshold float64) [][]int {
+	parent := make([]int, len(fps))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range fps {
+		for j := i + 1; j < len(fps); j++ {
+			if fps[i] == nil || fps[j] == nil || find(i) == find(j) {
+				continue
+			}
+			if fps[i].Similarity(fps[j]) >= threshold {
+				a, b := find(i), find(j)
+				if a > b {
+					a, b = b, a
+				}
+				parent[b] = a
+			}
+		}
+	}
+	var ans [][]int
+	group := make(map[int]int)
+	for i := range fps {
+		r := find(i)
+		g, ok := group[r]
+		if !ok {
+			g = len(ans)
+			group[r] = g
+			ans = append(ans, nil)
+		}
+		ans[g] = append(ans[g], i)
+	}
+	return ans
+}
@@ -0,0 +1,230 @@
+package similarity
+
+// Fuzzy fingerprints of scripts that survive renaming and reformatting.
+// Tokens are reduced to their type, keeping only the names of keywords,
+// builtins and macros, so variables, user functions and literals can
+// change freely. The n-grams of the reduced stream are summarised in a
+// MinHash signature and every function gets an exact hash of its
+// reduced tokens.
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"github.com/x0r19x91/libautoit/lexer"
+	"hash/fnv"
+	"strings"
+)
+
+const (
+	NGram         = 4
+	SignatureSize = 128
+)
+
+const digestPrefix = "mh1:"
+
+var ErrBadDigest = errors.New("bad similarity digest")
+
+type FuncHash struct {
+	Name   string
+	Hash   uint64
+	Tokens int
+}
+
+type Fingerprint struct {
+	Tokens    int // reduced tokens
+	Signature []uint64
+	Funcs     []FuncHash
+}
+
+// seeds of the SignatureSize hash functions
+var seeds [SignatureSize]uint64
+
+func init() {
+	x := uint64(0x9e3779b97f4a7c15)
+	for i := range seeds {
+		x = mix(x)
+		seeds[i] = x
+	}
+}
+
+// mix is the splitmix64 finalizer
+func mix(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// Normalize reduces a token to what survives renaming, "" for tokens
+// that are dropped.
+func Normalize(tok *lexer.Token) string {
+	switch tok.TokType {
+	case lexer.Keyword, lexer.StdFunction, lexer.Macro, lexer.LegacyKeyword, lexer.LegacyStdFunction:
+		return strings.ToLower(tok.Value)
+	case lexer.Identifier:
+		return "$"
+	case lexer.UserFunction:
+		return "F"
+	case lexer.StructField:
+		return ".f"
+	case lexer.StrLit:
+		return "S"
+	case lexer.Int32, lexer.Int64, lexer.Float64:
+		return "N"
+	case lexer.EOL, lexer.Directive, lexer.EOF, lexer.InvalidToken:
+		return ""
+	}
+	return tok.TokType.String()
+}
+
+type builder struct {
+	fp      *Fingerprint
+	window  []uint64
+	fn      *FuncHash
+	fnHash  uint64
+	expectF bool // the previous token was Func
+}
+
+// FromTokens fingerprints the scripts read from the tokenizers.
+func FromTokens(lexers ...lexer.ITokenizer) *Fingerprint {
+	b := &builder{fp: &Fingerprint{Signature: make([]uint64, SignatureSize)}}
+	for i := range b.fp.Signature {
+		b.fp.Signature[i] = ^uint64(0)
+	}
+	for _, lex := range lexers {
+		b.window = b.window[:0]
+		for {
+			tok := lex.NextToken()
+			if tok == nil || tok.TokType == lexer.EOF || tok.TokType == lexer.InvalidToken {
+				break
+			}
+			b.token(tok)
+		}
+		if len(b.window) > 0 && len(b.window) < NGram {
+			b.shingle(b.window)
+		}
+	}
+	return b.fp
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+func (b *builder) token(tok *lexer.Token) {
+	if b.expectF {
+		b.expectF = false
+		if tok.TokType == lexer.UserFunction || tok.TokType == lexer.StdFunction {
+			b.fn.Name = tok.Value
+		}
+	}
+	if tok.TokType == lexer.Keyword && strings.EqualFold(tok.Value, "Func") {
+		b.fn = &FuncHash{}
+		b.fnHash = 14695981039346656037
+		b.expectF = true
+	}
+	s := Normalize(tok)
+	if s == "" {
+		return
+	}
+	h := hashString(s)
+	b.fp.Tokens++
+	if b.fn != nil {
+		b.fnHash = (b.fnHash ^ h) * 1099511628211
+		b.fn.Tokens++
+		if tok.TokType == lexer.Keyword && strings.EqualFold(tok.Value, "EndFunc") {
+			b.fn.Hash = b.fnHash
+			b.fp.Funcs = append(b.fp.Funcs, *b.fn)
+			b.fn = nil
+		}
+	}
+	b.window = append(b.window, h)
+	if len(b.window) > NGram {
+		b.window = b.window[1:]
+	}
+	if len(b.window) == NGram {
+		b.shingle(b.window)
+	}
+}
+
+func (b *builder) shingle(w []uint64) {
+	var x uint64
+	for _, h := range w {
+		x = mix(x ^ h)
+	}
+	for i, seed := range seeds {
+		if v := mix(x ^ seed); v < b.fp.Signature[i] {
+			b.fp.Signature[i] = v
+		}
+	}
+}
+
+// Similarity estimates the Jaccard similarity of the n-grams of two
+// scripts, between 0 and 1.
+func (f *Fingerprint) Similarity(g *Fingerprint) float64 {
+	if len(f.Signature) != len(g.Signature) || f.Tokens == 0 || g.Tokens == 0 {
+		return 0
+	}
+	same := 0
+	for i := range f.Signature {
+		if f.Signature[i] == g.Signature[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(f.Signature))
+}
+
+// FuncSimilarity is the share of distinct function hashes two scripts
+// have in common, functions shorter than minTokens being left out.
+func (f *Fingerprint) FuncSimilarity(g *Fingerprint, minTokens int) float64 {
+	set := func(fp *Fingerprint) map[uint64]bool {
+		m := make(map[uint64]bool)
+		for _, fn := range fp.Funcs {
+			if fn.Tokens >= minTokens {
+				m[fn.Hash] = true
+			}
+		}
+		return m
+	}
+	a, b := set(f), set(g)
+	common := 0
+	for h := range a {
+		if b[h] {
+			common++
+		}
+	}
+	if union := len(a) + len(b) - common; union > 0 {
+		return float64(common) / float64(union)
+	}
+	return 0
+}
+
+// Digest encodes the token count and the signature as a string, the
+// function hashes aren't kept.
+func (f *Fingerprint) Digest() string {
+	buf := make([]byte, 4+8*len(f.Signature))
+	binary.LittleEndian.PutUint32(buf, uint32(f.Tokens))
+	for i, v := range f.Signature {
+		binary.LittleEndian.PutUint64(buf[4+8*i:], v)
+	}
+	return digestPrefix + base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// ParseDigest decodes a string returned by Digest.
+func ParseDigest(s string) (*Fingerprint, error) {
+	if !strings.HasPrefix(s, digestPrefix) {
+		return nil, ErrBadDigest
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(s[len(digestPrefix):])
+	if err != nil || len(buf) != 4+8*SignatureSize {
+		return nil, ErrBadDigest
+	}
+	f := &Fingerprint{Tokens: int(binary.LittleEndian.Uint32(buf))}
+	for i := 0; i < SignatureSize; i++ {
+		f.Signature = append(f.Signature, binary.LittleEndian.Uint64(buf[4+8*i:]))
+	}
+	return f, nil
+}
@@ -0,0 +1,314 @@
+package libautoit
+
+// Streaming decompression.
+// The readers decode the same formats as the decompressors but keep only
+// the window that back-references can reach, so a large resource can be
+// hashed or written out without holding all of it in memory.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	eaWindow     = 1 << 15 // EA05 and EA06 offsets are 15 bits
+	legacyWindow = 1 << 14 // legacy offsets are 13 bits, plus 3
+)
+
+// limit keeps the decoders, which read ahead, within the n bytes of the
+// compressed data, n <= 0 being no limit
+func limit(r io.Reader, n int) io.Reader {
+	if n <= 0 {
+		return r
+	}
+	return io.LimitReader(r, int64(n))
+}
+
+func byteReader(r io.Reader) io.ByteReader {
+	if br, ok := r.(io.ByteReader); ok {
+		return br
+	}
+	return bufio.NewReader(r)
+}
+
+// lzReader decodes the EA05, EA06 and old legacy formats
+type lzReader struct {
+	in          io.ByteReader
+	bits        *bitReader
+	ver         AutoItVersion
+	size, out   int // bytes to produce and produced
+	window      []byte
+	match, dist int // copy in progress
+	started     bool
+	err         error
+}
+
+func newLzReader(in io.Reader, ver AutoItVersion, size int) *lzReader {
+	window := eaWindow
+	if ver == Legacy {
+		window = legacyWindow
+	}
+	return &lzReader{
+		in:     byteReader(in),
+		ver:    ver,
+		size:   size,
+		window: make([]byte, window),
+	}
+}
+
+// NewEa06Reader returns a reader of the compressed bytes of EA06 data read
+// from in, size being the decompressed size given by the resource. No
+// more than compressed bytes are read from in, <= 0 to read up to its end.
+func NewEa06Reader(in io.Reader, compressed, size int) io.Reader {
+	return newLzReader(limit(in, compressed), EA06, size)
+}
+
+// NewEa05Reader is NewEa06Reader for EA05 data.
+func NewEa05Reader(in io.Reader, compressed, size int) io.Reader {
+	return newLzReader(limit(in, compressed), EA05, size)
+}
+
+func (z *lzReader) header() error {
+	if z.ver == Legacy {
+		z.bits = newStreamBitReader(z.in)
+		z.bits.bits(32)
+		z.bits.bits(32) // the size, unused
+		if z.bits.overrun() {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+	var hdr [8]byte
+	for i := range hdr {
+		c, err := z.in.ReadByte()
+		if err != nil {
+			return ErrInvalidSignature
+		}
+		hdr[i] = c
+	}
+	sig := "EA06"
+	if z.ver == EA05 {
+		sig = "EA05"
+	}
+	if string(hdr[:4]) != sig {
+		return ErrInvalidSignature
+	}
+	if size := int(binary.BigEndian.Uint32(hdr[4:])); size > z.size {
+		z.size = size
+	}
+	z.bits = newStreamBitReader(z.in)
+	return nil
+}
+
+// symbol decodes the next literal, or starts a copy
+func (z *lzReader) symbol() (byte, bool) {
+	b := z.bits
+	flag := b.bits(1)
+	if z.ver == Legacy {
+		if flag == 0 {
+			return byte(b.bits(8)), true
+		}
+		z.dist = 3 + int(b.bits(13))
+		z.match = 3 + int(b.bits(4))
+		if z.out+z.match >= z.size || z.dist > z.out {
+			z.err = ErrDecompressFailed
+		}
+		return 0, false
+	}
+	if flag == 1 && z.ver == EA06 || flag == 0 && z.ver == EA05 {
+		return byte(b.bits(8)), true
+	}
+	z.dist = int(b.bits(15))
+	z.match = b.length()
+	if z.dist > z.out || z.match > z.size-z.out {
+		z.err = ErrDecompressFailed
+	}
+	return 0, false
+}
+
+func (z *lzReader) Read(p []byte) (int, error) {
+	if !z.started {
+		z.started = true
+		z.err = z.header()
+	}
+	mask := len(z.window) - 1
+	n := 0
+	for n < len(p) && z.err == nil {
+		if z.out >= z.size {
+			z.err = io.EOF
+			break
+		}
+		if z.match > 0 {
+			// the copy in progress, as far as p goes
+			k := z.match
+			if k > len(p)-n {
+				k = len(p) - n
+			}
+			for i := 0; i < k; i++ {
+				var c byte
+				if z.dist > 0 {
+					c = z.window[(z.out-z.dist)&mask]
+				}
+				z.window[z.out&mask] = c
+				p[n] = c
+				n++
+				z.out++
+			}
+			z.match -= k
+			continue
+		}
+		c, ok := z.symbol()
+		if z.bits.overrun() {
+			z.err = io.ErrUnexpectedEOF
+		}
+		if !ok || z.err != nil {
+			continue
+		}
+		z.window[z.out&mask] = c
+		p[n] = c
+		n++
+		z.out++
+	}
+	return n, z.err
+}
+
+// jb01Reader streams the window of the JB01 decompressor
+type jb01Reader struct {
+	d       *jb01Decomp
+	started bool
+	err     error
+}
+
+// NewJB01Reader is NewEa06Reader for JB01 data.
+func NewJB01Reader(in io.Reader, compressed, size int) io.Reader {
+	d := NewJB01Decompressor(nil, size)
+	d.in = byteReader(limit(in, compressed))
+	return &jb01Reader{d: d}
+}
+
+func (j *jb01Reader) Read(p []byte) (int, error) {
+	d := j.d
+	if !j.started {
+		j.started = true
+		var hdr [8]byte
+		for i := range hdr {
+			c, err := d.in.ReadByte()
+			if err != nil {
+				j.err = ErrInvalidSignature
+				break
+			}
+			hdr[i] = c
+		}
+		if sig := string(hdr[:4]); sig != "JB01" && sig != "JB00" {
+			j.err = ErrInvalidSignature
+		}
+		if size := int(binary.BigEndian.Uint32(hdr[4:])); size > d.decompressedSize {
+			d.decompressedSize = size
+		}
+	}
+	n := 0
+	for n < len(p) && j.err == nil {
+		if d.nDataWritePos < d.nDataPos && d.nDataWritePos < d.decompressedSize {
+			p[n] = d.bData[d.nDataWritePos&Jb01DataMask]
+			n++
+			d.nDataWritePos++
+			continue
+		}
+		if d.nDataWritePos >= d.decompressedSize {
+			j.err = io.EOF
+			break
+		}
+		d.symbol()
+		d.nDataUsed = 0
+		j.err = d.err
+	}
+	return n, j.err
+}
+
+// legacyReader picks the format the way the legacy decompressor does
+type legacyReader struct {
+	in               io.ReadSeeker
+	compressed, size int
+	r    io.Reader
+	err  error
+}
+
+// NewLegacyReader returns a reader of legacy data: the input as is when
+// it is text, the old format when it decodes and JB01 otherwise. Telling
+// takes a pass over the input before the first byte is returned. See
+// NewEa06Reader for compressed.
+func NewLegacyReader(in io.ReadSeeker, compressed, size int) io.Reader {
+	return &legacyReader{in: in, compressed: compressed, size: size}
+}
+
+func (l *legacyReader) choose() error {
+	start, err := l.in.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	printable := true
+	br := bufio.NewReader(limit(l.in, l.compressed))
+	for {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if strings.IndexByte(PRINTABLE, c) == -1 {
+			printable = false
+			break
+		}
+	}
+	if _, err := l.in.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	if printable {
+		l.r = limit(l.in, l.compressed)
+		return nil
+	}
+	_, err = io.Copy(ioutil.Discard, newLzReader(limit(l.in, l.compressed), Legacy, l.size))
+	if _, err := l.in.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	if err == nil {
+		l.r = newLzReader(limit(l.in, l.compressed), Legacy, l.size)
+	} else {
+		l.r = NewJB01Reader(l.in, l.compressed, l.size)
+	}
+	return nil
+}
+
+func (l *legacyReader) Read(p []byte) (int, error) {
+	if l.r == nil && l.err == nil {
+		l.err = l.choose()
+	}
+	if l.err != nil {
+		return 0, l.err
+	}
+	return l.r.Read(p)
+}
+
+// Open returns a reader of the decompressed data that holds only the
+// window of the decompressor. Unlike Decompress it doesn't convert
+// UTF-16 text.
+func (r *AutoItResource) Open() (io.Reader, error) {
+	if !r.IsCompressed || r.State != Au3Initialized {
+		return bytes.NewReader(r.Data), nil
+	}
+	in, size := bytes.NewReader(r.Data), int(r.DecompressedSize)
+	switch r.Decompressor.(type) {
+	case *ea06Decomp:
+		return NewEa06Reader(in, len(r.Data), size), nil
+	case *ea05Decompress:
+		return NewEa05Reader(in, len(r.Data), size), nil
+	case *legacyDecompress:
+		return NewLegacyReader(in, len(r.Data), size), nil
+	}
+	return nil, ErrDecompressFailed
+}
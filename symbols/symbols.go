@@ -0,0 +1,598 @@
+package symbols
+
+// Scope and symbol resolution.
+// AutoIt has two levels of scope: the global one, shared by the top
+// level code and every Global declaration, and one per function.
+// Resolve binds each variable and function reference to its symbol so
+// a use can be followed back to its declaration.
+
+import (
+	"fmt"
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/lexer"
+	"sort"
+	"strings"
+)
+
+type SymbolKind int
+
+const (
+	Var SymbolKind = iota
+	Const
+	Param
+	Func
+)
+
+var symbolKinds = map[SymbolKind]string{
+	Var:   "var",
+	Const: "const",
+	Param: "param",
+	Func:  "func",
+}
+
+func (k SymbolKind) String() string {
+	return symbolKinds[k]
+}
+
+type Symbol struct {
+	Name     string // name as first declared, without '$'
+	Kind     SymbolKind
+	Scope    *Scope
+	Static   bool
+	Implicit bool     // created by an assignment or use without declaration
+	Decl     ast.Node // *ast.VarSpec, *ast.Param, *ast.FuncDecl, the loop or the assignment
+	DeclPos  ast.Pos
+	Refs     []ast.Node // every *ast.Variable or *ast.FuncIdent bound to the symbol
+}
+
+func (s *Symbol) IsGlobal() bool {
+	return s.Scope != nil && s.Scope.Parent == nil
+}
+
+func (s *Symbol) String() string {
+	if s.Kind == Func {
+		return fmt.Sprintf("func %s", s.Name)
+	}
+	where := "global"
+	if !s.IsGlobal() {
+		where = "local to " + s.Scope.Func.Name.Name
+	}
+	return fmt.Sprintf("%s $%s (%s)", s.Kind, s.Name, where)
+}
+
+type Scope struct {
+	Parent  *Scope
+	Func    *ast.FuncDecl // nil for the global scope
+	symbols map[string]*Symbol
+	order   []*Symbol
+}
+
+func newScope(parent *Scope, fn *ast.FuncDecl) *Scope {
+	return &Scope{Parent: parent, Func: fn, symbols: make(map[string]*Symbol)}
+}
+
+// LookupLocal finds a symbol declared in this scope.
+func (s *Scope) LookupLocal(name string) *Symbol {
+	return s.symbols[strings.ToLower(strings.TrimPrefix(name, "$"))]
+}
+
+// Lookup finds a symbol in this scope or the global one.
+func (s *Scope) Lookup(name string) *Symbol {
+	for sc := s; sc != nil; sc = sc.Parent {
+		if sym := sc.LookupLocal(name); sym != nil {
+			return sym
+		}
+	}
+	return nil
+}
+
+// Symbols returns the symbols of the scope in declaration order.
+func (s *Scope) Symbols() []*Symbol {
+	return s.order
+}
+
+func (s *Scope) insert(sym *Symbol) {
+	sym.Scope = s
+	s.symbols[strings.ToLower(sym.Name)] = sym
+	s.order = append(s.order, sym)
+}
+
+type DiagKind int
+
+const (
+	Undeclared    DiagKind = iota // variable read but never declared or assigned
+	Implicit                      // variable assigned without a declaration
+	Shadowed                      // local or parameter hides a global
+	DuplicateFunc                 // function declared more than once
+	UndefinedFunc                 // call to a user function that doesn't exist
+)
+
+var diagKinds = map[DiagKind]string{
+	Undeclared:    "undeclared",
+	Implicit:      "implicit",
+	Shadowed:      "shadowed",
+	DuplicateFunc: "duplicate-func",
+	UndefinedFunc: "undefined-func",
+}
+
+func (k DiagKind) String() string {
+	return diagKinds[k]
+}
+
+type Diagnostic struct {
+	Kind DiagKind
+	Pos  ast.Pos
+	Name string
+	Msg  string
+}
+
+func (d *Diagnostic) String() string {
+	return fmt.Sprintf("line %d: %s", d.Pos.Line, d.Msg)
+}
+
+type Info struct {
+	Global      *Scope
+	Scopes      map[*ast.FuncDecl]*Scope
+	Refs        map[ast.Node]*Symbol // *ast.Variable and *ast.FuncIdent
+	Calls       map[*ast.CallExpr]*Symbol
+	Diagnostics []*Diagnostic
+
+	funcs map[string]*Symbol
+}
+
+// SymbolOf returns the symbol a *ast.Variable or *ast.FuncIdent is bound to.
+func (info *Info) SymbolOf(n ast.Node) *Symbol {
+	return info.Refs[n]
+}
+
+// DeclOf returns the declaration of the symbol n refers to.
+func (info *Info) DeclOf(n ast.Node) ast.Node {
+	if sym := info.Refs[n]; sym != nil {
+		return sym.Decl
+	}
+	return nil
+}
+
+// Func finds a user defined function by name.
+func (info *Info) Func(name string) *Symbol {
+	return info.funcs[strings.ToLower(name)]
+}
+
+// Funcs returns the user defined functions in declaration order.
+func (info *Info) Funcs() []*Symbol {
+	var ans []*Symbol
+	for _, sym := range info.funcs {
+		ans = append(ans, sym)
+	}
+	sort.Slice(ans, func(i, j int) bool {
+		return ans[i].DeclPos.Token < ans[j].DeclPos.Token
+	})
+	return ans
+}
+
+type resolver struct {
+	info  *Info
+	scope *Scope
+}
+
+// Resolve builds the symbol table of a script.
+func Resolve(script *ast.Script) *Info {
+	info := &Info{
+		Global: newScope(nil, nil),
+		Scopes: make(map[*ast.FuncDecl]*Scope),
+		Refs:   make(map[ast.Node]*Symbol),
+		Calls:  make(map[*ast.CallExpr]*Symbol),
+		funcs:  make(map[string]*Symbol),
+	}
+	r := &resolver{info: info, scope: info.Global}
+	r.collect(script)
+
+	// top level code first, so globals created by assignments
+	// are known to every function
+	var funcs []*ast.FuncDecl
+	for _, s := range script.Stmts {
+		if fn, ok := s.(*ast.FuncDecl); ok {
+			funcs = append(funcs, fn)
+			continue
+		}
+		r.stmt(s)
+	}
+	for _, fn := range funcs {
+		r.funcDecl(fn)
+	}
+
+	sort.SliceStable(info.Diagnostics, func(i, j int) bool {
+		return info.Diagnostics[i].Pos.Token < info.Diagnostics[j].Pos.Token
+	})
+	return info
+}
+
+func (r *resolver) report(kind DiagKind, pos ast.Pos, name, format string, args ...interface{}) {
+	r.info.Diagnostics = append(r.info.Diagnostics, &Diagnostic{
+		Kind: kind,
+		Pos:  pos,
+		Name: name,
+		Msg:  fmt.Sprintf(format, args...),
+	})
+}
+
+// collect registers the functions and the globals declared anywhere
+func (r *resolver) collect(script *ast.Script) {
+	for _, s := range script.Stmts {
+		fn, ok := s.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		key := strings.ToLower(fn.Name.Name)
+		if prev, ok := r.info.funcs[key]; ok {
+			r.report(DuplicateFunc, fn.Pos(), fn.Name.Name,
+				"function %s already declared at line %d", fn.Name.Name, prev.DeclPos.Line)
+			continue
+		}
+		r.info.funcs[key] = &Symbol{
+			Name:    fn.Name.Name,
+			Kind:    Func,
+			Scope:   r.info.Global,
+			Decl:    fn,
+			DeclPos: fn.Pos(),
+		}
+	}
+
+	ast.Inspect(script, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			// only Global declarations inside functions
+			ast.Inspect(n.Body, func(n ast.Node) bool {
+				if d, ok := n.(*ast.DeclStmt); ok && strings.EqualFold(d.Scope, "Global") {
+					r.declareGlobals(d)
+				}
+				return true
+			})
+			return false
+		case *ast.DeclStmt:
+			r.declareGlobals(n)
+			return false
+		case *ast.EnumStmt:
+			for _, spec := range n.Specs {
+				r.newGlobal(spec.Name, Const, spec, false)
+			}
+			return false
+		}
+		return true
+	})
+}
+
+func (r *resolver) declareGlobals(d *ast.DeclStmt) {
+	kind := Var
+	if d.Const {
+		kind = Const
+	}
+	for _, spec := range d.Specs {
+		r.newGlobal(spec.Name, kind, spec, d.Static)
+	}
+}
+
+func (r *resolver) newGlobal(v *ast.Variable, kind SymbolKind, decl ast.Node, static bool) {
+	if r.info.Global.LookupLocal(v.Name) != nil {
+		return
+	}
+	r.info.Global.insert(&Symbol{
+		Name:    v.Name,
+		Kind:    kind,
+		Static:  static,
+		Decl:    decl,
+		DeclPos: v.Pos(),
+	})
+}
+
+func (r *resolver) bind(n ast.Node, sym *Symbol) {
+	r.info.Refs[n] = sym
+	sym.Refs = append(sym.Refs, n)
+}
+
+func (r *resolver) inFunc() bool {
+	return r.scope != r.info.Global
+}
+
+func (r *resolver) funcDecl(fn *ast.FuncDecl) {
+	sym := r.info.Func(fn.Name.Name)
+	if sym != nil && sym.Decl == fn {
+		r.bind(fn.Name, sym)
+	}
+	scope := newScope(r.info.Global, fn)
+	r.info.Scopes[fn] = scope
+	r.scope = scope
+	for _, p := range fn.Params {
+		if p.Default != nil {
+			r.expr(p.Default)
+		}
+		r.declareLocal(p.Name, Param, p, false)
+	}
+	r.block(fn.Body)
+	r.scope = r.info.Global
+}
+
+// declareLocal declares v in the current function, or binds it to the
+// global symbol at the top level
+func (r *resolver) declareLocal(v *ast.Variable, kind SymbolKind, decl ast.Node, static bool) {
+	if !r.inFunc() {
+		r.declareGlobal(v)
+		return
+	}
+	if sym := r.scope.LookupLocal(v.Name); sym != nil {
+		r.bind(v, sym)
+		return
+	}
+	if g := r.info.Global.LookupLocal(v.Name); g != nil && !g.Implicit {
+		what := "local"
+		if kind == Param {
+			what = "parameter"
+		}
+		r.report(Shadowed, v.Pos(), v.Name, "%s $%s in %s shadows the global declared at line %d",
+			what, v.Name, r.scope.Func.Name.Name, g.DeclPos.Line)
+	}
+	sym := &Symbol{
+		Name:    v.Name,
+		Kind:    kind,
+		Static:  static,
+		Decl:    decl,
+		DeclPos: v.Pos(),
+	}
+	r.scope.insert(sym)
+	r.bind(v, sym)
+}
+
+func (r *resolver) declareGlobal(v *ast.Variable) {
+	sym := r.info.Global.LookupLocal(v.Name)
+	if sym == nil {
+		// declared by a statement collect didn't see
+		r.newGlobal(v, Var, nil, false)
+		sym = r.info.Global.LookupLocal(v.Name)
+	}
+	r.bind(v, sym)
+}
+
+func (r *resolver) decl(d *ast.DeclStmt) {
+	kind := Var
+	if d.Const {
+		kind = Const
+	}
+	for _, spec := range d.Specs {
+		for _, dim := range spec.Dims {
+			r.expr(dim)
+		}
+		if spec.Value != nil {
+			r.expr(spec.Value)
+		}
+		switch strings.ToLower(d.Scope) {
+		case "global":
+			r.declareGlobal(spec.Name)
+		case "dim":
+			// Dim reuses a global of the same name
+			if g := r.info.Global.LookupLocal(spec.Name.Name); g != nil && r.scope.LookupLocal(spec.Name.Name) == nil {
+				r.bind(spec.Name, g)
+				continue
+			}
+			r.declareLocal(spec.Name, kind, spec, d.Static)
+		default:
+			r.declareLocal(spec.Name, kind, spec, d.Static)
+		}
+	}
+}
+
+// assign binds the target of an assignment, creating the variable if
+// it wasn't declared
+func (r *resolver) assign(v *ast.Variable, stmt ast.Node) {
+	if sym := r.scope.Lookup(v.Name); sym != nil {
+		r.bind(v, sym)
+		return
+	}
+	r.report(Implicit, v.Pos(), v.Name, "$%s assigned without declaration", v.Name)
+	sym := &Symbol{
+		Name:     v.Name,
+		Kind:     Var,
+		Implicit: true,
+		Decl:     stmt,
+		DeclPos:  v.Pos(),
+	}
+	r.scope.insert(sym)
+	r.bind(v, sym)
+}
+
+func (r *resolver) use(v *ast.Variable) {
+	if sym := r.scope.Lookup(v.Name); sym != nil {
+		r.bind(v, sym)
+		return
+	}
+	r.report(Undeclared, v.Pos(), v.Name, "$%s used but never declared", v.Name)
+	sym := &Symbol{
+		Name:     v.Name,
+		Kind:     Var,
+		Implicit: true,
+		DeclPos:  v.Pos(),
+	}
+	r.scope.insert(sym)
+	r.bind(v, sym)
+}
+
+func (r *resolver) funcRef(id *ast.FuncIdent) *Symbol {
+	if id.Builtin {
+		return nil
+	}
+	sym := r.info.Func(id.Name)
+	if sym == nil {
+		r.report(UndefinedFunc, id.Pos(), id.Name, "call to undefined function %s", id.Name)
+		return nil
+	}
+	r.bind(id, sym)
+	return sym
+}
+
+func (r *resolver) expr(x ast.Expr) {
+	ast.Inspect(x, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Variable:
+			r.use(n)
+		case *ast.CallExpr:
+			if id, ok := n.Fun.(*ast.FuncIdent); ok {
+				if sym := r.funcRef(id); sym != nil {
+					r.info.Calls[n] = sym
+				}
+				for _, arg := range n.Args {
+					r.expr(arg)
+				}
+				return false
+			}
+		case *ast.FuncIdent:
+			r.funcRef(n)
+		}
+		return true
+	})
+}
+
+// lvalue resolves the target of an assignment
+func (r *resolver) lvalue(x ast.Expr, stmt ast.Node) {
+	if v, ok := x.(*ast.Variable); ok {
+		r.assign(v, stmt)
+		return
+	}
+	r.expr(x)
+}
+
+func (r *resolver) block(b *ast.BlockStmt) {
+	if b == nil {
+		return
+	}
+	for _, s := range b.List {
+		r.stmt(s)
+	}
+}
+
+func (r *resolver) stmt(s ast.Stmt) {
+	switch s := s.(type) {
+	case *ast.DeclStmt:
+		r.decl(s)
+
+	case *ast.EnumStmt:
+		if s.Step != nil {
+			r.expr(s.Step)
+		}
+		for _, spec := range s.Specs {
+			if spec.Value != nil {
+				r.expr(spec.Value)
+			}
+			if strings.EqualFold(s.Scope, "Global") {
+				r.declareGlobal(spec.Name)
+			} else {
+				r.declareLocal(spec.Name, Const, spec, false)
+			}
+		}
+
+	case *ast.AssignStmt:
+		r.expr(s.Rhs)
+		if s.Op != lexer.OpAssign {
+			// compound assignment reads the target first
+			r.expr(s.Lhs)
+			break
+		}
+		r.lvalue(s.Lhs, s)
+
+	case *ast.ExprStmt:
+		r.expr(s.X)
+
+	case *ast.ReDimStmt:
+		r.expr(s.X)
+
+	case *ast.BlockStmt:
+		r.block(s)
+
+	case *ast.IfStmt:
+		r.expr(s.Cond)
+		r.block(s.Body)
+		if s.Else != nil {
+			r.stmt(s.Else)
+		}
+
+	case *ast.WhileStmt:
+		r.expr(s.Cond)
+		r.block(s.Body)
+
+	case *ast.DoStmt:
+		r.block(s.Body)
+		r.expr(s.Cond)
+
+	case *ast.ForStmt:
+		r.expr(s.From)
+		r.expr(s.To)
+		if s.Step != nil {
+			r.expr(s.Step)
+		}
+		r.loopVar(s.Var, s)
+		r.block(s.Body)
+
+	case *ast.ForInStmt:
+		r.expr(s.X)
+		r.loopVar(s.Var, s)
+		r.block(s.Body)
+
+	case *ast.SelectStmt:
+		for _, c := range s.Cases {
+			r.stmt(c)
+		}
+
+	case *ast.SwitchStmt:
+		r.expr(s.Tag)
+		for _, c := range s.Cases {
+			r.stmt(c)
+		}
+
+	case *ast.CaseClause:
+		for _, x := range s.List {
+			r.expr(x)
+		}
+		r.block(s.Body)
+
+	case *ast.WithStmt:
+		r.expr(s.X)
+		r.block(s.Body)
+
+	case *ast.ReturnStmt:
+		if s.Result != nil {
+			r.expr(s.Result)
+		}
+
+	case *ast.ExitStmt:
+		if s.Code != nil {
+			r.expr(s.Code)
+		}
+
+	case *ast.BranchStmt:
+		if s.Level != nil {
+			r.expr(s.Level)
+		}
+
+	case *ast.FuncDecl:
+		// nested functions aren't valid AutoIt, resolve them anyway
+		saved := r.scope
+		r.funcDecl(s)
+		r.scope = saved
+	}
+}
+
+// loopVar binds the variable of a For loop, which is implicitly local
+// inside functions
+func (r *resolver) loopVar(v *ast.Variable, loop ast.Stmt) {
+	if sym := r.scope.Lookup(v.Name); sym != nil {
+		r.bind(v, sym)
+		return
+	}
+	sym := &Symbol{
+		Name:     v.Name,
+		Kind:     Var,
+		Implicit: true,
+		Decl:     loop,
+		DeclPos:  v.Pos(),
+	}
+	r.scope.insert(sym)
+	r.bind(v, sym)
+}
@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"bytes"
+	"github.com/x0r19x91/libautoit"
+	"io/ioutil"
+	"testing"
+)
+
+func TestArchives(t *testing.T) {
+	data, err := ioutil.ReadFile("test.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := libautoit.GetScripts(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Archives) != 1 {
+		t.Fatalf("%d archives", len(f.Archives))
+	}
+	a := f.Archives[0]
+	if a.Key != 0 || a.Subtype != "AU3!EA06" || a.Version != libautoit.EA06 || len(a.Resources) != len(f.Resources) {
+		t.Errorf("archive: %v", a)
+	}
+	for _, r := range f.Resources {
+		if r.Archive != a {
+			t.Errorf("%s: archive %v", r.Name(), r.Archive)
+		}
+	}
+
+	// a decoy, the archive and the archive under another key
+	region := data[a.Offset : a.End+8]
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 32))
+	buf.Write(libautoit.Au3HeaderEA06)
+	buf.WriteString("AU3!EA06")
+	buf.Write(bytes.Repeat([]byte{0xcc}, 0x40))
+	buf.Write(region)
+	for _, c := range region {
+		buf.WriteByte(c ^ 0x21)
+	}
+	f, err = libautoit.GetScripts(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Archives) != 3 {
+		t.Fatalf("%d archives", len(f.Archives))
+	}
+	decoy, plain, keyed := f.Archives[0], f.Archives[1], f.Archives[2]
+	if decoy.Offset != 32 || len(decoy.Resources) != 0 {
+		t.Errorf("decoy: %v", decoy)
+	}
+	if plain.Offset != 32+0x58 || plain.Key != 0 || plain.End-plain.Offset != a.End-a.Offset {
+		t.Errorf("plain: %v", plain)
+	}
+	if keyed.Offset != plain.Offset+len(region) || keyed.Key != 0x21 || keyed.End-keyed.Offset != a.End-a.Offset {
+		t.Errorf("keyed: %v", keyed)
+	}
+	if len(f.Resources) != 2*len(a.Resources) {
+		t.Fatalf("%d resources", len(f.Resources))
+	}
+	for i, r := range keyed.Resources {
+		if r.Archive != keyed || f.Resources[len(a.Resources)+i] != r || !bytes.Equal(r.Data, plain.Resources[i].Data) {
+			t.Errorf("keyed resource %d", i)
+		}
+	}
+}
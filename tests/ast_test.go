@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/lexer"
+	"github.com/x0r19x91/libautoit/parser"
+	"strings"
+	"testing"
+)
+
+const sampleScript = `#include <File.au3>
+Global Const $KEY = 0x1F, $NAME = "it's ""quoted"""
+Global Enum Step *2 $E_A = 1, $E_B
+Local $aList[3] = [1, 2, 3]
+
+Func _Decode($sData, ByRef $iCount, $iKey = $KEY)
+	Local $sOut = ''
+	For $i = 1 To StringLen($sData) Step 1
+		$sOut &= Chr(BitXOR(Asc(StringMid($sData, $i, 1)), $iKey))
+	Next
+	If $iCount > 0 And Not @error Then $iCount -= 1
+	Switch $iCount
+		Case 1 To 5, 7
+			Return $iCount > 1 ? $sOut : ''
+		Case Else
+			ExitLoop
+	EndSwitch
+	With $oObj
+		.Visible = True
+		.Navigate("http://example.com/" & _
+			$sOut)
+	EndWith
+	Return $sOut
+EndFunc
+`
+
+func TestParseAndWalk(t *testing.T) {
+	script, err := parser.ParseSource([]byte(sampleScript))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(script.Funcs()) != 1 || script.Funcs()[0].Name.Name != "_Decode" {
+		t.Fatalf("expected a single function _Decode")
+	}
+
+	var calls []string
+	ast.Inspect(script, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok && call.CalleeName() != "" {
+			calls = append(calls, call.CalleeName())
+		}
+		return true
+	})
+	want := "StringLen Chr BitXOR Asc StringMid"
+	if got := strings.Join(calls, " "); got != want {
+		t.Errorf("calls = %q, want %q", got, want)
+	}
+
+	decl := script.Stmts[1].(*ast.DeclStmt)
+	if s, _ := ast.StringValue(decl.Specs[1].Value); s != `it's "quoted"` {
+		t.Errorf("string literal decoded as %q", s)
+	}
+
+	// printing and parsing again must give the same source
+	src := ast.Format(script)
+	again, err := parser.ParseSource([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ast.Format(again) != src {
+		t.Errorf("round trip changed the source:\n%s\n---\n%s", src, ast.Format(again))
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	script, err := parser.ParseSource([]byte(sampleScript))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast.Rewrite(script, func(c *ast.Cursor) bool {
+		switch n := c.Node().(type) {
+		case *ast.CallExpr:
+			// Chr(...) -> "?"
+			if n.CalleeName() == "Chr" {
+				c.Replace(&ast.BasicLit{Kind: lexer.StrLit, Value: "?"})
+				return false
+			}
+		case *ast.DirectiveStmt:
+			c.Delete()
+		case *ast.ReturnStmt:
+			if c.Index() >= 0 {
+				c.InsertBefore(&ast.ExprStmt{X: &ast.CallExpr{
+					Fun:  &ast.FuncIdent{Name: "ConsoleWrite", Builtin: true},
+					Args: []ast.Expr{&ast.Variable{Name: "sOut"}},
+				}})
+			}
+		}
+		return true
+	}, nil)
+
+	src := ast.Format(script)
+	if strings.Contains(src, "#include") || strings.Contains(src, "Chr(") {
+		t.Errorf("rewrite not applied:\n%s", src)
+	}
+	if strings.Count(src, "ConsoleWrite($sOut)") != 2 {
+		t.Errorf("expected two inserted statements:\n%s", src)
+	}
+	if !strings.Contains(src, `$sOut &= "?"`) {
+		t.Errorf("replacement missing:\n%s", src)
+	}
+}
+
+// the tree parser reads text with its own tokenizer, tidy's is unchanged
+func TestSourceTokenizer(t *testing.T) {
+	src := "#include <File.au3>\n$a[0] = 1 ? \"x\"\"y\" : 0xff\n"
+	var old, tree []string
+	for lex := lexer.NewTokenizer([]byte(src)); ; {
+		tok := lex.NextToken()
+		if tok.TokType == lexer.EOF || tok.TokType == lexer.InvalidToken {
+			break
+		}
+		old = append(old, tok.Value)
+		if tok.Value == "[" && tok.TokType != lexer.LParen {
+			t.Errorf("tokenizer: [ is %v", tok.TokType)
+		}
+	}
+	for lex := parser.NewSourceTokenizer([]byte(src)); ; {
+		tok := lex.NextToken()
+		if tok.TokType == lexer.EOF || tok.TokType == lexer.InvalidToken {
+			break
+		}
+		tree = append(tree, tok.Value)
+	}
+	if got := strings.Join(old, " "); got != "#include < File . au3 > \n $a [ 0 ] = 1" {
+		t.Errorf("tokenizer: %q", got)
+	}
+	if got := strings.Join(tree, " "); got != "#include <File.au3> \n $a [ 0 ] = 1 ? \"x\"\"y\" : 0xff \n \n" {
+		t.Errorf("source tokenizer: %q", got)
+	}
+	if lexer.OpEq.IsBinaryOp() || ast.BinaryPrec(lexer.OpEq) != lexer.OpAssign.GetBinaryPrec() {
+		t.Error("OpEq precedence")
+	}
+}
@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"github.com/x0r19x91/libautoit"
+	"github.com/x0r19x91/libautoit/batch"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func writeZip(t *testing.T, path string, files map[string][]byte) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	zw.Close()
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTarGz(t *testing.T, path string, files map[string][]byte) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, data := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		tw.Write(data)
+	}
+	tw.Close()
+	gz.Close()
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func noTidy(context.Context, *libautoit.AutoItResource) (string, error) {
+	return "", nil
+}
+
+func TestBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sample, err := ioutil.ReadFile("test.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock, err := ioutil.ReadFile("Clock.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "test.exe"), sample, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a sample"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "big.bin"), make([]byte, 8<<20), 0644)
+	writeZip(t, filepath.Join(dir, "set.zip"), map[string][]byte{"a/clock.exe": clock, "b.txt": []byte("x")})
+	writeTarGz(t, filepath.Join(dir, "set.tgz"), map[string][]byte{"test.exe": sample})
+	var gzBuf bytes.Buffer
+	gz := gzip.NewWriter(&gzBuf)
+	gz.Write(clock)
+	gz.Close()
+	ioutil.WriteFile(filepath.Join(dir, "clock.exe.gz"), gzBuf.Bytes(), 0644)
+
+	byName := make(map[string]*batch.Result)
+	err = batch.Scan([]string{dir, filepath.Join(dir, "missing")}, batch.Options{Workers: 3, MaxSize: 4 << 20}, func(r *batch.Result) error {
+		byName[strings.TrimPrefix(filepath.ToSlash(r.Name), filepath.ToSlash(dir)+"/")] = r
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := []string{"big.bin", "clock.exe.gz", "missing", "notes.txt", "set.tgz!test.exe", "set.zip!a/clock.exe", "set.zip!b.txt", "sub/test.exe"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Fatalf("samples: %v", names)
+	}
+	for _, name := range []string{"sub/test.exe", "set.tgz!test.exe", "set.zip!a/clock.exe", "clock.exe.gz"} {
+		r := byName[name]
+		if r.Error != "" || r.Version != "AU3.EA06" || len(r.Resources) != 2 || !r.Resources[1].Script || r.Resources[1].Lines == 0 || len(r.SHA256) != 64 {
+			t.Errorf("%s: %+v", name, r)
+		}
+	}
+	if r := byName["notes.txt"]; r.Error != libautoit.ErrScriptNotFound.Error() {
+		t.Errorf("notes.txt: %q", r.Error)
+	}
+	if r := byName["big.bin"]; !strings.Contains(r.Error, "larger than") {
+		t.Errorf("big.bin: %q", r.Error)
+	}
+	if r := byName["missing"]; r.Error == "" {
+		t.Error("missing path without an error")
+	}
+
+	// a panic or a slow sample only fails itself
+	samples := filepath.Join(dir, "sub")
+	ioutil.WriteFile(filepath.Join(samples, "clock.exe"), clock, 0644)
+	var results []*batch.Result
+	err = batch.Scan([]string{samples}, batch.Options{
+		Tidy: func(ctx context.Context, r *libautoit.AutoItResource) (string, error) {
+			if strings.Contains(r.Path, "autD165") { // the script of Clock.exe
+				panic("boom")
+			}
+			return "", nil
+		},
+	}, func(r *batch.Result) error {
+		results = append(results, r)
+		return nil
+	})
+	if err != nil || len(results) != 2 {
+		t.Fatalf("%v %d", err, len(results))
+	}
+	for _, r := range results {
+		if strings.HasSuffix(r.Name, "clock.exe") != (r.Error == "panic: boom") {
+			t.Errorf("%s: %q", r.Name, r.Error)
+		}
+	}
+	results = nil
+	// the worker waits for the sample to stop
+	var entered, returned int32
+	err = batch.Scan([]string{filepath.Join(samples, "test.exe")}, batch.Options{
+		Timeout: 50 * time.Millisecond,
+		Tidy: func(ctx context.Context, r *libautoit.AutoItResource) (string, error) {
+			atomic.AddInt32(&entered, 1)
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&returned, 1)
+			return "", ctx.Err()
+		},
+	}, func(r *batch.Result) error {
+		results = append(results, r)
+		return nil
+	})
+	if err != nil || len(results) != 1 || !strings.Contains(results[0].Error, batch.ErrTimeout.Error()) {
+		t.Errorf("timeout: %v %+v", err, results)
+	}
+	if atomic.LoadInt32(&returned) != atomic.LoadInt32(&entered) {
+		t.Error("scan returned before the sample stopped")
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = batch.Scan([]string{dir}, batch.Options{Workers: 2, Tidy: noTidy}, func(r *batch.Result) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("stop: %v after %d", err, n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := batch.ScanContext(ctx, []string{dir}, batch.Options{}, func(*batch.Result) error { return nil }); err != context.Canceled {
+		t.Errorf("canceled: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := batch.Scan([]string{samples}, batch.Options{Tidy: noTidy}, batch.JSONL(&buf)); err != nil || strings.Count(buf.String(), "\n") != 2 {
+		t.Errorf("jsonl: %v\n%s", err, buf.String())
+	}
+}
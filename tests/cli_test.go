@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCLI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "autoit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bin := filepath.Join(dir, "autoit")
+	if out, err := exec.Command("go", "build", "-o", bin, "../cmd/autoit").CombinedOutput(); err != nil {
+		t.Fatalf("build: %v\n%s", err, out)
+	}
+	run := func(args ...string) (string, int) {
+		out, err := exec.Command(bin, args...).Output()
+		if e, ok := err.(*exec.ExitError); ok {
+			return string(out), e.ExitCode()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out), 0
+	}
+
+	if out, code := run("info", "test.exe"); code != 0 || !strings.Contains(out, "AU3.EA06") {
+		t.Errorf("info: %d\n%s", code, out)
+	}
+	if out, code := run("info", "-depth", "2", "test.exe"); code != 0 || strings.Contains(out, "nested:") {
+		t.Errorf("info -depth: %d\n%s", code, out)
+	}
+	if out, code := run("decompile", "-func-comments=false", "test.exe"); code != 0 || !strings.Contains(out, "EndFunc\n") || strings.Contains(out, "; -> ") {
+		t.Errorf("decompile: %d", code)
+	}
+	if out, code := run("tokens", "test.exe"); code != 0 || !strings.Contains(out, "Keyword") {
+		t.Errorf("tokens: %d", code)
+	}
+	out, code := run("json", "test.exe", "missing.exe")
+	var manifest []struct {
+		File      string
+		Exit      int
+		Resources []struct{ Script bool }
+	}
+	if err := json.Unmarshal([]byte(out), &manifest); err != nil || code != 1 || len(manifest) != 2 {
+		t.Fatalf("json: %d %v\n%s", code, err, out)
+	}
+	if manifest[0].Exit != 0 || len(manifest[0].Resources) != 2 || !manifest[0].Resources[1].Script || manifest[1].Exit != 1 {
+		t.Errorf("json: %+v", manifest)
+	}
+	out, code = run("extract", "-o", filepath.Join(dir, "out"), "test.exe")
+	if code != 0 || strings.Count(out, "\n") != 2 {
+		t.Errorf("extract: %d\n%s", code, out)
+	}
+	out, code = run("scan", "-workers", "2", "test.exe", "Clock.exe", "utils_test.go")
+	if code != 0 || strings.Count(out, "\n") != 3 || strings.Count(out, `"version":"AU3.EA06"`) != 2 {
+		t.Errorf("scan: %d\n%s", code, out)
+	}
+	// a fingerprint DB made from a function of the script itself
+	src, _ := run("decompile", "test.exe")
+	start := strings.Index(src, "Func _WinAPI_MsgBox(")
+	end := strings.Index(src[start:], "EndFunc") + start + len("EndFunc")
+	inc := filepath.Join(dir, "Include")
+	os.Mkdir(inc, 0755)
+	if err := ioutil.WriteFile(filepath.Join(inc, "WinAPI.au3"), []byte(src[start:end]+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db := filepath.Join(dir, "udf.json")
+	if _, code := run("udfdb", "-o", db, inc); code != 0 {
+		t.Errorf("udfdb: exit %d", code)
+	}
+	out, code = run("decompile", "-strip-udf", db, "test.exe")
+	if code != 0 || !strings.Contains(out, "#include <WinAPI.au3>") || strings.Contains(out, "Func _WinAPI_MsgBox(") || !strings.Contains(out, "Func _WinAPI_ShowMsg(") {
+		t.Errorf("strip-udf: %d", code)
+	}
+	if _, code := run("info", "utils_test.go"); code != 3 {
+		t.Errorf("no script: exit %d", code)
+	}
+	if _, code := run("decompile", "-case", "mixed", "test.exe"); code != 2 {
+		t.Errorf("bad flag: exit %d", code)
+	}
+}
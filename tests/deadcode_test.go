@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/deadcode"
+	"github.com/x0r19x91/libautoit/parser"
+	"strings"
+	"testing"
+)
+
+const junkScript = `Global $gUsed = 1, $gJunk = 2, $gEval = 3, $gInit = _Init()
+Global $gOnlyInJunk = "x"
+Global $gNamed = 0
+_Main()
+
+Func _Main()
+	ConsoleWrite($gUsed & Eval("gEval"))
+	Execute("_FromExecute()")
+	Call($sName)
+EndFunc
+
+Func _Init()
+	Return 0
+EndFunc
+
+Func _FromExecute()
+EndFunc
+
+Func _Junk1()
+	Return $gOnlyInJunk
+EndFunc
+
+Func _Junk2()
+	MsgBox(0, "", "gNamed")
+EndFunc
+`
+
+func TestEliminate(t *testing.T) {
+	script, err := parser.ParseSource([]byte(junkScript))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep := deadcode.Eliminate(script, deadcode.Options{})
+	if got := strings.Join(rep.Funcs, " "); got != "_Junk1 _Junk2" {
+		t.Errorf("removed functions = %q", got)
+	}
+	if got := strings.Join(rep.Globals, " "); got != "gJunk gOnlyInJunk gNamed" {
+		t.Errorf("removed globals = %q", got)
+	}
+	src := ast.Format(script)
+	if !strings.HasPrefix(src, "Global $gUsed = 1, $gEval = 3, $gInit = _Init()\n_Main()") {
+		t.Errorf("unexpected output:\n%s", src)
+	}
+
+	// the computed Call keeps every function, the literal keeps $gNamed
+	script, _ = parser.ParseSource([]byte(junkScript))
+	rep = deadcode.Eliminate(script, deadcode.Options{Conservative: true})
+	if len(rep.Funcs) != 0 || len(rep.Notes) != 1 {
+		t.Errorf("conservative mode removed %v, notes %v", rep.Funcs, rep.Notes)
+	}
+	if got := strings.Join(rep.Globals, " "); got != "gJunk" {
+		t.Errorf("conservative mode removed globals %q", got)
+	}
+}
+
+func TestEliminateEventHandlers(t *testing.T) {
+	src := `$oIE = ObjCreate("InternetExplorer.Application")
+ObjEvent($oIE, "IE_")
+TraySetOnEvent(-7, "_OnTray")
+$idExit = TrayCreateItem("Exit")
+TrayItemSetOnEvent($idExit, "_OnExit")
+
+Func IE_OnQuit()
+EndFunc
+
+Func _OnTray()
+EndFunc
+
+Func _OnExit()
+EndFunc
+
+Func _Junk()
+EndFunc
+`
+	for _, conservative := range []bool{false, true} {
+		script, err := parser.ParseSource([]byte(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rep := deadcode.Eliminate(script, deadcode.Options{Conservative: conservative})
+		if got := strings.Join(rep.Funcs, " "); got != "_Junk" {
+			t.Errorf("conservative %v: removed functions = %q", conservative, got)
+		}
+	}
+}
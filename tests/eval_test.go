@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"errors"
+	"github.com/x0r19x91/libautoit/deobf"
+	"github.com/x0r19x91/libautoit/eval"
+	"github.com/x0r19x91/libautoit/parser"
+	"strings"
+	"testing"
+	"time"
+)
+
+const decryptor = `Global Const $KEY = 7
+Local $url = _d("111|115|115|119|61|40|40", $KEY) & "evil"
+Local $x = _d("66|127|98", 7)
+FileDelete(_d("99|110|107", 7))
+
+Func _d($s, $k)
+	Local $a = StringSplit($s, "|"), $r = ""
+	For $i = 1 To $a[0]
+		$r &= Chr(BitXOR(Number($a[$i]), $k))
+	Next
+	Return $r
+EndFunc
+
+Func _loop()
+	While 1
+	WEnd
+EndFunc
+
+Func _kill($f)
+	FileDelete($f)
+	Return 1
+EndFunc
+`
+
+func TestInterpreter(t *testing.T) {
+	script, err := parser.ParseSource([]byte(decryptor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := eval.NewInterpreter(script)
+	in.InitConsts(script)
+	if v, ok := in.Global("KEY"); !ok || v.Int64() != 7 {
+		t.Errorf("$KEY = %v", v)
+	}
+	v, err := in.CallFunc("_d", []eval.Value{eval.StringValue("66|127|98"), eval.IntValue(7)})
+	if err != nil || v.Str() != "Exe" {
+		t.Errorf("_d = %q, %v", v.Str(), err)
+	}
+
+	in.SetLimits(eval.Limits{MaxSteps: 10000, Timeout: time.Second})
+	if _, err := in.CallFunc("_loop", nil); !errors.Is(err, eval.ErrStepLimit) {
+		t.Errorf("_loop: %v", err)
+	}
+	if _, err := in.CallFunc("_kill", []eval.Value{eval.StringValue("x")}); !errors.Is(err, eval.ErrImpure) {
+		t.Errorf("_kill: %v", err)
+	}
+}
+
+func TestBinaryInt64(t *testing.T) {
+	for _, c := range []struct {
+		b []byte
+		n int64
+	}{
+		{[]byte{0x01, 0x02}, 0x0201},
+		{[]byte{1, 2, 3, 4, 5, 6, 7, 8}, 0x0807060504030201},
+		// only the first 8 bytes count
+		{[]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 0x0807060504030201},
+	} {
+		if n := eval.BinaryValue(c.b).Int64(); n != c.n {
+			t.Errorf("Int64(%x) = %#x", c.b, n)
+		}
+	}
+}
+
+func TestDeobfuscateCalls(t *testing.T) {
+	script, err := parser.ParseSource([]byte(decryptor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := deobf.Deobfuscate(script, deobf.Options{CallUser: true})
+	src := res.Source()
+	for _, want := range []string{
+		`Local $x = "Exe"`,
+		`FileDelete("dil")`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("missing %q in:\n%s", want, src)
+		}
+	}
+	// $KEY isn't a literal, the call stays
+	if !strings.Contains(src, `_d("111|115|115|119|61|40|40", $KEY)`) {
+		t.Errorf("call with a variable argument was replaced:\n%s", src)
+	}
+}
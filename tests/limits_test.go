@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"github.com/x0r19x91/libautoit"
+	"github.com/x0r19x91/libautoit/lexer"
+	"github.com/x0r19x91/libautoit/tidy"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cancelingTokenizer cancels its context after some tokens
+type cancelingTokenizer struct {
+	lexer.ITokenizer
+	n, after int
+	cancel   context.CancelFunc
+}
+
+func (c *cancelingTokenizer) NextToken() *lexer.Token {
+	if c.n++; c.n == c.after {
+		c.cancel()
+	}
+	return c.ITokenizer.NextToken()
+}
+
+func TestLimits(t *testing.T) {
+	data, err := ioutil.ReadFile("test.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	load := func(l libautoit.Limits) (*libautoit.AutoItFile, error) {
+		return libautoit.GetScriptsContext(context.Background(), append([]byte(nil), data...), l)
+	}
+
+	f, err := load(libautoit.DefaultLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.DecompressContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	script := f.Resources[1]
+	if !script.IsAutoItScript(500) {
+		t.Fatal("script not decompressed")
+	}
+	size := int64(len(script.Data))
+
+	if _, err := load(libautoit.Limits{MaxResources: 1}); err != libautoit.ErrTooManyResources {
+		t.Errorf("max resources: %v", err)
+	}
+	f, _ = load(libautoit.Limits{MaxResource: size - 1})
+	if err := f.DecompressContext(context.Background()); err != libautoit.ErrResourceTooLarge || f.Resources[1].State != libautoit.Au3Initialized {
+		t.Errorf("max resource: %v", err)
+	}
+	f, _ = load(libautoit.Limits{MaxTotal: size - 1})
+	if err := f.DecompressContext(context.Background()); err != libautoit.ErrOutputTooLarge {
+		t.Errorf("max total: %v", err)
+	}
+	f, _ = load(libautoit.Limits{Deadline: time.Now().Add(time.Minute)})
+	if err := f.DecompressContext(context.Background()); err != nil {
+		t.Errorf("deadline: %v", err)
+	}
+	if _, err := load(libautoit.Limits{Deadline: time.Now().Add(-time.Second)}); err != context.DeadlineExceeded {
+		t.Errorf("past deadline: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := libautoit.GetScriptsContext(ctx, append([]byte(nil), data...), libautoit.Limits{}); err != context.Canceled {
+		t.Errorf("canceled: %v", err)
+	}
+	if err := script.DecompressContext(ctx, 0); err != context.Canceled {
+		t.Errorf("canceled decompress: %v", err)
+	}
+	if _, err := tidy.NewTidyInfo(script.CreateTokenizer()).TidyContext(ctx); err != context.Canceled {
+		t.Errorf("canceled tidy: %v", err)
+	}
+	// a long line is not read to its end once ctx is done
+	long := "$x = 1\n$a = 1" + strings.Repeat(" & 1", 100000) + "\n"
+	ctx, cancel = context.WithCancel(context.Background())
+	lex := &cancelingTokenizer{ITokenizer: lexer.NewTokenizer([]byte(long)), after: 10, cancel: cancel}
+	if _, err := tidy.NewTidyInfo(lex).TidyContext(ctx); err != context.Canceled || lex.n > 2000 {
+		t.Errorf("canceled long line: %v after %d tokens", err, lex.n)
+	}
+
+	// sizes claimed by the headers are refused before allocating
+	bomb := []byte("EA06\x7f\xff\xff\xff\x00\x00\x00\x00")
+	if _, err := libautoit.NewEa06Decompressor(bomb, 16).DecompressContext(context.Background(), 1<<20); err != libautoit.ErrResourceTooLarge {
+		t.Errorf("bomb: %v", err)
+	}
+	r := &libautoit.AutoItResource{
+		IsCompressed:     true,
+		DecompressedSize: 0xfffffff0,
+		Data:             bomb,
+		Decompressor:     libautoit.CreateDecompressor(libautoit.EA06, bomb, 0xfffffff0),
+	}
+	if err := r.DecompressContext(context.Background(), libautoit.DefaultLimits.MaxResource); err != libautoit.ErrResourceTooLarge {
+		t.Errorf("declared bomb: %v", err)
+	}
+	if _, err := libautoit.CreateDecompressor(libautoit.EA05, []byte("EA0"), 4).Decompress(); err != libautoit.ErrInvalidSignature {
+		t.Errorf("short input: %v", err)
+	}
+
+	// truncated or overlong JB01 streams fail instead of panicking
+	if _, err := libautoit.NewJB01Decompressor([]byte("JB01\x00\x00\x00\x04\xff"), 4).Decompress(); err != libautoit.ErrOutOfBounds {
+		t.Errorf("truncated jb01: %v", err)
+	}
+	overlong := append([]byte("JB01\x00\x00\x00\x01"), bytes.Repeat([]byte{0xc0}, 64)...)
+	if _, err := libautoit.NewJB01Decompressor(overlong, 1).Decompress(); err != libautoit.ErrDecompressFailed {
+		t.Errorf("match past the end: %v", err)
+	}
+}
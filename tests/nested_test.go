@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/x0r19x91/libautoit"
+	"io/ioutil"
+	"testing"
+	"unicode/utf16"
+)
+
+// packEA06 builds an EA06 archive of uncompressed resources, the sizes
+// XORed with the keys of NewEA06
+func packEA06(files map[string][]byte, order []string, compressed ...string) []byte {
+	keys := libautoit.NewEA06()
+	u32 := func(buf *bytes.Buffer, v int) {
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], uint32(v))
+		buf.Write(b[:])
+	}
+	str := func(buf *bytes.Buffer, s string, sizeKey int, key libautoit.KValue) {
+		var u []byte
+		for _, c := range utf16.Encode([]rune(s)) {
+			u = append(u, byte(c), byte(c>>8))
+		}
+		u32(buf, len(s)^sizeKey)
+		buf.Write(keys.DecodeStream(u, key))
+	}
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 64)) // the stub
+	buf.Write(libautoit.Au3HeaderEA06)
+	buf.WriteString("AU3!EA06")
+	buf.Write(make([]byte, 16))
+	for _, name := range order {
+		data := files[name]
+		buf.Write(keys.DecodeStream([]byte("FILE"), keys.GetFile()))
+		str(&buf, name, 0xadbc, keys.GetTag())
+		str(&buf, `C:\`+name, 0xf820, keys.GetPath())
+		flag := byte(0)
+		for _, c := range compressed {
+			if c == name {
+				flag = 1
+			}
+		}
+		buf.WriteByte(flag)
+		u32(&buf, len(data)^0x87bc)
+		u32(&buf, len(data)^0x87bc)
+		u32(&buf, 0^0xa685)
+		buf.Write(make([]byte, 16))
+		buf.Write(keys.DecodeStream(data, keys.GetData()))
+	}
+	buf.WriteString("AU3!EA06")
+	return buf.Bytes()
+}
+
+func TestGetScriptsRecursive(t *testing.T) {
+	inner, err := ioutil.ReadFile("test.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mid := packEA06(map[string][]byte{"inner.exe": inner}, []string{"inner.exe"})
+	outer := packEA06(map[string][]byte{
+		"mid.exe":   mid,
+		"copy.exe":  mid,
+		"inner.exe": inner,
+		"note.txt":  []byte("not a script"),
+	}, []string{"mid.exe", "copy.exe", "inner.exe", "note.txt"})
+
+	root, err := libautoit.GetScriptsRecursive(context.Background(), outer, libautoit.DefaultLimits, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.Resources) != 4 || root.Depth != 0 || root.Parent != nil {
+		t.Fatalf("root: %d resources", len(root.Resources))
+	}
+	// the copy and the deeper inner.exe are unpacked once
+	if len(root.Children) != 2 {
+		t.Fatalf("%d children", len(root.Children))
+	}
+	m, in := root.Children[0], root.Children[1]
+	if m.Source.Name() != "mid.exe" || m.Parent != root || m.Depth != 1 || len(m.Resources) != 1 || len(m.Children) != 0 {
+		t.Errorf("mid: %+v", m)
+	}
+	if in.Source.Name() != "inner.exe" || in.Depth != 1 || in.Err != nil || in.Version != libautoit.EA06 || !in.Resources[1].IsAutoItScript(500) {
+		t.Errorf("inner: %+v", in)
+	}
+	n := 0
+	root.Walk(func(*libautoit.AutoItFile) bool {
+		n++
+		return true
+	})
+	if n != 3 {
+		t.Errorf("walked %d files", n)
+	}
+
+	// inner.exe only through mid.exe
+	root, err = libautoit.GetScriptsRecursive(context.Background(), packEA06(map[string][]byte{"mid.exe": mid}, []string{"mid.exe"}), libautoit.DefaultLimits, 0)
+	if err != nil || len(root.Children) != 1 || len(root.Children[0].Children) != 1 {
+		t.Fatalf("chain: %v", err)
+	}
+	if leaf := root.Children[0].Children[0]; leaf.Depth != 2 || leaf.Parent != root.Children[0] || leaf.Source.Name() != "inner.exe" {
+		t.Errorf("leaf: %+v", leaf)
+	}
+	root, _ = libautoit.GetScriptsRecursive(context.Background(), packEA06(map[string][]byte{"mid.exe": mid}, []string{"mid.exe"}), libautoit.DefaultLimits, 1)
+	if len(root.Children) != 1 || len(root.Children[0].Children) != 0 {
+		t.Error("depth limit not enforced")
+	}
+
+	// a resource failing to decompress doesn't stop the others
+	broken := packEA06(map[string][]byte{"bad.bin": []byte("EA07garbage"), "mid.exe": mid}, []string{"bad.bin", "mid.exe"}, "bad.bin")
+	root, err = libautoit.GetScriptsRecursive(context.Background(), broken, libautoit.DefaultLimits, 0)
+	if err == nil || root == nil || root.Err != err || len(root.Children) != 1 || len(root.Children[0].Children) != 1 {
+		t.Errorf("broken resource: %v", err)
+	}
+
+	// the limits are shared by the whole tree
+	l := libautoit.DefaultLimits
+	l.MaxTotal = int64(len(mid) + len(inner)/2)
+	root, err = libautoit.GetScriptsRecursive(context.Background(), packEA06(map[string][]byte{"mid.exe": mid}, []string{"mid.exe"}), l, 0)
+	if err != libautoit.ErrOutputTooLarge || len(root.Children) != 1 || len(root.Children[0].Children) != 0 {
+		t.Errorf("shared total: %v", err)
+	}
+	l = libautoit.DefaultLimits
+	l.MaxResources = 2
+	root, err = libautoit.GetScriptsRecursive(context.Background(), packEA06(map[string][]byte{"mid.exe": mid}, []string{"mid.exe"}), l, 0)
+	if err != libautoit.ErrTooManyResources || len(root.Children) != 1 || len(root.Children[0].Children) != 0 {
+		t.Errorf("shared resources: %v", err)
+	}
+}
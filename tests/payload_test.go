@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/x0r19x91/libautoit"
+	"github.com/x0r19x91/libautoit/parser"
+	"github.com/x0r19x91/libautoit/payload"
+	"strings"
+	"testing"
+)
+
+// fakePE is the smallest header Identify accepts
+func fakePE() []byte {
+	pe := make([]byte, 0x80)
+	copy(pe, "MZ")
+	pe[0x3c] = 0x40
+	copy(pe[0x40:], "PE\x00\x00")
+	return pe
+}
+
+func TestScanPayloads(t *testing.T) {
+	pe := strings.ToUpper(hex.EncodeToString(fakePE()))
+	zip := append([]byte("PK\x03\x04"), bytes.Repeat([]byte{0x11}, 96)...)
+	b64 := base64.StdEncoding.EncodeToString(zip)
+	src := fmt.Sprintf(`Local $sPE = "0x%s"
+$sPE &= "%s"
+$sPE = $sPE & "%s" & "%s"
+Local $sShort = "0x4D5A"
+FileWrite("x.zip", _Zip())
+
+Func _Zip()
+	Return BinaryToString(_Base64(%q & %q))
+EndFunc
+`, pe[:40], pe[40:100], pe[100:200], pe[200:], b64[:50], b64[50:])
+
+	script, err := parser.ParseSource([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs := payload.Scan(script, payload.Options{})
+	if len(blobs) != 2 {
+		t.Fatalf("got %d blobs", len(blobs))
+	}
+	if b := blobs[0]; b.Func != "_Zip" || b.Var != "" || b.Type != "ZIP" || b.Encoding != "base64" || !bytes.Equal(b.Data, zip) {
+		t.Errorf("bad zip blob %+v", b)
+	}
+	if b := blobs[1]; b.Var != "sPE" || b.Pos.Line != 1 || b.Type != "PE" || b.Ext != "exe" || !bytes.Equal(b.Data, fakePE()) {
+		t.Errorf("bad PE blob %+v", b)
+	}
+}
+
+func TestExtractPayloads(t *testing.T) {
+	pe := strings.ToUpper(hex.EncodeToString(fakePE()))
+	src := []byte(fmt.Sprintf("Local $sPE = \"0x%s\"\nFileWrite(\"x.exe\", $sPE)\n", pe))
+	bad := []byte("EA07garbage")
+	data := packEA06(map[string][]byte{"bad.au3": bad, "drop.au3": src}, []string{"bad.au3", "drop.au3"}, "bad.au3")
+	f, err := libautoit.GetScripts(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.ExtractPayloads(payload.Options{})
+	errs, ok := err.(libautoit.PayloadErrors)
+	if !ok || len(errs) != 1 || errs[0].Resource != f.Resources[0] {
+		t.Fatalf("got %v", err)
+	}
+	// the script after the broken one is still scanned
+	if len(f.Derived) != 1 || f.Derived[0].Parent != f.Resources[1] || !bytes.Equal(f.Derived[0].Data, fakePE()) {
+		t.Fatalf("got %d payloads", len(f.Derived))
+	}
+	for _, r := range f.Resources {
+		if r.State != libautoit.Au3Initialized {
+			t.Errorf("%s decompressed in place", r.Tag)
+		}
+	}
+	if !bytes.Equal(f.Resources[1].Data, src) {
+		t.Error("resource data changed")
+	}
+}
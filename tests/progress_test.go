@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"github.com/x0r19x91/libautoit"
+	"github.com/x0r19x91/libautoit/batch"
+	"github.com/x0r19x91/libautoit/progress"
+	"github.com/x0r19x91/libautoit/tidy"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	data, err := ioutil.ReadFile("test.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []progress.Event
+	ctx := progress.WithFunc(context.Background(), func(ev progress.Event) {
+		events = append(events, ev)
+	})
+	f, err := libautoit.GetScriptsContext(ctx, data, libautoit.DefaultLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.DecompressContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	r := f.Resources[1]
+	r.Data = bytes.Replace(r.Data, []byte{13, 10}, []byte{10}, -1)
+	ti := tidy.NewTidyInfo(r.CreateTokenizerContext(ctx))
+	lines := 0
+	ti.SetNotifyCallback(func(done, total int) {
+		if done != lines+1 {
+			t.Fatalf("line %d after %d", done, lines)
+		}
+		lines = done
+	})
+	if _, err := ti.TidyContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// each entry point ends with done
+	var dones []int
+	for i, ev := range events {
+		if ev.Stage == progress.Done {
+			dones = append(dones, i)
+		}
+	}
+	n := len(events)
+	if len(dones) != 3 || dones[2] != n-1 {
+		t.Fatalf("done events at %v of %d", dones, n)
+	}
+	var kept []progress.Event
+	for i, ev := range events {
+		if ev.Stage != progress.Done || i == n-1 {
+			kept = append(kept, ev)
+		}
+	}
+	events, n = kept, len(kept)
+
+	last := make(map[progress.Stage]progress.Event)
+	stage := progress.Locate
+	for _, ev := range events[:n-1] {
+		if ev.Stage < stage && !(stage == progress.Tidy && ev.Stage == progress.Tokenize) {
+			t.Fatalf("%v after %v", ev.Stage, stage)
+		}
+		if prev, ok := last[ev.Stage]; ok && ev.Name == prev.Name && ev.Done < prev.Done {
+			t.Fatalf("%v went back from %d to %d", ev.Stage, prev.Done, ev.Done)
+		}
+		if ev.Stage > stage {
+			stage = ev.Stage
+		}
+		last[ev.Stage] = ev
+	}
+	for s := progress.Locate; s < progress.Done; s++ {
+		ev, ok := last[s]
+		if !ok || ev.Done != ev.Total {
+			t.Errorf("%v: last event %+v", s, ev)
+		}
+	}
+	if d := last[progress.Decompress]; d.Name != r.Name() || d.Total == 0 {
+		t.Errorf("decompress: %+v", d)
+	}
+	if lines == 0 || last[progress.Tidy].Done != lines {
+		t.Errorf("tidy: %d lines, %+v", lines, last[progress.Tidy])
+	}
+	if len(events) != n {
+		t.Error("events after the pipeline returned")
+	}
+
+	// an owned pipeline gets the single done of its owner
+	events = nil
+	owned := progress.Own(ctx)
+	f, _ = libautoit.GetScriptsContext(owned, data, libautoit.DefaultLimits)
+	f.DecompressContext(owned)
+	for _, ev := range events {
+		if ev.Stage == progress.Done {
+			t.Fatal("done sent in an owned pipeline")
+		}
+	}
+	progress.Finish(owned, "")
+	if len(events) == 0 || events[len(events)-1].Stage != progress.Done {
+		t.Error("no done from the owner")
+	}
+}
+
+func TestProgressCallbacks(t *testing.T) {
+	data, err := ioutil.ReadFile("test.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := libautoit.GetScripts(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the decompressor's callback runs along and is put back
+	r := f.Resources[1]
+	own := 0
+	r.Decompressor.SetCallback(func(done, tot int) { own++ })
+	reported := 0
+	ctx := progress.WithFunc(context.Background(), func(ev progress.Event) { reported++ })
+	if err := r.DecompressContext(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if own == 0 || reported != own {
+		t.Errorf("callback %d times, progress %d", own, reported)
+	}
+	c, ok := r.Decompressor.(interface{ Callback() func(done, tot int) })
+	if !ok {
+		t.Fatal("no Callback")
+	}
+	c.Callback()(0, 0)
+	if own != reported+1 {
+		t.Error("callback not restored")
+	}
+
+	// batch scans report from every worker, one done per sample
+	var inside int32
+	done := make(map[string]int)
+	ctx = progress.WithFunc(context.Background(), func(ev progress.Event) {
+		if atomic.AddInt32(&inside, 1) != 1 {
+			t.Error("concurrent report")
+		}
+		defer atomic.AddInt32(&inside, -1)
+		if ev.Stage == progress.Done {
+			done[ev.Name]++
+		}
+	})
+	err = batch.ScanContext(ctx, []string{"test.exe", "Clock.exe"}, batch.Options{Workers: 2, Tidy: noTidy}, func(*batch.Result) error { return nil })
+	if err != nil || len(done) != 2 || done["test.exe"] != 1 || done["Clock.exe"] != 1 {
+		t.Errorf("batch: %v %v", err, done)
+	}
+}
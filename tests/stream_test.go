@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"bytes"
+	"github.com/x0r19x91/libautoit"
+	"github.com/x0r19x91/libautoit/lexer"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+)
+
+// bitWriter packs bits the way the decompressors read them
+type bitWriter struct {
+	out   []byte
+	word  uint16
+	count int
+}
+
+func (w *bitWriter) bits(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.word = w.word<<1 | uint16(v>>uint(i)&1)
+		w.count++
+		if w.count == 16 {
+			w.out = append(w.out, byte(w.word>>8), byte(w.word))
+			w.word, w.count = 0, 0
+		}
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.count > 0 {
+		w.bits(0, 16-w.count)
+	}
+	return w.out
+}
+
+func TestStream(t *testing.T) {
+	for _, name := range []string{"test.exe", "Clock.exe"} {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := libautoit.GetScripts(append([]byte(nil), data...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref, _ := libautoit.GetScripts(append([]byte(nil), data...))
+		for i, r := range f.Resources {
+			want, err := ref.Resources[i].Decompressor.Decompress()
+			if !r.IsCompressed {
+				want, err = r.Data, nil
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			rd, err := r.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(iotest.OneByteReader(rd))
+			if err != nil || !bytes.Equal(got, want) {
+				t.Errorf("%s: %s: %d bytes, want %d, %v", name, r.Name(), len(got), len(want), err)
+			}
+			if !r.IsCompressed {
+				continue
+			}
+
+			// tokens straight from the decompressing reader
+			rd = libautoit.NewEa06Reader(iotest.HalfReader(bytes.NewReader(r.Data)), len(r.Data), int(r.DecompressedSize))
+			lex, err := lexer.NewLexerReader(rd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ref.Resources[i].Data = want
+			mem := ref.Resources[i].CreateTokenizer()
+			if lex.NumberOfLines() != mem.NumberOfLines() {
+				t.Errorf("%s: %d lines, want %d", name, lex.NumberOfLines(), mem.NumberOfLines())
+			}
+			for n := 0; n < 20000; n++ {
+				a, b := lex.NextToken(), mem.NextToken()
+				if a.TokType != b.TokType || a.Value != b.Value {
+					t.Errorf("%s: token %d: %v, want %v", name, n, a, b)
+					break
+				}
+				if a.TokType == lexer.EOF {
+					break
+				}
+			}
+		}
+	}
+
+	// abc, then 5 bytes from 3 back
+	w := &bitWriter{out: []byte("EA05\x00\x00\x00\x08")}
+	for _, c := range "abc" {
+		w.bits(0, 1)
+		w.bits(uint32(c), 8)
+	}
+	w.bits(1, 1)
+	w.bits(3, 15)
+	w.bits(2, 2)
+	ea05 := w.bytes()
+	got, err := ioutil.ReadAll(libautoit.NewEa05Reader(bytes.NewReader(ea05), 0, 0))
+	want, _ := libautoit.CreateDecompressor(libautoit.EA05, ea05, 0).Decompress()
+	if err != nil || string(got) != "abcabcab" || !bytes.Equal(got, want) {
+		t.Errorf("ea05: %q %q %v", got, want, err)
+	}
+
+	// abcd, 3 bytes from 4 back and e
+	w = &bitWriter{}
+	w.bits(0, 32)
+	w.bits(8, 32)
+	for _, c := range "abcd" {
+		w.bits(0, 1)
+		w.bits(uint32(c), 8)
+	}
+	w.bits(1, 1)
+	w.bits(1, 13)
+	w.bits(0, 4)
+	w.bits(0, 1)
+	w.bits('e', 8)
+	legacy := w.bytes()
+	got, err = ioutil.ReadAll(libautoit.NewLegacyReader(bytes.NewReader(legacy), 0, 8))
+	want, _ = libautoit.CreateDecompressor(libautoit.Legacy, legacy, 8).Decompress()
+	if err != nil || string(got) != "abcdabce" || !bytes.Equal(got, want) {
+		t.Errorf("legacy: %q %q %v", got, want, err)
+	}
+	got, err = ioutil.ReadAll(libautoit.NewLegacyReader(bytes.NewReader([]byte("plain text")), 0, 4))
+	if err != nil || string(got) != "plain text" {
+		t.Errorf("legacy text: %q %v", got, err)
+	}
+
+	if _, err := ioutil.ReadAll(libautoit.NewEa06Reader(bytes.NewReader(ea05), 0, 0)); err != libautoit.ErrInvalidSignature {
+		t.Errorf("signature: %v", err)
+	}
+	if _, err := ioutil.ReadAll(libautoit.NewEa05Reader(bytes.NewReader(ea05[:12]), 0, 0)); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated: %v", err)
+	}
+	if _, err := ioutil.ReadAll(libautoit.NewJB01Reader(bytes.NewReader(ea05), 0, 0)); err != libautoit.ErrInvalidSignature {
+		t.Errorf("jb01 signature: %v", err)
+	}
+
+	// what follows the compressed data is left in a shared reader
+	shared := struct{ io.Reader }{bytes.NewReader(append(append([]byte(nil), ea05...), "TAIL"...))}
+	got, err = ioutil.ReadAll(libautoit.NewEa05Reader(shared, len(ea05), 0))
+	if rest, _ := ioutil.ReadAll(shared); err != nil || string(got) != "abcabcab" || string(rest) != "TAIL" {
+		t.Errorf("shared reader: %q %v, left %q", got, err, rest)
+	}
+}
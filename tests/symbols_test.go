@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/parser"
+	"github.com/x0r19x91/libautoit/symbols"
+	"testing"
+)
+
+const scopeScript = `Global $gCount = 0
+$gImplicit = 1
+Main()
+
+Func Main()
+	Local $gCount = 5
+	Local $x = Helper($gCount)
+	$y = $x + $undef
+	Missing()
+EndFunc
+
+Func Helper($n)
+	Global $gLater = $n
+	For $i = 1 To $n
+		$gCount += $i
+	Next
+	Return $gCount
+EndFunc
+
+Func helper()
+EndFunc
+`
+
+func TestResolve(t *testing.T) {
+	script, err := parser.ParseSource([]byte(scopeScript))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := symbols.Resolve(script)
+
+	kinds := make(map[symbols.DiagKind][]string)
+	for _, d := range info.Diagnostics {
+		kinds[d.Kind] = append(kinds[d.Kind], d.Name)
+	}
+	expect := map[symbols.DiagKind]string{
+		symbols.Shadowed:      "gCount",
+		symbols.Undeclared:    "undef",
+		symbols.UndefinedFunc: "Missing",
+		symbols.DuplicateFunc: "helper",
+	}
+	for kind, name := range expect {
+		if len(kinds[kind]) != 1 || kinds[kind][0] != name {
+			t.Errorf("%s diagnostics = %v, want [%s]", kind, kinds[kind], name)
+		}
+	}
+	if got := kinds[symbols.Implicit]; len(got) != 2 || got[0] != "gImplicit" || got[1] != "y" {
+		t.Errorf("implicit diagnostics = %v", got)
+	}
+	// $gImplicit is created at the top level, that's an implicit global
+	if g := info.Global.LookupLocal("gImplicit"); g == nil || !g.Implicit {
+		t.Errorf("$gImplicit not resolved as an implicit global")
+	}
+	if g := info.Global.LookupLocal("gLater"); g == nil {
+		t.Errorf("Global declared inside a function not visible")
+	}
+
+	// $gCount in Main is the local, in Helper the global
+	global := info.Global.LookupLocal("gCount")
+	fns := script.Funcs()
+	local := info.Scopes[fns[0]].LookupLocal("gCount")
+	if local == nil || local == global {
+		t.Fatalf("local $gCount not declared")
+	}
+	ast.Inspect(fns[1], func(n ast.Node) bool {
+		if v, ok := n.(*ast.Variable); ok && v.Name == "gCount" && info.SymbolOf(v) != global {
+			t.Errorf("$gCount at %s bound to %v", v.Pos(), info.SymbolOf(v))
+		}
+		return true
+	})
+	if len(global.Refs) != 3 {
+		t.Errorf("global $gCount has %d references, want 3", len(global.Refs))
+	}
+	if sym := info.Func("HELPER"); sym == nil || len(sym.Refs) != 2 {
+		t.Errorf("Helper not bound to its call")
+	}
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"bytes"
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/parser"
+	"github.com/x0r19x91/libautoit/udf"
+	"strings"
+	"testing"
+)
+
+const fakeInclude = `#include-once
+Global Const $STR_NOCASESENSE = 0, $STR_CASESENSE = 1
+Global Const $STR_STRIPLEADING = 1
+
+Func _StringRepeat($sString, $iRepeatCount)
+	Local $sResult = ""
+	For $i = 1 To $iRepeatCount
+		$sResult &= $sString
+	Next
+	Return $sResult
+EndFunc
+`
+
+// the same code as the compiler leaves it, upper cased with the
+// user's code after it
+const expanded = `GLOBAL CONST $STR_NOCASESENSE = 0, $STR_CASESENSE = 1
+GLOBAL CONST $STR_STRIPLEADING = 1
+FUNC _STRINGREPEAT($SSTRING, $IREPEATCOUNT)
+	LOCAL $SRESULT = ""
+	FOR $I = 1 TO $IREPEATCOUNT
+		$SRESULT &= $SSTRING
+	NEXT
+	RETURN $SRESULT
+ENDFUNC
+Global Const $MY_CONST = 7
+Func _WinAPI_GetLastError()
+	Return 0
+EndFunc
+ConsoleWrite(_StringRepeat("ab", $MY_CONST))
+`
+
+func TestStripUDF(t *testing.T) {
+	db := udf.NewDB()
+	if err := db.AddInclude("String.au3", []byte(fakeInclude)); err != nil {
+		t.Fatal(err)
+	}
+	// saving and loading keeps the fingerprints
+	var buf bytes.Buffer
+	if err := db.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	db, err := udf.LoadDB(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := parser.ParseSource([]byte(expanded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := udf.Strip(script, db, udf.Options{})
+	if len(res.Includes) != 1 || res.Includes[0] != "String.au3" || res.Consts != 3 {
+		t.Errorf("unexpected result %+v", res)
+	}
+	src := ast.Format(script)
+	if !strings.HasPrefix(src, "#include <String.au3>\n") || strings.Contains(src, "_STRINGREPEAT(") ||
+		!strings.Contains(src, "$MY_CONST = 7") || !strings.Contains(src, "_WinAPI_GetLastError") {
+		t.Errorf("bad output:\n%s", src)
+	}
+
+	script, _ = parser.ParseSource([]byte(expanded))
+	res = udf.Strip(script, db, udf.Options{ByName: true})
+	if strings.Join(res.Includes, " ") != "String.au3 WinAPI.au3" {
+		t.Errorf("includes = %v", res.Includes)
+	}
+
+	// a known function the author changed is kept, by name too
+	script, _ = parser.ParseSource([]byte(strings.Replace(expanded, "$SRESULT &= $SSTRING", "$SRESULT &= $SSTRING & @CRLF", 1)))
+	res = udf.Strip(script, db, udf.Options{ByName: true})
+	if len(res.Funcs) != 1 || res.Funcs[0] != "_WinAPI_GetLastError" || !strings.Contains(ast.Format(script), "Func _StringRepeat(") {
+		t.Errorf("changed function removed: %+v\n%s", res, ast.Format(script))
+	}
+}
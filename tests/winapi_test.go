@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"github.com/x0r19x91/libautoit/parser"
+	"github.com/x0r19x91/libautoit/winapi"
+	"reflect"
+	"testing"
+)
+
+const injector = `Global $hK32 = DllOpen("C:\Windows\System32\KERNEL32.DLL")
+Global Const $sWPM = "Write" & "Process" & "Memory"
+_Inject(1234, "0x90C3")
+
+Func _Inject($iPID, $bCode)
+	Local $hProc = DllCall($hK32, "handle", "OpenProcess", "dword", 0x1F0FFF, "bool", 0, "dword", $iPID)[0]
+	Local $pMem = DllCall($hK32, "ptr", "VirtualAllocEx", "handle", $hProc, "ptr", 0, "ulong_ptr", 2, "dword", 0x3000, "dword", 0x40)[0]
+	Local $tCode = DllStructCreate("byte[" & BinaryLen($bCode) & "]")
+	DllCall("kernel32", "bool", $sWPM, "handle", $hProc, "ptr", $pMem, "struct*", $tCode, "ulong_ptr", 2, "ulong_ptr*", 0)
+	DllCall("kernel32.dll", "handle", "CreateRemoteThread", "handle", $hProc, "ptr", 0, "ulong_ptr", 0, "ptr", $pMem, "ptr", 0, "dword", 0, "dword*", 0)
+EndFunc
+
+Func _Never()
+	Return DllCall("kernel32.dll", "bool", Chr(73) & "sDebuggerPresent")
+EndFunc
+`
+
+func TestWinAPI(t *testing.T) {
+	script, err := parser.ParseSource([]byte(injector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep := winapi.Analyze(script, winapi.Options{})
+	want := []string{
+		"DllOpen",
+		"DllStructCreate",
+		"kernel32.dll!CreateRemoteThread",
+		"kernel32.dll!IsDebuggerPresent",
+		"kernel32.dll!OpenProcess",
+		"kernel32.dll!VirtualAllocEx",
+		"kernel32.dll!WriteProcessMemory",
+	}
+	if got := rep.APIs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("APIs = %q", got)
+	}
+	var wpm *winapi.Call
+	for _, c := range rep.Calls {
+		if c.Name == "WriteProcessMemory" {
+			wpm = c
+		}
+	}
+	if wpm == nil || wpm.Func != "_Inject" || wpm.Return != "bool" || !wpm.Resolved || !wpm.Reachable ||
+		!reflect.DeepEqual(wpm.Args, []string{"handle", "ptr", "struct*", "ulong_ptr", "ulong_ptr*"}) {
+		t.Errorf("bad call %+v", wpm)
+	}
+	if !rep.Has("process-injection") || rep.Has("anti-debug") {
+		t.Errorf("capabilities %+v", rep.Capabilities)
+	}
+	if rep := winapi.Analyze(script, winapi.Options{Unreachable: true}); !rep.Has("anti-debug") {
+		t.Errorf("anti-debug not found in unreachable code")
+	}
+}
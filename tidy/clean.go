@@ -5,7 +5,9 @@ package tidy
 //
 
 import (
+    "context"
     "github.com/x0r19x91/libautoit/lexer"
+    "github.com/x0r19x91/libautoit/progress"
     "strings"
 )
 
@@ -116,8 +118,21 @@ func addLeadingSpaces(nIndent int, useTabs bool, nIndentWidth int) string {
 
 // Clean up
 func (pp *indentInfo) Tidy() string {
+    ans, _ := pp.TidyContext(context.Background())
+    return ans
+}
+
+// TidyContext is Tidy, stopping with the error of ctx when it is done.
+func (pp *indentInfo) TidyContext(ctx context.Context) (string, error) {
+    defer progress.End(ctx, "")
     identSet := make(map[string]string)
-    for {
+    // by tokens, a script can be a single huge line
+    for nTokens := 0; ; nTokens++ {
+        if nTokens%1024 == 0 {
+            if err := ctx.Err(); err != nil {
+                return pp.lines.String(), err
+            }
+        }
         pp.lastToken = pp.currToken
         pp.currToken = pp.lexer.NextToken()
         if pp.currToken.TokType == lexer.EOF ||
@@ -132,7 +147,8 @@ func (pp *indentInfo) Tidy() string {
             pp.iIfState = 0
             pp.nLinesProcessed++
             pp.lines.WriteString(strings.TrimRight(pp.buf, " "))
-            go pp.notifyFn(pp.nLinesProcessed, pp.lexer.NumberOfLines())
+            pp.notifyFn(pp.nLinesProcessed, pp.lexer.NumberOfLines())
+            progress.Report(ctx, progress.Event{Stage: progress.Tidy, Done: pp.nLinesProcessed, Total: pp.lexer.NumberOfLines()})
             pp.lines.WriteRune('\n')
             if pp.iStateExtraNl == 1 {
                 if pp.useExtraNl {
@@ -314,5 +330,6 @@ func (pp *indentInfo) Tidy() string {
 			pp.buf += " "
 		}
 	}
-	return pp.lines.String()
+	progress.Report(ctx, progress.Event{Stage: progress.Tidy, Done: pp.nLinesProcessed, Total: pp.nLinesProcessed})
+	return pp.lines.String(), nil
 }
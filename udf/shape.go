@@ -0,0 +1,69 @@
+package udf
+
+import (
+	"fmt"
+	"github.com/x0r19x91/libautoit/ast"
+	"strings"
+)
+
+// Shape fingerprints a function without the names of its variables and
+// of the user functions it calls, so a UDF is still recognized once an
+// obfuscator renamed everything. Vars lists the variables in order of
+// first use, the same position in two functions of the same shape is
+// the same variable.
+type Shape struct {
+	Hash string
+	Vars []string
+}
+
+func FuncShape(fn *ast.FuncDecl) *Shape {
+	var sb strings.Builder
+	vars := make(map[string]int)
+	sh := &Shape{}
+	ast.Inspect(fn, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case nil:
+			sb.WriteByte(')')
+			return false
+		case *ast.Variable:
+			key := strings.ToLower(n.Name)
+			if _, ok := vars[key]; !ok {
+				vars[key] = len(sh.Vars)
+				sh.Vars = append(sh.Vars, n.Name)
+			}
+			fmt.Fprintf(&sb, "$%d", vars[key])
+		case *ast.FuncIdent:
+			if n.Builtin {
+				sb.WriteString(strings.ToLower(n.Name))
+			} else {
+				sb.WriteString("f")
+			}
+		case *ast.BasicLit:
+			fmt.Fprintf(&sb, "%d:%q", n.Kind, strings.ToLower(n.Value))
+		case *ast.KeywordLit:
+			sb.WriteString(strings.ToLower(n.Name))
+		case *ast.MacroExpr:
+			sb.WriteString("@" + strings.ToLower(n.Name))
+		case *ast.SelectorExpr:
+			sb.WriteString("." + strings.ToLower(n.Sel))
+		case *ast.UnaryExpr:
+			fmt.Fprintf(&sb, "u%d", n.Op)
+		case *ast.BinaryExpr:
+			fmt.Fprintf(&sb, "b%d", n.Op)
+		case *ast.AssignStmt:
+			fmt.Fprintf(&sb, "a%d", n.Op)
+		case *ast.DeclStmt:
+			fmt.Fprintf(&sb, "%s%t%t", strings.ToLower(n.Scope), n.Static, n.Const)
+		case *ast.BranchStmt:
+			sb.WriteString(strings.ToLower(n.Tok))
+		case *ast.Param:
+			fmt.Fprintf(&sb, "p%t%t", n.ByRef, n.Const)
+		default:
+			fmt.Fprintf(&sb, "%T", n)
+		}
+		sb.WriteByte('(')
+		return true
+	})
+	sh.Hash = hash(sb.String())
+	return sh
+}
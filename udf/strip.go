@@ -0,0 +1,195 @@
+package udf
+
+import (
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/lexer"
+	"strings"
+)
+
+// Families maps the name prefixes of standard UDF functions to their
+// include, used when matching by name. Longer prefixes come first.
+var Families = []struct {
+	Prefix  string
+	Include string
+}{
+	{"_GUICtrlListView_", "GuiListView.au3"},
+	{"_GUICtrlTreeView_", "GuiTreeView.au3"},
+	{"_GUICtrlComboBox_", "GuiComboBox.au3"},
+	{"_GUICtrlListBox_", "GuiListBox.au3"},
+	{"_GUICtrlEdit_", "GuiEdit.au3"},
+	{"_GUICtrlButton_", "GuiButton.au3"},
+	{"_GUICtrlStatusBar_", "GuiStatusBar.au3"},
+	{"_GUICtrlToolbar_", "GuiToolbar.au3"},
+	{"_GUICtrlMenu_", "GuiMenu.au3"},
+	{"_GUICtrlTab_", "GuiTab.au3"},
+	{"_GUICtrlRichEdit_", "GuiRichEdit.au3"},
+	{"_GUIImageList_", "GuiImageList.au3"},
+	{"_GUIToolTip_", "GuiToolTip.au3"},
+	{"_Security__", "Security.au3"},
+	{"_WinAPI_", "WinAPI.au3"},
+	{"_GDIPlus_", "GDIPlus.au3"},
+	{"_ClipBoard_", "Clipboard.au3"},
+	{"_EventLog_", "EventLog.au3"},
+	{"_Crypt_", "Crypt.au3"},
+	{"_Excel_", "Excel.au3"},
+	{"_Word_", "Word.au3"},
+	{"_SQLite_", "SQLite.au3"},
+	{"_Timer_", "Timers.au3"},
+	{"_FTP_", "FTPEx.au3"},
+	{"_Date", "Date.au3"},
+	{"_Array", "Array.au3"},
+	{"_File", "File.au3"},
+	{"_Path", "File.au3"},
+	{"_Debug", "Debug.au3"},
+	{"_Color", "Color.au3"},
+	{"_String", "String.au3"},
+	{"_Mem", "Memory.au3"},
+	{"_IE", "IE.au3"},
+	{"_INet", "Inet.au3"},
+	{"_Sound", "Sound.au3"},
+	{"_SendMessage", "SendMessage.au3"},
+}
+
+type Options struct {
+	// ByName also matches functions named like a standard UDF that the
+	// DB doesn't know, using Families to find the include. A function
+	// the DB knows is only removed when its fingerprint matches, a
+	// different body is the author's.
+	ByName bool
+}
+
+type Result struct {
+	Script   *ast.Script
+	Includes []string // in order of first use
+	Funcs    []string // removed functions
+	Consts   int      // number of removed constants
+}
+
+// Strip removes the library code matched by db from a script and puts
+// an #include line where each include started. The script is modified
+// in place.
+func Strip(script *ast.Script, db *DB, opts Options) *Result {
+	res := &Result{Script: script}
+	incs := make([]string, len(script.Stmts))
+	for i, s := range script.Stmts {
+		switch s := s.(type) {
+		case *ast.FuncDecl:
+			incs[i] = db.matchFunc(s, opts)
+		case *ast.DeclStmt:
+			incs[i] = db.matchConsts(s)
+		}
+	}
+	if opts.ByName {
+		inferHelpers(script.Stmts, incs)
+	}
+
+	emitted := make(map[string]bool)
+	var out []ast.Stmt
+	for i, s := range script.Stmts {
+		inc := incs[i]
+		switch s := s.(type) {
+		case *ast.FuncDecl:
+			if inc != "" {
+				res.Funcs = append(res.Funcs, s.Name.Name)
+			}
+		case *ast.DeclStmt:
+			if inc != "" {
+				res.Consts += len(s.Specs)
+			}
+		case *ast.DirectiveStmt:
+			// meaningless once the includes are expanded
+			if strings.EqualFold(strings.TrimSpace(s.Text), "#include-once") {
+				continue
+			}
+		}
+		if inc == "" {
+			out = append(out, s)
+			continue
+		}
+		if !emitted[inc] {
+			emitted[inc] = true
+			res.Includes = append(res.Includes, inc)
+			out = append(out, &ast.DirectiveStmt{DirPos: s.Pos(), Text: "#include <" + inc + ">"})
+		}
+	}
+	script.Stmts = out
+	return res
+}
+
+// inferHelpers assigns internal "__" functions sitting between two
+// functions of the same include to that include
+func inferHelpers(stmts []ast.Stmt, incs []string) {
+	prev := ""
+	for i := 0; i < len(stmts); i++ {
+		fn, ok := stmts[i].(*ast.FuncDecl)
+		if !ok || incs[i] != "" || !strings.HasPrefix(fn.Name.Name, "__") {
+			if incs[i] != "" || ok {
+				prev = incs[i]
+			}
+			continue
+		}
+		next := ""
+		for j := i + 1; j < len(stmts); j++ {
+			if _, ok := stmts[j].(*ast.FuncDecl); ok && incs[j] != "" {
+				next = incs[j]
+				break
+			}
+		}
+		if prev != "" && prev == next {
+			incs[i] = prev
+		}
+	}
+}
+
+func (db *DB) matchFunc(fn *ast.FuncDecl, opts Options) string {
+	e, ok := db.Funcs[strings.ToLower(fn.Name.Name)]
+	if ok && e.has(FuncHash(fn)) {
+		return e.Include
+	}
+	if !opts.ByName || ok {
+		return ""
+	}
+	return Family(fn.Name.Name)
+}
+
+// matchConsts matches a Global Const declaration whose constants all
+// come from the library
+func (db *DB) matchConsts(d *ast.DeclStmt) string {
+	if !d.Const || len(d.Specs) == 0 {
+		return ""
+	}
+	inc := ""
+	for _, spec := range d.Specs {
+		e, ok := db.Consts[strings.ToLower(spec.Name.Name)]
+		if !ok || !e.has(ConstHash(spec)) {
+			return ""
+		}
+		if inc == "" {
+			inc = e.Include
+		}
+	}
+	return inc
+}
+
+// Family returns the include of a standard UDF function from its name,
+// "" if the name isn't a known UDF.
+func Family(name string) string {
+	lower := strings.ToLower(strings.TrimLeft(name, "_"))
+	for _, f := range Families {
+		if !strings.HasPrefix(lower, strings.ToLower(strings.TrimLeft(f.Prefix, "_"))) {
+			continue
+		}
+		// "_WinAPI_" is specific enough, "_File" needs the name listed,
+		// internal helpers start with two underscores and never are
+		if strings.HasSuffix(f.Prefix, "_") || strings.HasPrefix(name, "__") {
+			return f.Include
+		}
+		for _, std := range lexer.Au3UserFunctions {
+			if strings.EqualFold(std, name) {
+				return f.Include
+			}
+		}
+		return ""
+	}
+	return ""
+}
@@ -0,0 +1,183 @@
+package udf
+
+// Recognition of the standard UDF library in decompiled scripts.
+// The compiler expands every #include, so a script recovered from an
+// executable carries the full body of each include it used. Functions
+// and constants are fingerprinted by hashing their normalized source,
+// a DB maps the fingerprints to include files and Strip collapses the
+// matched code back into #include lines.
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/parser"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Entry struct {
+	Name    string              `json:"name,omitempty"`
+	Include string              `json:"include"`
+	Hashes  []string            `json:"hashes"`
+	Shapes  map[string][]string `json:"shapes,omitempty"` // shape hash to variable names
+}
+
+func (e *Entry) has(hash string) bool {
+	for _, h := range e.Hashes {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// DB maps lower case function and constant names to the include they
+// come from and the hashes of their known versions.
+type DB struct {
+	Funcs  map[string]*Entry `json:"funcs"`
+	Consts map[string]*Entry `json:"consts"`
+
+	shapes map[string]string // shape hash to function, "" when ambiguous
+}
+
+func NewDB() *DB {
+	return &DB{
+		Funcs:  make(map[string]*Entry),
+		Consts: make(map[string]*Entry),
+	}
+}
+
+// LoadDB reads a DB saved by Save.
+func LoadDB(r io.Reader) (*DB, error) {
+	db := NewDB()
+	if err := json.NewDecoder(r).Decode(db); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func (db *DB) Save(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", " ")
+	return enc.Encode(db)
+}
+
+func add(m map[string]*Entry, name, include, hash string) *Entry {
+	key := strings.ToLower(name)
+	e, ok := m[key]
+	if !ok {
+		e = &Entry{Name: name, Include: include}
+		m[key] = e
+	}
+	if !e.has(hash) {
+		e.Hashes = append(e.Hashes, hash)
+	}
+	return e
+}
+
+// AddInclude fingerprints the functions and global constants of an
+// include file. Indexing several versions of the same file is fine,
+// every version is matched.
+func (db *DB) AddInclude(include string, src []byte) error {
+	script, err := parser.ParseSource(src)
+	if script == nil {
+		return err
+	}
+	for _, s := range script.Stmts {
+		switch s := s.(type) {
+		case *ast.FuncDecl:
+			e := add(db.Funcs, s.Name.Name, include, FuncHash(s))
+			sh := FuncShape(s)
+			if e.Shapes == nil {
+				e.Shapes = make(map[string][]string)
+			}
+			e.Shapes[sh.Hash] = sh.Vars
+			db.shapes = nil
+		case *ast.DeclStmt:
+			if !s.Const {
+				continue
+			}
+			for _, spec := range s.Specs {
+				add(db.Consts, spec.Name.Name, include, ConstHash(spec))
+			}
+		}
+	}
+	// partially parsed files still give useful fingerprints
+	return nil
+}
+
+// MatchShape finds the UDF a possibly renamed function is a copy of.
+// vars gives the original name of each variable of the function's
+// shape.
+func (db *DB) MatchShape(fn *ast.FuncDecl) (e *Entry, vars []string, ok bool) {
+	if db.shapes == nil {
+		db.shapes = make(map[string]string)
+		for key, e := range db.Funcs {
+			for h := range e.Shapes {
+				if other, dup := db.shapes[h]; dup && other != key {
+					db.shapes[h] = ""
+					continue
+				}
+				db.shapes[h] = key
+			}
+		}
+	}
+	sh := FuncShape(fn)
+	key := db.shapes[sh.Hash]
+	if key == "" {
+		return nil, nil, false
+	}
+	e = db.Funcs[key]
+	return e, e.Shapes[sh.Hash], true
+}
+
+// IndexDir fingerprints every .au3 file of an AutoIt Include directory.
+func (db *DB) IndexDir(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.EqualFold(filepath.Ext(path), ".au3") {
+			return nil
+		}
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return db.AddInclude(filepath.Base(path), src)
+	})
+}
+
+// normalize prints a node without comments or extra blank lines and
+// folds the case, the binary token stream of old versions stores
+// identifiers upper cased
+func normalize(n ast.Node) string {
+	var sb strings.Builder
+	p := &ast.Printer{IndentSpaces: 1}
+	p.Fprint(&sb, n)
+	return strings.ToLower(sb.String())
+}
+
+func hash(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// FuncHash fingerprints a function declaration.
+func FuncHash(fn *ast.FuncDecl) string {
+	return hash(normalize(fn))
+}
+
+// ConstHash fingerprints a single constant of a declaration.
+func ConstHash(spec *ast.VarSpec) string {
+	s := "$" + strings.ToLower(spec.Name.Name)
+	if spec.Value != nil {
+		s += "=" + strings.ToLower(ast.ExprString(spec.Value))
+	}
+	return hash(s)
+}
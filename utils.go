@@ -26,6 +26,9 @@ const (
 	InvalidSignature
 	InvalidCompressedSize
 	OutOfBounds
+	TooManyResources
+	ResourceTooLarge
+	OutputTooLarge
 )
 
 var errMap = map[Au3Error]string{
@@ -34,6 +37,9 @@ var errMap = map[Au3Error]string{
 	InvalidSignature:      "Invalid Signature in Compressed Data.",
 	InvalidCompressedSize: "Invalid Compressed Size.",
 	OutOfBounds:           "Index out of Bounds.",
+	TooManyResources:      "Too many Resources.",
+	ResourceTooLarge:      "Resource too Large.",
+	OutputTooLarge:        "Total Output too Large.",
 }
 
 var (
@@ -42,6 +48,9 @@ var (
 	ErrInvalidSignature      = &autoItError{err: InvalidSignature}
 	ErrInvalidCompressedSize = &autoItError{err: InvalidCompressedSize}
 	ErrOutOfBounds           = &autoItError{err: OutOfBounds}
+	ErrTooManyResources      = &autoItError{err: TooManyResources}
+	ErrResourceTooLarge      = &autoItError{err: ResourceTooLarge}
+	ErrOutputTooLarge        = &autoItError{err: OutputTooLarge}
 )
 
 type autoItError struct {
@@ -73,16 +82,6 @@ func IsPrintable(buf []byte) bool {
 	return len(buf) > 0
 }
 
-// copy() doesn't copy overlapping slices
-// copyOverlapping:
-// dst and src can point to same underlying array
-// works fine...
-func copyOverlapping(dst, src []byte) {
-	for i, b := range src {
-		dst[i] = b
-	}
-}
-
 func FromUtf16(data []byte) string {
 	u16 := make([]uint16, len(data)/2)
 	for i := 0; i < len(data)-1; i += 2 {
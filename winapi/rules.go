@@ -0,0 +1,61 @@
+package winapi
+
+// Rule tags a capability when every group of APIs has at least one
+// member called. Names are matched case insensitively and without their
+// A or W suffix, DllCallAddress stands for any call through a raw
+// pointer.
+type Rule struct {
+	Tag    string
+	Groups [][]string
+}
+
+var Rules = []Rule{
+	{"process-injection", [][]string{
+		{"VirtualAllocEx", "NtAllocateVirtualMemory", "ZwAllocateVirtualMemory", "NtMapViewOfSection", "ZwMapViewOfSection"},
+		{"WriteProcessMemory", "NtWriteVirtualMemory", "ZwWriteVirtualMemory", "NtMapViewOfSection", "ZwMapViewOfSection"},
+		{"CreateRemoteThread", "CreateRemoteThreadEx", "NtCreateThreadEx", "RtlCreateUserThread", "QueueUserAPC", "NtQueueApcThread", "SetThreadContext", "Wow64SetThreadContext"},
+	}},
+	{"process-hollowing", [][]string{
+		{"CreateProcess", "CreateProcessInternal"},
+		{"NtUnmapViewOfSection", "ZwUnmapViewOfSection"},
+		{"SetThreadContext", "Wow64SetThreadContext", "NtSetContextThread"},
+		{"ResumeThread", "NtResumeThread"},
+	}},
+	{"shellcode-execution", [][]string{
+		{"VirtualAlloc", "VirtualProtect", "NtProtectVirtualMemory", "HeapCreate"},
+		{"DllCallAddress", "CallWindowProc", "CreateThread", "EnumWindows", "EnumChildWindows", "EnumSystemLocales", "EnumDesktops"},
+	}},
+	{"dynamic-api-resolution", [][]string{
+		{"LoadLibrary", "LoadLibraryEx", "LdrLoadDll", "GetModuleHandle"},
+		{"GetProcAddress", "LdrGetProcedureAddress"},
+	}},
+	{"anti-debug", [][]string{
+		{"IsDebuggerPresent", "CheckRemoteDebuggerPresent", "NtQueryInformationProcess", "ZwQueryInformationProcess", "NtSetInformationThread", "OutputDebugString", "NtQuerySystemInformation"},
+	}},
+	{"keylogging", [][]string{
+		{"SetWindowsHookEx", "GetAsyncKeyState", "GetKeyboardState", "RegisterRawInputDevices", "GetRawInputData"},
+	}},
+	{"screen-capture", [][]string{
+		{"GetDC", "GetWindowDC", "CreateDC"},
+		{"BitBlt", "StretchBlt", "PrintWindow"},
+	}},
+	{"persistence", [][]string{
+		{"CreateService", "ChangeServiceConfig", "RegSetValueEx", "RegSetKeyValue", "SHSetValue", "NtSetValueKey"},
+	}},
+	{"privilege-escalation", [][]string{
+		{"OpenProcessToken", "OpenThreadToken"},
+		{"AdjustTokenPrivileges", "RtlAdjustPrivilege"},
+	}},
+	{"process-enumeration", [][]string{
+		{"CreateToolhelp32Snapshot", "EnumProcesses", "NtQuerySystemInformation"},
+	}},
+	{"process-termination", [][]string{
+		{"TerminateProcess", "NtTerminateProcess"},
+	}},
+	{"download", [][]string{
+		{"URLDownloadToFile", "URLDownloadToCacheFile", "InternetOpenUrl", "InternetReadFile", "WinHttpReadData", "HttpSendRequest"},
+	}},
+	{"crypto", [][]string{
+		{"CryptAcquireContext", "CryptDecrypt", "CryptEncrypt", "CryptImportKey", "CryptDeriveKey", "BCryptDecrypt", "BCryptEncrypt"},
+	}},
+}
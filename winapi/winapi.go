@@ -0,0 +1,347 @@
+package winapi
+
+// Inventory of the Windows API a script reaches through DllCall.
+// Every DllCall, DllCallAddress, DllStructCreate and DllOpen is listed
+// with the names and types it uses, resolved through constant folding
+// and variables holding constants or DllOpen handles. The APIs called
+// are then matched against Rules to tag capabilities such as process
+// injection.
+
+import (
+	"github.com/x0r19x91/libautoit/ast"
+	"github.com/x0r19x91/libautoit/callgraph"
+	"github.com/x0r19x91/libautoit/eval"
+	"github.com/x0r19x91/libautoit/lexer"
+	"github.com/x0r19x91/libautoit/symbols"
+	"path"
+	"sort"
+	"strings"
+)
+
+type Call struct {
+	Pos       ast.Pos
+	Func      string   // enclosing function, "" at the top level
+	Builtin   string   // DllCall, DllCallAddress, DllStructCreate or DllOpen
+	Dll       string   // lower case file name, "" when unknown
+	Name      string   // API called by DllCall
+	Return    string   // return type of DllCall and DllCallAddress
+	Args      []string // argument types, "" when unknown
+	Struct    string   // definition given to DllStructCreate
+	Resolved  bool     // every name and type is known
+	Reachable bool     // the top level code can get to the call
+}
+
+// API returns "dll!name" for a DllCall and the builtin name for the
+// others.
+func (c *Call) API() string {
+	if c.Builtin != "DllCall" {
+		return c.Builtin
+	}
+	dll := c.Dll
+	if dll == "" {
+		dll = "?"
+	}
+	name := c.Name
+	if name == "" {
+		name = "?"
+	}
+	return dll + "!" + name
+}
+
+type Capability struct {
+	Tag   string
+	APIs  []string // APIs matching the rule
+	Calls []*Call
+}
+
+type Report struct {
+	Calls        []*Call
+	Capabilities []*Capability
+}
+
+// APIs returns the distinct APIs called, sorted.
+func (r *Report) APIs() []string {
+	seen := make(map[string]bool)
+	var ans []string
+	for _, c := range r.Calls {
+		if api := c.API(); !seen[api] {
+			seen[api] = true
+			ans = append(ans, api)
+		}
+	}
+	sort.Strings(ans)
+	return ans
+}
+
+// Has reports whether a capability was found.
+func (r *Report) Has(tag string) bool {
+	for _, c := range r.Capabilities {
+		if c.Tag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+type Options struct {
+	// Unreachable uses the calls the top level code never gets to when
+	// tagging capabilities. Included UDFs are full of those.
+	Unreachable bool
+}
+
+type analyzer struct {
+	info    *symbols.Info
+	consts  map[*symbols.Symbol]*eval.Value // nil when not constant
+	handles map[*symbols.Symbol]string      // DllOpen results
+	live    map[string]bool
+	fn      string
+	report  *Report
+}
+
+// Analyze lists the native calls of a script and tags its
+// capabilities.
+func Analyze(script *ast.Script, opts Options) *Report {
+	a := &analyzer{
+		info:    symbols.Resolve(script),
+		consts:  make(map[*symbols.Symbol]*eval.Value),
+		handles: make(map[*symbols.Symbol]string),
+		live:    map[string]bool{"": true},
+		report:  &Report{},
+	}
+	g := callgraph.Build(script)
+	for _, n := range g.Reachable(g.Root) {
+		if n.Kind == callgraph.UserFunc {
+			a.live[strings.ToLower(n.Name)] = true
+		}
+	}
+	a.values(script)
+	ast.Inspect(script, a.visit)
+
+	calls := a.report.Calls
+	if !opts.Unreachable {
+		calls = nil
+		for _, c := range a.report.Calls {
+			if c.Reachable {
+				calls = append(calls, c)
+			}
+		}
+	}
+	a.report.Capabilities = match(calls)
+	return a.report
+}
+
+// values finds the variables that always hold the same constant or
+// the same DllOpen handle
+func (a *analyzer) values(script *ast.Script) {
+	bad := make(map[*symbols.Symbol]bool)
+	set := func(v *ast.Variable, x ast.Expr) {
+		sym := a.info.SymbolOf(v)
+		if sym == nil || bad[sym] {
+			return
+		}
+		if call, ok := x.(*ast.CallExpr); ok && strings.EqualFold(call.CalleeName(), "DllOpen") && len(call.Args) > 0 {
+			if dll, ok := a.str(call.Args[0]); ok {
+				if old, seen := a.handles[sym]; !seen || old == dllName(dll) {
+					a.handles[sym] = dllName(dll)
+					return
+				}
+			}
+		}
+		val, err := eval.Const(x)
+		if old, seen := a.consts[sym]; err != nil || seen && !old.Equal(val) {
+			bad[sym] = true
+			delete(a.consts, sym)
+			return
+		}
+		a.consts[sym] = &val
+	}
+	ast.Inspect(script, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.VarSpec:
+			if n.Value != nil {
+				set(n.Name, n.Value)
+			}
+		case *ast.AssignStmt:
+			if v, ok := n.Lhs.(*ast.Variable); ok {
+				if n.Op != lexer.OpAssign {
+					bad[a.info.SymbolOf(v)] = true
+					delete(a.consts, a.info.SymbolOf(v))
+					break
+				}
+				set(v, n.Rhs)
+			}
+		}
+		return true
+	})
+}
+
+// str resolves a string argument
+func (a *analyzer) str(x ast.Expr) (string, bool) {
+	if v, err := eval.Const(x); err == nil {
+		return v.Str(), true
+	}
+	if v, ok := x.(*ast.Variable); ok {
+		if val := a.consts[a.info.SymbolOf(v)]; val != nil {
+			return val.Str(), true
+		}
+	}
+	return "", false
+}
+
+// dllName normalizes a DLL path to its lower case file name
+func dllName(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = path.Base(strings.Replace(s, "\\", "/", -1))
+	if path.Ext(s) == "" {
+		s += ".dll"
+	}
+	return s
+}
+
+func (a *analyzer) dll(x ast.Expr) string {
+	if v, ok := x.(*ast.Variable); ok {
+		if h, ok := a.handles[a.info.SymbolOf(v)]; ok {
+			return h
+		}
+	}
+	if s, ok := a.str(x); ok {
+		return dllName(s)
+	}
+	return ""
+}
+
+// types resolves the types of "type, value" argument pairs
+func (a *analyzer) types(args []ast.Expr) ([]string, bool) {
+	var ans []string
+	ok := true
+	for i := 0; i < len(args); i += 2 {
+		s, known := a.str(args[i])
+		ans = append(ans, strings.ToLower(s))
+		ok = ok && known
+	}
+	return ans, ok
+}
+
+func (a *analyzer) visit(n ast.Node) bool {
+	switch n := n.(type) {
+	case *ast.FuncDecl:
+		a.fn = n.Name.Name
+		ast.Inspect(n.Body, a.visit)
+		a.fn = ""
+		return false
+	case *ast.CallExpr:
+		if n.IsBuiltin() {
+			a.call(n)
+		}
+	}
+	return true
+}
+
+func (a *analyzer) call(n *ast.CallExpr) {
+	c := &Call{
+		Pos:       n.Pos(),
+		Func:      a.fn,
+		Reachable: a.live[strings.ToLower(a.fn)],
+		Resolved:  true,
+	}
+	args := n.Args
+	arg := func(i int) (string, bool) {
+		if i >= len(args) {
+			return "", true
+		}
+		return a.str(args[i])
+	}
+	var ok bool
+	switch strings.ToLower(n.CalleeName()) {
+	case "dllcall":
+		c.Builtin = "DllCall"
+		if len(args) < 3 {
+			return
+		}
+		c.Dll = a.dll(args[0])
+		c.Return, ok = arg(1)
+		c.Resolved = ok && c.Dll != ""
+		c.Name, ok = arg(2)
+		c.Resolved = c.Resolved && ok
+		c.Args, ok = a.types(args[3:])
+		c.Resolved = c.Resolved && ok
+	case "dllcalladdress":
+		c.Builtin = "DllCallAddress"
+		if len(args) < 2 {
+			return
+		}
+		c.Return, c.Resolved = arg(0)
+		c.Args, ok = a.types(args[2:])
+		c.Resolved = c.Resolved && ok
+	case "dllstructcreate":
+		c.Builtin = "DllStructCreate"
+		c.Struct, c.Resolved = arg(0)
+	case "dllopen":
+		c.Builtin = "DllOpen"
+		if len(args) > 0 {
+			c.Dll = a.dll(args[0])
+			c.Resolved = c.Dll != ""
+		}
+	default:
+		return
+	}
+	c.Return = strings.ToLower(c.Return)
+	a.report.Calls = append(a.report.Calls, c)
+}
+
+// baseName drops the A or W suffix of an API
+func baseName(name string) string {
+	name = strings.ToLower(name)
+	if n := len(name); n > 1 && (name[n-1] == 'a' || name[n-1] == 'w') && name[n-2] >= 'a' && name[n-2] <= 'z' {
+		return name[:n-1]
+	}
+	return name
+}
+
+func match(calls []*Call) []*Capability {
+	byName := make(map[string][]*Call)
+	for _, c := range calls {
+		switch c.Builtin {
+		case "DllCall":
+			if c.Name != "" {
+				key := strings.ToLower(c.Name)
+				byName[key] = append(byName[key], c)
+				if b := baseName(c.Name); b != key {
+					byName[b] = append(byName[b], c)
+				}
+			}
+		case "DllCallAddress":
+			byName["dllcalladdress"] = append(byName["dllcalladdress"], c)
+		}
+	}
+	var ans []*Capability
+	for _, r := range Rules {
+		capa := &Capability{Tag: r.Tag}
+		seen := make(map[*Call]bool)
+		for _, group := range r.Groups {
+			found := false
+			for _, api := range group {
+				cs := byName[strings.ToLower(api)]
+				if len(cs) == 0 {
+					continue
+				}
+				found = true
+				capa.APIs = append(capa.APIs, api)
+				for _, c := range cs {
+					if !seen[c] {
+						seen[c] = true
+						capa.Calls = append(capa.Calls, c)
+					}
+				}
+			}
+			if !found {
+				capa = nil
+				break
+			}
+		}
+		if capa != nil {
+			ans = append(ans, capa)
+		}
+	}
+	return ans
+}